@@ -22,6 +22,12 @@ func main() {
 			Usage:  "Clean binaries",
 			Action: cleanCommand,
 		},
+		{
+			Name:      "certs",
+			Usage:     "Create development CA and certificates of services (mutual TLS)",
+			ArgsUsage: "[service names, default is services from tie.yaml]",
+			Action:    certsCommand,
+		},
 	}
 
 	app.Flags = []cli.Flag{
@@ -65,3 +71,13 @@ func cleanCommand(c *cli.Context) error {
 	}
 	return nil
 }
+
+func certsCommand(c *cli.Context) error {
+	dir, names, err := tasks.CreateCerts(".", c.Args())
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Created certificates in %s: %s\n", dir, strings.Join(names, ", "))
+	fmt.Printf("Use them in tie.yaml, e.g.\n  tls:\n    cert: %[1]s/%[2]s.pem\n    key: %[1]s/%[2]s-key.pem\n    ca: %[1]s/ca.pem\n    client_auth: true\n", dir, names[0])
+	return nil
+}
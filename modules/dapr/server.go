@@ -20,18 +20,15 @@ const json = "encoding/json"
 //TODO
 func GenerateClient(p *parser.Parser) (pkg *template.Package) {
 	info := template.NewPackageInfoFromParser(p)
-	//TODO all modules needs to create upgraded subpackage to make ServicePath reusable,
-	info.SetServicePath(info.Service.Name + "/tie_modules/daprmod/upgraded")
 	f := NewFile(strings.ToLower(daprModuleId))
 
 	template.TemplateClient(info, f, func(ids template.ClientMethodIds, g *Group) {
 		id := template.ID
 		client, data, content, out := id("client"), id("data"), id("content"), id("out")
 
-		//TODO maybe use global dapr client declaration
+		//Default client is shared by calls (it is created once by sdk), it is not closed
 		g.List(Id(client), Id(ids.Err)).Op(":=").Qual(daprClient, "NewClient").Call()
 		template.AddIfErrorGuard(g, nil, ids.Err, nil)
-		g.Defer().Id(client).Dot("Close").Call()
 
 		g.List(Id(data), Id(ids.Err)).Op(":=").Qual(json, "Marshal").Call(Id(ids.Request))
 		template.AddIfErrorGuard(g, nil, ids.Err, nil)
@@ -43,11 +40,15 @@ func GenerateClient(p *parser.Parser) (pkg *template.Package) {
 			})
 
 		g.List(Id(out), Id(ids.Err)).Op(":=").
-			Id(client).Dot("InvokeServiceWithContent").Call(
-			Qual("context", "TODO").Call(), Lit(ids.Resource), Lit(ids.Method), Id(content))
-		template.AddIfErrorGuard(g, nil, ids.Err, nil)
+			Id(client).Dot("InvokeMethodWithContent").Call(
+			ids.Context, Lit(ids.Resource), Lit(ids.Method), Lit("post"), Id(content))
+		//Errors of function can't be told from errors of transport
+		g.If(Id(ids.Err).Op("!=").Nil()).Block(
+			Id(ids.Err).Op("=").Id(template.RetryableHelper).Call(Id(ids.Err)),
+			Return(),
+		)
 
-		g.Err().Op("=").Qual(json, "Unmarshal").
+		g.Id(ids.Err).Op("=").Qual(json, "Unmarshal").
 			Call(Id(out), Id(ids.Response))
 	})
 
@@ -68,7 +69,8 @@ func NewModule(p *parser.Parser, services []string) template.Module {
 		NewUpgradedModule(p, services),
 		protobuf.NewModule(p),
 	}
-	return modutils.NewStandartModule("daprmod", GenerateServer, p, deps)
+	return modutils.NewStandartModule("daprmod", GenerateServer, p, deps).
+		WithValidator(template.NewDepsValidator("dapr", template.RpcDeps(), nil))
 }
 
 func GenerateUpgraded(p *parser.Parser, services []string) (pkg *template.Package) {
@@ -95,7 +97,6 @@ func NewUpgradedModule(p *parser.Parser, services []string) template.Module {
 
 func GenerateServer(p *parser.Parser) *template.Package {
 	info := template.NewPackageInfoFromParser(p)
-	info.SetServicePath(info.Service.Name + "/tie_modules/daprmod/upgraded")
 	f := NewFile(strings.ToLower(daprModuleId))
 
 	template.TemplateRpcServer(info, f, template.TemplateServerConfig{
@@ -104,14 +105,34 @@ func GenerateServer(p *parser.Parser) *template.Package {
 		},
 		GenHandler: genDaprHandler,
 	})
+	createStateStore(info, f)
+	makeAuthHeaderHelper(info, f)
+
+	return template.NewPackage(info, "daprmod", "server.go", f.GoString())
+}
 
-	return modutils.NewPackage("daprmod", "server.go", f.GoString())
+//makeAuthHeaderHelper creates helpers that authenticate calls by authorization metadata
+//(sidecar passes headers of invocation as gRPC metadata).
+func makeAuthHeaderHelper(info *template.PackageInfo, f *File) {
+	template.AddPrincipalHelpers(f)
+	if !template.IsAuth(info) {
+		return
+	}
+	template.AddCallAuthHelpers(info, f)
+	f.Func().Id(template.AuthHeaderHelper).Params(Id("ctx").Qual("context", "Context")).Qual("net/http", "Header").Block(
+		Id("header").Op(":=").Qual("net/http", "Header").Values(),
+		List(Id("md"), Id("_")).Op(":=").Qual("google.golang.org/grpc/metadata", "FromIncomingContext").Call(Id("ctx")),
+		For(List(Id("_"), Id("value")).Op(":=").Range().Id("md").Dot("Get").Call(Lit("authorization"))).Block(
+			Id("header").Dot("Add").Call(Lit("Authorization"), Id("value")),
+		),
+		Return(Id("header")),
+	)
 }
 
 func genDaprHandler(info *template.PackageInfo, file *File, fn parser.Function) {
 	_, request, response := template.GetMethodTypes(fn)
 	body := func(g *Group, resourceInstance string) {
-		deps := template.DepsMap{"getEnv": Id(template.GetEnvHelper)}
+		template.AuthRPCCall(info, g)
 		if len(fn.Arguments) != 0 {
 			g.Id("request").Op(":=").New(Id(request))
 
@@ -123,7 +144,7 @@ func genDaprHandler(info *template.PackageInfo, file *File, fn parser.Function)
 		g.Var().Id("response").Id(response)
 
 		template.MakeOriginalCall(
-			info, fn, g, deps,
+			info, fn, g, template.RpcDeps(),
 			ifDaprHandlerError,
 			resourceInstance,
 		)
@@ -157,8 +178,20 @@ func ifDaprHandlerError(scope *Group, statement *Statement) {
 func makeStartServer(info *template.PackageInfo, g *Group, f *File, resourceInstance string) {
 	const serverInstance = "DaprService"
 	//Init Server
-	g.List(Id(serverInstance), Err()).Op(":=").Qual(daprService, "NewService").Call(Lit(":50001"))
-	template.AddIfErrorGuard(g, nil, "err", Err())
+	if template.IsTLS(info) {
+		//Sidecar connects to app with TLS (grpcs app protocol)
+		g.List(Id("tlsConfig"), Err()).Op(":=").Add(template.Lifecycle(info, template.TLSConfigHelper)).Call()
+		template.AddIfErrorGuard(g, nil, "err", Err())
+		g.List(Id("listener"), Err()).Op(":=").Qual("net", "Listen").Call(Lit("tcp"), Lit(":50001"))
+		template.AddIfErrorGuard(g, nil, "err", Err())
+		g.Id(serverInstance).Op(":=").Qual(daprService, "NewServiceWithListener").Call(
+			Id("listener"),
+			Qual("google.golang.org/grpc", "Creds").Call(Qual("google.golang.org/grpc/credentials", "NewTLS").Call(Id("tlsConfig"))),
+		)
+	} else {
+		g.List(Id(serverInstance), Err()).Op(":=").Qual(daprService, "NewService").Call(Lit(":50001"))
+		template.AddIfErrorGuard(g, nil, "err", Err())
+	}
 
 	//.2 Add handler for each function.
 	template.ForEachFunction(info, true, func(fn parser.Function) {
@@ -171,10 +204,68 @@ func makeStartServer(info *template.PackageInfo, g *Group, f *File, resourceInst
 		template.AddIfErrorGuard(g, nil, "err", Err())
 	})
 
+	//Dapr checks app health with readiness check
+	g.Err().Op("=").Id(serverInstance).Dot("AddHealthCheckHandler").Call(Lit(""),
+		Func().Params(Qual("context", "Context")).Error().Block(
+			Return(template.Lifecycle(info, template.HealthReadyHelper).Call()),
+		),
+	)
+	template.AddIfErrorGuard(g, nil, "err", Err())
+
+	template.MakeAddServerHook(info, g,
+		Func().Params(Qual("context", "Context")).Error().Block(
+			Return(Id(serverInstance).Dot("GracefulStop").Call()),
+		),
+	)
+	//Service listens since it is created
+	template.MakeReady(info, g)
 	startStmt := Err().Op(":=").Id(serverInstance).Dot("Start").Call()
 	template.AddIfErrorGuard(g, startStmt, "err", Err())
 }
 
+//createStateStore registers dapr state store (path is dapr state store component name).
+func createStateStore(info *template.PackageInfo, f *File) {
+	if info.Service.State == nil {
+		return
+	}
+	store := Id("s").Op("*").Id("daprStateStore")
+	key := Id("key").String()
+	ctx := Qual("context", "Background").Call()
+
+	f.Type().Id("daprStateStore").Struct(
+		Id("client").Qual(daprClient, "Client"),
+		Id("name").String(),
+	)
+
+	f.Func().Id("init").Params().Block(
+		template.Lifecycle(info, template.StateStoresVar).Index(Lit("dapr")).Op("=").
+			Func().Params(Id("name").String()).
+			Params(template.Lifecycle(info, template.StateStoreType), Error()).Block(
+			If(Id("name").Op("==").Lit("")).Block(Id("name").Op("=").Lit("statestore")),
+			List(Id("client"), Err()).Op(":=").Qual(daprClient, "NewClient").Call(),
+			If(Err().Op("!=").Nil()).Block(Return(Nil(), Err())),
+			Return(Op("&").Id("daprStateStore").Values(Id("client"), Id("name")), Nil()),
+		),
+	)
+
+	f.Func().Params(store).Id("Load").Params(key).Params(Index().Byte(), Bool(), Error()).Block(
+		List(Id("item"), Err()).Op(":=").Id("s").Dot("client").Dot("GetState").
+			Call(ctx, Id("s").Dot("name"), Id("key"), Nil()),
+		If(Err().Op("!=").Nil().Op("||").Len(Id("item").Dot("Value")).Op("==").Lit(0)).Block(
+			Return(Nil(), False(), Err()),
+		),
+		Return(Id("item").Dot("Value"), True(), Nil()),
+	)
+
+	f.Func().Params(store).Id("Save").Params(key, Id("data").Index().Byte()).Error().Block(
+		Return(Id("s").Dot("client").Dot("SaveState").Call(ctx, Id("s").Dot("name"), Id("key"), Id("data"), Nil())),
+	)
+
+	f.Func().Params(store).Id("Delete").Params(key).Error().Block(
+		Return(Id("s").Dot("client").Dot("DeleteState").Call(ctx, Id("s").Dot("name"), Id("key"), Nil())),
+	)
+}
+
 func getGrpcMethodRoute(fn parser.Function) string {
 	route := fmt.Sprintf("%s", fn.Name)
 	if fn.Receiver.IsDefined() {
@@ -0,0 +1,215 @@
+package httpmod
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/angrypie/tie/parser"
+	"github.com/angrypie/tie/template"
+	"github.com/angrypie/tie/template/modutils"
+	. "github.com/dave/jennifer/jen"
+)
+
+func NewClientModule(p *parser.Parser) template.Module {
+	return modutils.NewStandartModule("client", GenerateClient, p, nil)
+}
+
+func GenerateClient(p *parser.Parser) (pkg *template.Package) {
+	info := template.NewPackageInfoFromParser(p)
+	f := NewFile(strings.ToLower(httpModuleId))
+
+	template.TemplateClient(info, f, func(ids template.ClientMethodIds, g *Group) {
+		fn := ids.Function
+		route := GetRoute(fn)
+		if !IsSupported(fn) {
+			g.Id("_").Op("=").Id(ids.Request)
+			g.Id(ids.Err).Op("=").Qual("errors", "New").
+				Call(Lit(fmt.Sprintf("%s is not available over http", fn.Name)))
+			return
+		}
+		if stream, ok := template.GetStreamResult(fn); ok {
+			makeStreamClientCall(info, ids, stream, route, g)
+			return
+		}
+		g.Id(ids.Err).Op("=").Id(callHTTPHelper).Call(
+			ids.Context, ids.ShardKey, Lit(route), Id(ids.Request), Id(ids.Response),
+		)
+	})
+	makeClientHelpersHTTP(info, f)
+	makeStreamHelpers(info, f)
+
+	return modutils.NewPackage("client", "client.go", f.GoString())
+}
+
+//makeStreamClientCall opens event stream and feeds response channel from it. Stream is
+//closed when context of call is done or consumer stops receiving events, errors that end
+//stream are passed to OnStreamError.
+func makeStreamClientCall(
+	info *PackageInfo, ids template.ClientMethodIds,
+	stream parser.Field, route string, g *Group,
+) {
+	body, events, ctx := template.ID("body"), template.ID("events"), template.ID("streamCtx")
+
+	g.Id(ctx).Op(":=").Add(ids.Context)
+	g.Var().Id(body).Qual("io", "ReadCloser")
+	g.List(Id(body), Id(ids.Err)).Op("=").Id(openStreamHelper).Call(Id(ctx), ids.ShardKey, Lit(route), Id(ids.Request))
+	template.AddIfErrorGuard(g, nil, ids.Err, nil)
+
+	elemType := template.CreateChanElemType(stream, info)
+	g.Id(events).Op(":=").Make(Chan().Add(elemType))
+	g.Go().Func().Params().Block(
+		Defer().Close(Id(events)),
+		Defer().Id(body).Dot("Close").Call(),
+		Err().Op(":=").Id(readStreamHelper).Call(Id(body), Func().Params(Id("data").Index().Byte()).Error().Block(
+			Var().Id("event").Add(elemType),
+			If(
+				Err().Op(":=").Qual("encoding/json", "Unmarshal").Call(Id("data"), Op("&").Id("event")),
+				Err().Op("!=").Nil(),
+			).Block(Return(Err())),
+			Id("timer").Op(":=").Qual("time", "NewTimer").Call(Id(streamConsumeTimeout)),
+			Defer().Id("timer").Dot("Stop").Call(),
+			Select().Block(
+				Case(Id(events).Op("<-").Id("event")).Block(Return(Nil())),
+				Case(Op("<-").Id(ctx).Dot("Done").Call()).Block(Return(Id(ctx).Dot("Err").Call())),
+				Case(Op("<-").Id("timer").Dot("C")).Block(Return(Id(errStreamAbandoned))),
+			),
+		)),
+		//Cancelled stream is not an error
+		If(Err().Op("!=").Nil().Op("&&").Id(ctx).Dot("Err").Call().Op("==").Nil()).Block(
+			Id(OnStreamErrorHandler).Call(Lit(route), Err()),
+		),
+	).Call()
+
+	g.Id(ids.Response).Dot(strings.Title(stream.Name())).Op("=").Id(events)
+}
+
+//makeStreamHelpers creates helpers of stream reader, limits of stream are set by client
+//config (see template.StreamLimits).
+func makeStreamHelpers(info *PackageInfo, f *File) {
+	maxEventSize, consumeTimeout, _ := template.StreamLimits(info)
+	f.Comment(OnStreamErrorHandler + " is called when event stream ends with error (error event of server,")
+	f.Comment("broken connection, malformed or too large event, consumer that stops receiving events).")
+	f.Var().Id(OnStreamErrorHandler).Op("=").Func().Params(Id("route").String(), Err().Error()).Block(
+		Qual("log", "Printf").Call(Lit("stream %s: %v"), Id("route"), Err()),
+	)
+	f.Const().Defs(
+		Id(streamMaxEventSize).Op("=").Lit(maxEventSize),
+		Id(streamConsumeTimeout).Op("=").Lit(int(consumeTimeout.Milliseconds())).Op("*").Qual("time", "Millisecond"),
+	)
+	f.Var().Id(errStreamAbandoned).Op("=").Qual("errors", "New").Call(Lit("consumer stopped receiving events"))
+
+	//readStreamHelper passes data of events to handle, error event ends stream with error.
+	f.Func().Id(readStreamHelper).Params(
+		Id("body").Qual("io", "Reader"), Id("handle").Func().Params(Index().Byte()).Error(),
+	).Error().Block(
+		Id("scanner").Op(":=").Qual("bufio", "NewScanner").Call(Id("body")),
+		Id("scanner").Dot("Buffer").Call(Nil(), Id(streamMaxEventSize)),
+		Id("event").Op(":=").Lit(""),
+		For(Id("scanner").Dot("Scan").Call()).Block(
+			Id("line").Op(":=").Id("scanner").Dot("Text").Call(),
+			Switch().Block(
+				Case(Id("line").Op("==").Lit("")).Block(Id("event").Op("=").Lit("")),
+				Case(Qual("strings", "HasPrefix").Call(Id("line"), Lit("event: "))).Block(
+					Id("event").Op("=").Qual("strings", "TrimPrefix").Call(Id("line"), Lit("event: ")),
+				),
+				Case(Qual("strings", "HasPrefix").Call(Id("line"), Lit("data: "))).Block(
+					Id("data").Op(":=").Index().Byte().Parens(Qual("strings", "TrimPrefix").Call(Id("line"), Lit("data: "))),
+					If(Id("event").Op("==").Lit(sseErrorEvent)).Block(
+						Var().Id("failure").Struct(Id("Err").String().Tag(map[string]string{"json": "err"})),
+						Qual("encoding/json", "Unmarshal").Call(Id("data"), Op("&").Id("failure")),
+						Return(Qual("errors", "New").Call(Id("failure").Dot("Err"))),
+					),
+					If(Err().Op(":=").Id("handle").Call(Id("data")), Err().Op("!=").Nil()).Block(Return(Err())),
+				),
+			),
+		),
+		If(Err().Op(":=").Id("scanner").Dot("Err").Call(), Qual("errors", "Is").Call(Err(), Qual("bufio", "ErrTooLong"))).Block(
+			Return(Qual("fmt", "Errorf").Call(Lit("event is larger than %d bytes"), Id(streamMaxEventSize))),
+		),
+		Return(Id("scanner").Dot("Err").Call()),
+	)
+}
+
+//OnStreamErrorHandler is exported variable of client package that reports errors of streams.
+const OnStreamErrorHandler = "OnStreamError"
+
+const readStreamHelper = "readStreamHelper"
+const streamMaxEventSize = "streamMaxEventSize"
+const streamConsumeTimeout = "streamConsumeTimeout"
+const errStreamAbandoned = "errStreamAbandoned"
+
+const callHTTPHelper = "callHTTPHelper"
+const openStreamHelper = "openStreamHelper"
+const postHelper = "postHelper"
+
+//GetAddressEnv returns environment variable name that holds service address for clients.
+func GetAddressEnv(info *PackageInfo) string {
+	return fmt.Sprintf("TIE_%s_ADDRESS", strings.ToUpper(template.ToSnakeCase(info.Service.Alias)))
+}
+
+func makeClientHelpersHTTP(info *PackageInfo, f *File) {
+	defaultAddress := template.ClientScheme(info, "http") + "://127.0.0.1"
+	if port := template.ClientPort(info.Service, "http", "stdhttp"); port != "" {
+		defaultAddress += ":" + port
+	}
+
+	template.AddClientAddressHelper(info, f, GetAddressEnv(info), defaultAddress)
+	template.AddClientTLSHelpers(info, f)
+
+	//postHelper sends request object as JSON and returns response body on success.
+	f.Func().Id(postHelper).Params(
+		Id("ctx").Qual("context", "Context"), List(Id("key"), Id("route")).String(),
+		Id("request").Interface(), Id("accept").String(),
+	).Params(Id("body").Qual("io", "ReadCloser"), Err().Error()).Block(
+		List(Id("data"), Err()).Op(":=").Qual("encoding/json", "Marshal").Call(Id("request")),
+		If(Err().Op("!=").Nil()).Block(Return()),
+		List(Id("req"), Err()).Op(":=").Qual("net/http", "NewRequestWithContext").Call(
+			Id("ctx"), Qual("net/http", "MethodPost"), Id(template.ClientAddressHelper).Call(Id("key")).Op("+").Id("route"),
+			Qual("bytes", "NewReader").Call(Id("data")),
+		),
+		If(Err().Op("!=").Nil()).Block(Return()),
+		Id("req").Dot("Header").Dot("Set").Call(Lit("Content-Type"), Lit("application/json")),
+		Id("req").Dot("Header").Dot("Set").Call(Lit("Accept"), Id("accept")),
+		If(Id("idempotency").Op(":=").Id(template.IdempotencyKeyHelper).Call(Id("ctx")), Id("idempotency").Op("!=").Lit("")).Block(
+			Id("req").Dot("Header").Dot("Set").Call(Lit(template.IdempotencyKeyHeader), Id("idempotency")),
+		),
+		List(Id("client"), Err()).Op(":=").Id(template.HTTPClientHelper).Call(),
+		If(Err().Op("!=").Nil()).Block(Return()),
+		List(Id("resp"), Err()).Op(":=").Id("client").Dot("Do").Call(Id("req")),
+		If(Err().Op("!=").Nil()).Block(Return(Nil(), Id(template.RetryableHelper).Call(Err()))),
+		If(Id("resp").Dot("StatusCode").Op("!=").Qual("net/http", "StatusOK")).Block(
+			Defer().Id("resp").Dot("Body").Dot("Close").Call(),
+			Var().Id("failure").Struct(Id("Err").String().Tag(map[string]string{"json": "err"})),
+			Qual("encoding/json", "NewDecoder").Call(Id("resp").Dot("Body")).
+				Dot("Decode").Call(Op("&").Id("failure")),
+			If(Id("failure").Dot("Err").Op("==").Lit("")).Block(
+				Id("failure").Dot("Err").Op("=").Id("resp").Dot("Status"),
+			),
+			Err().Op("=").Qual("errors", "New").Call(Id("failure").Dot("Err")),
+			//Server failures and rejected requests can be retried
+			If(
+				Id("resp").Dot("StatusCode").Op(">=").Lit(500).Op("||").
+					Id("resp").Dot("StatusCode").Op("==").Qual("net/http", "StatusTooManyRequests"),
+			).Block(Err().Op("=").Id(template.RetryableHelper).Call(Err())),
+			Return(Nil(), Err()),
+		),
+		Return(Id("resp").Dot("Body"), Nil()),
+	)
+
+	f.Func().Id(callHTTPHelper).Params(
+		Id("ctx").Qual("context", "Context"), List(Id("key"), Id("route")).String(),
+		Id("request"), Id("response").Interface(),
+	).Error().Block(
+		List(Id("body"), Err()).Op(":=").Id(postHelper).
+			Call(Id("ctx"), Id("key"), Id("route"), Id("request"), Lit("application/json")),
+		If(Err().Op("!=").Nil()).Block(Return(Err())),
+		Defer().Id("body").Dot("Close").Call(),
+		Return(Qual("encoding/json", "NewDecoder").Call(Id("body")).Dot("Decode").Call(Id("response"))),
+	)
+
+	f.Func().Id(openStreamHelper).Params(
+		Id("ctx").Qual("context", "Context"), List(Id("key"), Id("route")).String(), Id("request").Interface(),
+	).Params(Qual("io", "ReadCloser"), Error()).Block(
+		Return(Id(postHelper).Call(Id("ctx"), Id("key"), Id("route"), Id("request"), Lit(sseContentType))),
+	)
+}
@@ -2,7 +2,7 @@ package httpmod
 
 import (
 	"fmt"
-	"regexp"
+	"log"
 	"strings"
 
 	"github.com/angrypie/tie/parser"
@@ -14,31 +14,76 @@ import (
 const echoPath = "github.com/labstack/echo/v4"
 const echoMiddleware = "github.com/labstack/echo/v4/middleware"
 const httpModuleId = "HTTP"
+const sseContentType = "text/event-stream"
+
+//sseErrorEvent is type of event that ends stream with error, data is error body.
+const sseErrorEvent = "error"
+
+//WriteErrorEvent writes error event that ends event stream to w, it is used if event
+//can't be encoded (response status is already sent).
+func WriteErrorEvent(w Code) []Code {
+	return []Code{
+		List(Id("data"), Id("_")).Op("=").Qual("encoding/json", "Marshal").Call(Id(template.ErrorBodyHelper).Call(Err())),
+		Qual("fmt", "Fprintf").Call(w, Lit("event: "+sseErrorEvent+"\ndata: %s\n\n"), Id("data")),
+		Return(Nil()),
+	}
+}
 
 type PackageInfo = template.PackageInfo
 
 func NewModule(p *parser.Parser) template.Module {
-	return modutils.NewStandartModule("httpmod", GenerateServer, p, nil)
+	var deps []template.Module
+	if p.GetPackageName() != "main" {
+		deps = append(deps, NewClientModule(p))
+	}
+	return modutils.NewStandartModule("httpmod", GenerateServer, p, deps).
+		WithValidator(validate)
+}
+
+//getDeps returns dependencies extracted from echo context.
+func getDeps() template.DepsMap {
+	deps := template.RequestDeps(Id("ctx").Dot("Response").Call(), Id("ctx").Dot("Request").Call())
+	deps[template.DepClientIP.Name] = Id("ctx").Dot("RealIP").Call()
+	return deps
 }
 
 func GenerateServer(p *parser.Parser) *template.Package {
 	info := template.NewPackageInfoFromParser(p)
 	//info.SetServicePath(info.Service.Name + "/tie_modules/httpmod/upgraded")
 	f := NewFile(strings.ToLower(httpModuleId))
+	middleware := p.GetDirectiveFunctions(MiddlewareDirective)
 
 	template.TemplateRpcServer(info, f, template.TemplateServerConfig{
 		GenResourceScope: func(g *Group, resource, instance string) {
-			makeStartHTTPServer(info, g, f, instance)
+			makeStartHTTPServer(info, g, f, instance, middleware)
 		},
 		GenHandler: makeHTTPHandler,
 	})
 
-	makeHelpersHTTP(f)
+	template.AddAuthHelpers(info, f, GetRoute)
+	template.AddLimitHelpers(info, f, GetRoute)
+	template.AddIdempotencyHelpers(info, f, GetRoute)
+	template.AddErrorBodyHelper(info, f)
+	template.AddRequestHelpers(f)
 
-	return modutils.NewPackage("httpmod", "server.go", f.GoString())
+	return template.NewPackage(info, "httpmod", "server.go", f.GoString())
+}
+
+//IsSupported returns false for functions with channel arguments (they are served by ws),
+//streaming functions are served as Server-Sent Events.
+func IsSupported(fn parser.Function) bool {
+	return !template.HasChanArgument(fn)
 }
 
 func makeHTTPHandler(info *PackageInfo, file *File, fn parser.Function) {
+	if !IsSupported(fn) {
+		log.Printf("http: skip function %s: channel arguments are served by ws\n", fn.Name)
+		return
+	}
+	if _, ok := template.GetStreamResult(fn); ok {
+		makeSSEHandler(info, file, fn)
+		return
+	}
 	_, request, response := template.GetMethodTypes(fn)
 	handlerBody := func(g *Group, resourceInstance string) {
 		//Bind request params
@@ -54,14 +99,62 @@ func makeHTTPHandler(info *PackageInfo, file *File, fn parser.Function) {
 		//Create response object
 		g.Id("response").Op(":=").New(Id(response))
 
-		deps := template.DepsMap{
-			"getEnv":    Id(template.GetEnvHelper),
-			"getHeader": Id(getHeaderHelper).Call(Id("ctx")),
+		template.MakeOriginalCall(info, fn, g, getDeps(), ifErrorReturnErrHTTP, resourceInstance)
+
+		g.Return(Id("ctx").Dot("JSON").Call(Qual("net/http", "StatusOK"), Id("response")))
+	}
+
+	template.MakeHandlerWrapper(
+		file, handlerBody, info, fn,
+		Id("ctx").Qual(echoPath, "Context"),
+		Err().Error(),
+	)
+}
+
+//makeSSEHandler creates handler that streams channel values as Server-Sent Events.
+//Stream ends when channel is closed or client disconnects.
+func makeSSEHandler(info *PackageInfo, file *File, fn parser.Function) {
+	_, request, response := template.GetMethodTypes(fn)
+	stream, _ := template.GetStreamResult(fn)
+	handlerBody := func(g *Group, resourceInstance string) {
+		g.Comment("makeSSEHandler body:").Line()
+		g.Id("request").Op(":=").New(Id(request))
+		arguments := template.CreateCombinedHandlerArgs(fn, info)
+		if len(arguments) != 0 {
+			template.AddIfErrorGuard(g, Err().Op(":=").Id("ctx").Dot("Bind").Call(Id("request")), "err", Err())
 		}
+		g.Id("response").Op(":=").New(Id(response))
 
-		template.MakeOriginalCall(info, fn, g, deps, ifErrorReturnErrHTTP, resourceInstance)
+		//Context is cancelled when client disconnects or stream ends
+		g.List(Id("streamCtx"), Id("cancel")).Op(":=").Qual("context", "WithCancel").
+			Call(Id("ctx").Dot("Request").Call().Dot("Context").Call())
+		g.Defer().Id("cancel").Call()
+		template.InjectContextArgs(g, fn, "request", Id("streamCtx"))
 
-		g.Return(Id("ctx").Dot("JSON").Call(Qual("net/http", "StatusOK"), Id("response")))
+		template.MakeOriginalCall(info, fn, g, getDeps(), ifErrorReturnErrHTTP, resourceInstance)
+
+		g.Id("w").Op(":=").Id("ctx").Dot("Response").Call()
+		g.Id("w").Dot("Header").Call().Dot("Set").Call(Qual(echoPath, "HeaderContentType"), Lit(sseContentType))
+		g.Id("w").Dot("Header").Call().Dot("Set").Call(Qual(echoPath, "HeaderCacheControl"), Lit("no-cache"))
+		g.Id("w").Dot("WriteHeader").Call(Qual("net/http", "StatusOK"))
+		g.Id("w").Dot("Flush").Call()
+
+		g.For().Block(Select().Block(
+			Case(Op("<-").Id("streamCtx").Dot("Done").Call()).Block(Return(Nil())),
+			Case(List(Id("event"), Id("ok")).Op(":=").Op("<-").
+				Id("response").Dot(strings.Title(stream.Name()))).Block(
+				If(Op("!").Id("ok")).Block(Return(Nil())),
+				List(Id("data"), Err()).Op(":=").Qual("encoding/json", "Marshal").Call(Id("event")),
+				If(Err().Op("!=").Nil()).Block(WriteErrorEvent(Id("w"))...),
+				//Client has gone, stop streaming
+				If(
+					List(Id("_"), Err()).Op(":=").Qual("fmt", "Fprintf").
+						Call(Id("w"), Lit("data: %s\n\n"), Id("data")),
+					Err().Op("!=").Nil(),
+				).Block(Return(Nil())),
+				Id("w").Dot("Flush").Call(),
+			),
+		))
 	}
 
 	template.MakeHandlerWrapper(
@@ -71,98 +164,125 @@ func makeHTTPHandler(info *PackageInfo, file *File, fn parser.Function) {
 	)
 }
 
-func makeStartHTTPServer(info *PackageInfo, g *Group, f *File, resourceInstance string) {
+func makeStartHTTPServer(
+	info *PackageInfo, g *Group, f *File, resourceInstance string, middleware []parser.DirectiveFunction,
+) {
 
 	//generate port variable initialization
-	template.MakeStartServerInit(info, g)
+	template.MakeStartServerInit(info, g, "http")
 	//Create labstack/echo server
 	g.Id("server").Op(":=").Qual(echoPath, "New").Call()
 
 	//Add handler for each function.
 	template.ForEachFunction(info, true, func(fn parser.Function) {
-		handler, _, _ := template.GetMethodTypes(fn)
-
-		route := fmt.Sprintf("/%s", fn.Name)
-		if fn.Receiver.IsDefined() {
-			route = fmt.Sprintf("/%s/%s", fn.Receiver.TypeName(), fn.Name)
+		if !IsSupported(fn) {
+			return
 		}
+		handler, _, _ := template.GetMethodTypes(fn)
 
 		g.Id("server").Dot("Any").Call(
-			Lit(toSnakeCase(route)),
+			Lit(GetRoute(fn)),
 			Id(handler).Call(Id(resourceInstance)),
 		)
 	})
 
 	//Configuration before start
-	//CORS middleware
-	g.Id("server").Dot("Use").Call(Qual(echoMiddleware, "CORSWithConfig").Call(
-		Qual(echoMiddleware, "CORSConfig").Values(Dict{
-			Id("AllowOrigins"): Index().String().Values(Lit("*")),
-		}),
-	))
-	//Gzip middleware
-	g.Id("server").Dot("Use").Call(Qual(echoMiddleware, "GzipWithConfig").Call(
-		Qual(echoMiddleware, "GzipConfig").Values(Dict{
-			Id("Level"): Lit(4),
-		}),
-	))
-
-	//Enable authentication if auth field is specified in config
+	makeConfiguredMiddleware(info, g)
+
+	//Request ID is taken from header or generated
+	g.Id("server").Dot("Use").Call(
+		Func().Params(Id("next").Qual(echoPath, "HandlerFunc")).Qual(echoPath, "HandlerFunc").Block(
+			Return(Func().Params(Id("ctx").Qual(echoPath, "Context")).Error().Block(
+				Id(template.WithRequestIDHelper).Call(Id("ctx").Dot("Response").Call(), Id("ctx").Dot("Request").Call()),
+				Return(Id("next").Call(Id("ctx"))),
+			)),
+		),
+	)
+
+	//Enable authentication if auth or authentication is specified in config
 	addAuthenticationHTTP(info, g)
-	g.Id("server").Dot("Start").Call(Id("address"))
+	addLimitsHTTP(info, g)
+	addIdempotencyHTTP(info, g)
+	makeServiceMiddleware(info, g, middleware)
+	template.MakeListenAndServe(info, g, Id("server"))
 }
 
 func ifErrorReturnErrHTTP(scope *Group, statement *Statement) {
 	ret := Id("ctx").Dot("JSON").Call(
 		Qual("net/http", "StatusBadRequest"),
-		Map(String()).String().Values(Dict{Lit("err"): Err().Dot("Error").Call()}),
+		Id(template.ErrorBodyHelper).Call(Err()),
 	)
 	template.AddIfErrorGuard(scope, statement, "err", ret)
 }
 
-const firstNotEmptyStrHelper = "firstNotEmptyStrHelper"
-const getHeaderHelper = "getHeaderHelper"
-
-func makeHelpersHTTP(f *File) {
-	f.Func().Id(firstNotEmptyStrHelper).Params(Id("a"), Id("b").String()).String().Block(
-		If(Id("a").Op("!=").Lit("")).Block(Return(Id("a"))),
-		Return(Id("b")),
+//addAuthenticationHTTP authenticates requests if auth or authentication is configured.
+func addAuthenticationHTTP(info *PackageInfo, g *Group) {
+	if !template.IsAuth(info) {
+		return
+	}
+	g.Id("server").Dot("Use").Call(
+		Func().Params(Id("next").Qual(echoPath, "HandlerFunc")).Qual(echoPath, "HandlerFunc").Block(
+			Return(Func().Params(Id("ctx").Qual(echoPath, "Context")).Error().Block(
+				List(Id("r"), Id("ok")).Op(":=").Id(template.AuthHelper).Call(
+					Id("ctx").Dot("Response").Call(), Id("ctx").Dot("Request").Call(),
+				),
+				If(Op("!").Id("ok")).Block(Return(Nil())),
+				Id("ctx").Dot("SetRequest").Call(Id("r")),
+				Return(Id("next").Call(Id("ctx"))),
+			)),
+		),
 	)
+}
 
-	f.Func().Id(getHeaderHelper).
-		Params(Id("ctx").Qual(echoPath, "Context")).
-		Func().Params(String()).String().Block(
-		Return(
-			Func().Params(Id("headerName").String()).String().Block(
-				Return(
-					Id("ctx").Dot("Request").Call().Dot("Header").Dot("Get").Call(Id("headerName")),
+//addLimitsHTTP rejects requests over rate and concurrency limits (after authentication
+//to limit requests of principal).
+func addLimitsHTTP(info *PackageInfo, g *Group) {
+	if !template.IsLimited(info) {
+		return
+	}
+	g.Id("server").Dot("Use").Call(
+		Func().Params(Id("next").Qual(echoPath, "HandlerFunc")).Qual(echoPath, "HandlerFunc").Block(
+			Return(Func().Params(Id("ctx").Qual(echoPath, "Context")).Error().Block(
+				List(Id("release"), Id("ok")).Op(":=").Id(template.LimitHelper).Call(
+					Id("ctx").Dot("Response").Call(), Id("ctx").Dot("Request").Call(),
 				),
-			),
+				If(Op("!").Id("ok")).Block(Return(Nil())),
+				Defer().Id("release").Call(),
+				Return(Id("next").Call(Id("ctx"))),
+			)),
 		),
 	)
 }
 
-func addAuthenticationHTTP(info *PackageInfo, g *Group) {
-	key := info.Service.Auth
-	if key == "" {
+//addIdempotencyHTTP replays responses of requests with idempotency key, errors of handlers
+//are written before response is stored.
+func addIdempotencyHTTP(info *PackageInfo, g *Group) {
+	if !template.UsesIdempotencyKeys(info) {
 		return
 	}
-	g.Id("server").Dot("Use").Call(Qual(echoMiddleware, "KeyAuth").Call(
-		Func().Params(Id("key").String(), Id("ctx").Qual(echoPath, "Context")).Params(Bool(), Error()).
-			BlockFunc(func(g *Group) {
-				g.Id("auth").Op(":=").Id(firstNotEmptyStrHelper).Call(
-					Id(template.GetEnvHelper).Call(Lit("TIE_API_KEY")),
-					Lit(key),
-				)
-				g.Return().List(Id("key").Op("==").Id("auth"), Nil())
-			})),
+	g.Id("server").Dot("Use").Call(
+		Func().Params(Id("next").Qual(echoPath, "HandlerFunc")).Qual(echoPath, "HandlerFunc").Block(
+			Return(Func().Params(Id("ctx").Qual(echoPath, "Context")).Error().Block(
+				List(Id("w"), Id("done"), Id("ok")).Op(":=").Id(template.IdempotencyHelper).Call(
+					Id("ctx").Dot("Response").Call().Dot("Writer"), Id("ctx").Dot("Request").Call(),
+				),
+				If(Op("!").Id("ok")).Block(Return(Nil())),
+				Defer().Id("done").Call(),
+				Id("ctx").Dot("Response").Call().Dot("Writer").Op("=").Id("w"),
+				If(Err().Op(":=").Id("next").Call(Id("ctx")), Err().Op("!=").Nil()).Block(
+					Id("ctx").Dot("Error").Call(Err()),
+				),
+				Return(Nil()),
+			)),
+		),
 	)
 }
 
-var matchAllCap = regexp.MustCompile("([a-z0-9])([A-Z])")
-
-func toSnakeCase(str string) string {
-	return strings.ToLower(
-		matchAllCap.ReplaceAllString(str, "${1}_${2}"),
-	)
+//GetRoute returns HTTP route for function (e.g. /receiver_type/method_name).
+func GetRoute(fn parser.Function) string {
+	route := fmt.Sprintf("/%s", fn.Name)
+	if fn.Receiver.IsDefined() {
+		route = fmt.Sprintf("/%s/%s", fn.Receiver.TypeName(), fn.Name)
+	}
+	return template.ToSnakeCase(route)
 }
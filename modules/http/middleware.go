@@ -0,0 +1,201 @@
+package httpmod
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/angrypie/tie/parser"
+	"github.com/angrypie/tie/template"
+	"github.com/angrypie/tie/types"
+	. "github.com/dave/jennifer/jen"
+)
+
+//MiddlewareDirective marks package function that is used as echo middleware of server:
+//func(echo.HandlerFunc) echo.HandlerFunc or func() echo.MiddlewareFunc.
+const MiddlewareDirective = "middleware"
+
+//Signatures of middleware functions.
+const (
+	middlewareSignature        = "func(" + echoPath + ".HandlerFunc) " + echoPath + ".HandlerFunc"
+	middlewareFactorySignature = "func() " + echoPath + ".MiddlewareFunc"
+)
+
+//DefaultGzipLevel is compression level of responses when it is not configured.
+const DefaultGzipLevel = 4
+
+//Config returns middleware configuration of service.
+func Config(info *PackageInfo) types.HTTP {
+	if info.Service.HTTP == nil {
+		return types.HTTP{}
+	}
+	return *info.Service.HTTP
+}
+
+//validate checks dependencies of functions, middleware configuration and middleware functions.
+func validate(p *parser.Parser) error {
+	if err := template.NewDepsValidator("http", getDeps(), IsSupported)(p); err != nil {
+		return err
+	}
+	if err := ValidateConfig(template.NewPackageInfoFromParser(p)); err != nil {
+		return err
+	}
+	for _, fn := range p.GetDirectiveFunctions(MiddlewareDirective) {
+		if fn.Signature != middlewareSignature && fn.Signature != middlewareFactorySignature {
+			return fmt.Errorf("%s: //tie:middleware must be func(echo.HandlerFunc) echo.HandlerFunc or func() echo.MiddlewareFunc", fn.Name)
+		}
+	}
+	return nil
+}
+
+//ValidateConfig checks middleware configuration of service (body limit is checked with limits).
+func ValidateConfig(info *PackageInfo) error {
+	config := Config(info)
+	if cors := config.CORS; cors != nil && cors.Credentials && !cors.Disable {
+		for _, origin := range CORSOrigins(*cors) {
+			if origin == "*" {
+				return fmt.Errorf("http.cors: credentials can't be allowed for any origin")
+			}
+		}
+	}
+	if gzip := config.Gzip; gzip != nil && (gzip.Level < 0 || gzip.Level > 9 || gzip.MinSize < 0) {
+		return fmt.Errorf("http.gzip: level must be from 1 to 9 and min_size positive")
+	}
+	if _, err := RequestTimeout(config); err != nil {
+		return fmt.Errorf("http.timeout: %w", err)
+	}
+	return nil
+}
+
+//RequestTimeout returns timeout of request, zero if it is not set.
+func RequestTimeout(config types.HTTP) (timeout time.Duration, err error) {
+	if config.Timeout == "" {
+		return
+	}
+	if timeout, err = time.ParseDuration(config.Timeout); err == nil && timeout <= 0 {
+		err = fmt.Errorf("must be positive")
+	}
+	return
+}
+
+//streamSkipper skips event stream requests (they are not compressed and not limited by timeout).
+func streamSkipper() *Statement {
+	return Func().Params(Id("ctx").Qual(echoPath, "Context")).Bool().Block(
+		Return(Id("ctx").Dot("Request").Call().Dot("Header").Dot("Get").
+			Call(Qual(echoPath, "HeaderAccept")).Op("==").Lit(sseContentType)),
+	)
+}
+
+//CORSOrigins returns allowed origins, any origin is allowed by default.
+func CORSOrigins(cors types.CORS) []string {
+	if len(cors.Origins) == 0 {
+		return []string{"*"}
+	}
+	return cors.Origins
+}
+
+//stringsCode returns code of string slice.
+func stringsCode(values []string) *Statement {
+	var list []Code
+	for _, value := range values {
+		list = append(list, Lit(value))
+	}
+	return Index().String().Values(list...)
+}
+
+//makeErrorHandler writes errors of echo and its middleware (unknown route, body limit,
+//timeout) with the same body as errors of functions.
+func makeErrorHandler(g *Group) {
+	g.Id("server").Dot("HTTPErrorHandler").Op("=").Func().Params(
+		Err().Error(), Id("ctx").Qual(echoPath, "Context"),
+	).Block(
+		If(Id("ctx").Dot("Response").Call().Dot("Committed")).Block(Return()),
+		Id("code").Op(":=").Qual("net/http", "StatusInternalServerError"),
+		Var().Id("httpErr").Op("*").Qual(echoPath, "HTTPError"),
+		If(Qual("errors", "As").Call(Err(), Op("&").Id("httpErr"))).Block(
+			List(Id("code"), Err()).Op("=").List(
+				Id("httpErr").Dot("Code"), Qual("fmt", "Errorf").Call(Lit("%v"), Id("httpErr").Dot("Message")),
+			),
+		),
+		Id("ctx").Dot("JSON").Call(Id("code"), Id(template.ErrorBodyHelper).Call(Err())),
+	)
+}
+
+//makeConfiguredMiddleware adds built-in middleware configured in http section of service.
+func makeConfiguredMiddleware(info *PackageInfo, g *Group) {
+	makeErrorHandler(g)
+	config := Config(info)
+	use := func(middleware Code) {
+		g.Id("server").Dot("Use").Call(middleware)
+	}
+	//Recover is first to catch panics of other middleware
+	if config.Recover {
+		use(Qual(echoMiddleware, "Recover").Call())
+	}
+	if config.SecureHeaders {
+		secure := Dict{
+			Id("XSSProtection"):      Lit("1; mode=block"),
+			Id("ContentTypeNosniff"): Lit("nosniff"),
+			Id("XFrameOptions"):      Lit("SAMEORIGIN"),
+		}
+		if template.IsTLS(info) {
+			secure[Id("HSTSMaxAge")] = Lit(31536000)
+		}
+		use(Qual(echoMiddleware, "SecureWithConfig").Call(Qual(echoMiddleware, "SecureConfig").Values(secure)))
+	}
+	//CORS middleware
+	if cors := config.CORS; cors == nil || !cors.Disable {
+		if cors == nil {
+			cors = &types.CORS{}
+		}
+		values := Dict{Id("AllowOrigins"): stringsCode(CORSOrigins(*cors))}
+		if len(cors.Methods) != 0 {
+			values[Id("AllowMethods")] = stringsCode(cors.Methods)
+		}
+		if len(cors.Headers) != 0 {
+			values[Id("AllowHeaders")] = stringsCode(cors.Headers)
+		}
+		if cors.Credentials {
+			values[Id("AllowCredentials")] = True()
+		}
+		if cors.MaxAge != 0 {
+			values[Id("MaxAge")] = Lit(cors.MaxAge)
+		}
+		use(Qual(echoMiddleware, "CORSWithConfig").Call(Qual(echoMiddleware, "CORSConfig").Values(values)))
+	}
+	if config.BodyLimit != "" {
+		use(Qual(echoMiddleware, "BodyLimit").Call(Lit(config.BodyLimit)))
+	}
+	//Gzip middleware (event streams are not compressed)
+	if gzip := config.Gzip; gzip == nil || !gzip.Disable {
+		if gzip == nil {
+			gzip = &types.Gzip{}
+		}
+		level := gzip.Level
+		if level == 0 {
+			level = DefaultGzipLevel
+		}
+		values := Dict{Id("Level"): Lit(level), Id("Skipper"): streamSkipper()}
+		if gzip.MinSize != 0 {
+			values[Id("MinLength")] = Lit(gzip.MinSize)
+		}
+		use(Qual(echoMiddleware, "GzipWithConfig").Call(Qual(echoMiddleware, "GzipConfig").Values(values)))
+	}
+	if timeout, _ := RequestTimeout(config); timeout != 0 {
+		use(Qual(echoMiddleware, "ContextTimeoutWithConfig").Call(Qual(echoMiddleware, "ContextTimeoutConfig").Values(Dict{
+			Id("Timeout"): Lit(int(timeout.Milliseconds())).Op("*").Qual("time", "Millisecond"),
+			Id("Skipper"): streamSkipper(),
+		})))
+	}
+}
+
+//makeServiceMiddleware adds middleware functions of service package (//tie:middleware) in order
+//of declaration, they are called after authentication.
+func makeServiceMiddleware(info *PackageInfo, g *Group, middleware []parser.DirectiveFunction) {
+	for _, fn := range middleware {
+		function := Qual(info.GetServicePath(), fn.Name)
+		if fn.Signature == middlewareFactorySignature {
+			function = function.Call()
+		}
+		g.Id("server").Dot("Use").Call(function)
+	}
+}
@@ -0,0 +1,106 @@
+package jsonrpc
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/angrypie/tie/parser"
+	"github.com/angrypie/tie/template"
+	"github.com/angrypie/tie/template/modutils"
+	. "github.com/dave/jennifer/jen"
+)
+
+func NewClientModule(p *parser.Parser) template.Module {
+	return modutils.NewStandartModule("client", GenerateClient, p, nil)
+}
+
+func GenerateClient(p *parser.Parser) (pkg *template.Package) {
+	info := template.NewPackageInfoFromParser(p)
+	f := NewFile(strings.ToLower(jsonrpcModuleId))
+
+	template.TemplateClient(info, f, func(ids template.ClientMethodIds, g *Group) {
+		fn := ids.Function
+		if !IsSupported(fn) {
+			g.Id("_").Op("=").Id(ids.Request)
+			g.Id(ids.Err).Op("=").Qual("errors", "New").
+				Call(Lit(fmt.Sprintf("%s is not available over jsonrpc", fn.Name)))
+			return
+		}
+		g.Id(ids.Err).Op("=").Id(callHelper).Call(
+			ids.Context, ids.ShardKey, Lit(GetMethodName(fn)), Id(ids.Request), Id(ids.Response),
+		)
+	})
+	makeClientHelpers(info, f)
+
+	return modutils.NewPackage("client", "client.go", f.GoString())
+}
+
+const callHelper = "callJSONRPCHelper"
+
+//GetAddressEnv returns environment variable name that holds service address for clients.
+func GetAddressEnv(info *PackageInfo) string {
+	alias := strings.ToUpper(strings.ReplaceAll(info.Service.Alias, "-", "_"))
+	return fmt.Sprintf("TIE_%s_JSONRPC_ADDRESS", alias)
+}
+
+func makeClientHelpers(info *PackageInfo, f *File) {
+	defaultAddress := template.ClientScheme(info, "http") + "://127.0.0.1"
+	if port := template.ClientPort(info.Service, "jsonrpc"); port != "" {
+		defaultAddress += ":" + port
+	}
+
+	template.AddClientAddressHelper(info, f, GetAddressEnv(info), defaultAddress)
+	template.AddClientTLSHelpers(info, f)
+
+	f.Comment("RPCError is JSON-RPC error object returned by service.")
+	f.Type().Id("RPCError").Struct(
+		Id("Code").Int().Tag(map[string]string{"json": "code"}),
+		Id("Message").String().Tag(map[string]string{"json": "message"}),
+	)
+
+	f.Func().Params(Id("e").Op("*").Id("RPCError")).Id("Error").Params().String().Block(
+		Return(Qual("fmt", "Sprintf").Call(Lit("jsonrpc error %d: %s"), Id("e").Dot("Code"), Id("e").Dot("Message"))),
+	)
+
+	f.Var().Id("requestID").Uint64()
+
+	f.Func().Id(callHelper).Params(
+		Id("ctx").Qual("context", "Context"), List(Id("key"), Id("method")).String(),
+		Id("params"), Id("result").Interface(),
+	).Error().Block(
+		List(Id("data"), Err()).Op(":=").Qual(json, "Marshal").Call(Map(String()).Interface().Values(Dict{
+			Lit("jsonrpc"): Lit("2.0"),
+			Lit("id"):      Qual("sync/atomic", "AddUint64").Call(Op("&").Id("requestID"), Lit(1)),
+			Lit("method"):  Id("method"),
+			Lit("params"):  Id("params"),
+		})),
+		If(Err().Op("!=").Nil()).Block(Return(Err())),
+		List(Id("req"), Err()).Op(":=").Qual("net/http", "NewRequestWithContext").Call(
+			Id("ctx"), Qual("net/http", "MethodPost"), Id(template.ClientAddressHelper).Call(Id("key")),
+			Qual("bytes", "NewReader").Call(Id("data")),
+		),
+		If(Err().Op("!=").Nil()).Block(Return(Err())),
+		Id("req").Dot("Header").Dot("Set").Call(Lit("Content-Type"), Lit("application/json")),
+		List(Id("client"), Err()).Op(":=").Id(template.HTTPClientHelper).Call(),
+		If(Err().Op("!=").Nil()).Block(Return(Err())),
+		List(Id("resp"), Err()).Op(":=").Id("client").Dot("Do").Call(Id("req")),
+		If(Err().Op("!=").Nil()).Block(Return(Id(template.RetryableHelper).Call(Err()))),
+		Defer().Id("resp").Dot("Body").Dot("Close").Call(),
+		If(
+			Id("resp").Dot("StatusCode").Op(">=").Lit(500).Op("||").
+				Id("resp").Dot("StatusCode").Op("==").Qual("net/http", "StatusTooManyRequests"),
+		).Block(Return(Id(template.RetryableHelper).Call(Qual("errors", "New").Call(Id("resp").Dot("Status"))))),
+
+		Var().Id("response").Struct(
+			Id("Result").Qual(json, "RawMessage").Tag(map[string]string{"json": "result"}),
+			Id("Error").Op("*").Id("RPCError").Tag(map[string]string{"json": "error"}),
+		),
+		If(
+			Err().Op(":=").Qual(json, "NewDecoder").Call(Id("resp").Dot("Body")).
+				Dot("Decode").Call(Op("&").Id("response")),
+			Err().Op("!=").Nil(),
+		).Block(Return(Err())),
+		If(Id("response").Dot("Error").Op("!=").Nil()).Block(Return(Id("response").Dot("Error"))),
+		Return(Qual(json, "Unmarshal").Call(Id("response").Dot("Result"), Id("result"))),
+	)
+}
@@ -0,0 +1,414 @@
+package jsonrpc
+
+import (
+	"log"
+	"strings"
+
+	"github.com/angrypie/tie/parser"
+	"github.com/angrypie/tie/template"
+	"github.com/angrypie/tie/template/modutils"
+	. "github.com/dave/jennifer/jen"
+)
+
+const jsonrpcModuleId = "JSONRPC"
+const json = "encoding/json"
+
+//StdioEnv is environment variable that switches server to stdio transport.
+const StdioEnv = "TIE_JSONRPC_STDIO"
+
+type PackageInfo = template.PackageInfo
+
+//NewModule creates module that exposes functions as JSON-RPC 2.0 methods.
+func NewModule(p *parser.Parser) template.Module {
+	var deps []template.Module
+	if p.GetPackageName() != "main" {
+		deps = append(deps, NewClientModule(p))
+	}
+	return modutils.NewStandartModule("jsonrpcmod", GenerateServer, p, deps).
+		WithValidator(template.NewDepsValidator("jsonrpc", Deps(), IsSupported))
+}
+
+func GenerateServer(p *parser.Parser) *template.Package {
+	info := template.NewPackageInfoFromParser(p)
+	f := NewFile(strings.ToLower(jsonrpcModuleId))
+
+	template.TemplateRpcServer(info, f, template.TemplateServerConfig{
+		GenResourceScope: func(g *Group, resource, instance string) {
+			makeStartServer(info, g, instance)
+		},
+		GenHandler: MakeHandler,
+	})
+
+	MakeRuntime(info, f)
+
+	return template.NewPackage(info, "jsonrpcmod", "server.go", f.GoString())
+}
+
+//GetMethodName returns JSON-RPC method name (Receiver.Method or Method).
+func GetMethodName(fn parser.Function) string {
+	if template.HasReceiver(fn) {
+		return fn.Receiver.TypeName() + "." + fn.Name
+	}
+	return fn.Name
+}
+
+//IsSupported returns false for functions that can't be called as JSON-RPC method
+//(streaming functions and functions with channel arguments).
+func IsSupported(fn parser.Function) bool {
+	_, isStream := template.GetStreamResult(fn)
+	return !isStream && !template.HasChanArgument(fn)
+}
+
+//Deps returns dependencies supported by method handler (see MakeHandler).
+func Deps() template.DepsMap {
+	deps := template.DefaultDeps()
+	deps[template.DepContext.Name] = Id("ctx")
+	//Headers are not part of JSON-RPC message, receivers get empty values
+	deps[template.DepGetHeader.Name] = Func().Params(String()).String().Block(Return(Lit("")))
+	deps[template.DepPrincipal.Name] = Id(template.PrincipalHelper).Call(Id("ctx"))
+	deps[template.CallAuthorization] = Id("ctx")
+	return deps
+}
+
+//RequestContext returns context of HTTP request r, calls are authenticated by its
+//Authorization header if service is authenticated (stdio calls have no credentials).
+func RequestContext(info *PackageInfo) *Statement {
+	if template.IsAuth(info) {
+		return Id(template.AuthContextHelper).Call(Id("r").Dot("Context").Call(), Id("r").Dot("Header"))
+	}
+	return Id("r").Dot("Context").Call()
+}
+
+//MakeHandler creates method handler that decodes named params to request object.
+func MakeHandler(info *PackageInfo, f *File, fn parser.Function) {
+	if !IsSupported(fn) {
+		log.Printf("jsonrpc: skip streaming function %s\n", fn.Name)
+		return
+	}
+	_, request, response := template.GetMethodTypes(fn)
+	body := func(g *Group, resourceInstance string) {
+		g.Id("request").Op(":=").New(Id(request))
+		g.If(Len(Id("params")).Op("!=").Lit(0)).Block(If(
+			Err().Op(":=").Qual(json, "Unmarshal").Call(Id("params"), Id("request")),
+			Err().Op("!=").Nil(),
+		).Block(
+			Return(Nil(), Op("&").Id(rpcErrorType).Values(Dict{
+				Id("Code"):    Id("jsonrpcInvalidParams"),
+				Id("Message"): Err().Dot("Error").Call(),
+			})),
+		))
+		template.InjectContextArgs(g, fn, "request", Id("ctx"))
+
+		g.Id("response").Op(":=").New(Id(response))
+		template.MakeOriginalCall(info, fn, g, Deps(), ifErrorReturnErrJSONRPC, resourceInstance)
+		g.Return(Id("response"), Nil())
+	}
+
+	template.MakeHandlerWrapper(f, body, info, fn,
+		List(Id("ctx").Qual("context", "Context"), Id("params").Qual(json, "RawMessage")),
+		List(Id("result").Interface(), Err().Error()),
+	)
+}
+
+func ifErrorReturnErrJSONRPC(scope *Group, statement *Statement) {
+	template.AddIfErrorGuard(scope, statement, "err", List(Nil(), Err()))
+}
+
+//MakeMethodsMap creates map of JSON-RPC method handlers.
+func MakeMethodsMap(info *PackageInfo, g *Group, resourceInstance string) {
+	g.Id("methods").Op(":=").Map(String()).Id(rpcHandlerType).Values(DictFunc(func(d Dict) {
+		template.ForEachFunction(info, true, func(fn parser.Function) {
+			if !IsSupported(fn) {
+				return
+			}
+			handler, _, _ := template.GetMethodTypes(fn)
+			d[Lit(GetMethodName(fn))] = Id(handler).Call(Id(resourceInstance))
+		})
+	}))
+}
+
+func makeStartServer(info *PackageInfo, g *Group, resourceInstance string) {
+	MakeMethodsMap(info, g, resourceInstance)
+
+	//Service is stopped when stdin is closed
+	g.If(Qual("os", "Getenv").Call(Lit(StdioEnv)).Op("!=").Lit("")).Block(
+		Err().Op("=").Id(ServeStdioHelper).Call(Id("methods")),
+		Return(),
+	)
+
+	template.MakeStartServerInit(info, g, "jsonrpc")
+	g.Id("mux").Op(":=").Qual("net/http", "NewServeMux").Call()
+	g.Id("mux").Dot("Handle").Call(Lit("/"), Id(ServeHTTPHelper).Call(Id("methods")))
+	template.MakeListenAndServe(info, g, Id("mux"))
+}
+
+const rpcHandlerType = "jsonrpcHandler"
+const rpcErrorType = "jsonrpcError"
+const rpcResponseType = "jsonrpcResponse"
+
+//HandlerType is identifier of generated method handler type.
+const HandlerType = rpcHandlerType
+
+//ServeHTTPHelper is identifier of generated function that creates JSON-RPC http.Handler.
+const ServeHTTPHelper = "serveJSONRPCHTTP"
+
+//HandleMessageHelper is identifier of generated function that handles single message or batch
+//and returns encoded reply or nil if there is nothing to reply.
+const HandleMessageHelper = "handleJSONRPCMessage"
+
+//ServeStdioHelper is identifier of generated function that serves
+//newline delimited JSON-RPC messages from stdin to stdout.
+const ServeStdioHelper = "serveJSONRPCStdio"
+
+//ReadBodyHelper is name of function that reads HTTP request body limited by http.body_limit.
+const ReadBodyHelper = "readJSONRPCBody"
+
+//MakeRuntime creates JSON-RPC 2.0 message types, dispatcher and transports.
+func MakeRuntime(info *template.PackageInfo, f *File) {
+	bodyLimit, _, _ := template.BodyLimit(info)
+	f.Const().Defs(
+		Id("jsonrpcParseError").Op("=").Lit(-32700),
+		Id("jsonrpcInvalidRequest").Op("=").Lit(-32600),
+		Id("jsonrpcMethodNotFound").Op("=").Lit(-32601),
+		Id("jsonrpcInvalidParams").Op("=").Lit(-32602),
+		Id("jsonrpcInternalError").Op("=").Lit(-32603),
+		Id("jsonrpcServerError").Op("=").Lit(-32000),
+	)
+
+	f.Const().Id("jsonrpcBodyLimit").Op("=").Lit(bodyLimit)
+
+	template.AddPrincipalHelpers(f)
+	template.AddCallAuthHelpers(info, f)
+
+	f.Type().Id(rpcHandlerType).Op("=").Func().Params(
+		Id("ctx").Qual("context", "Context"), Id("params").Qual(json, "RawMessage"),
+	).Params(Interface(), Error())
+
+	f.Type().Id("jsonrpcRequest").Struct(
+		Id("JSONRPC").String().Tag(map[string]string{"json": "jsonrpc"}),
+		Id("ID").Qual(json, "RawMessage").Tag(map[string]string{"json": "id"}),
+		Id("Method").String().Tag(map[string]string{"json": "method"}),
+		Id("Params").Qual(json, "RawMessage").Tag(map[string]string{"json": "params"}),
+	)
+
+	f.Type().Id(rpcResponseType).Struct(
+		Id("JSONRPC").String().Tag(map[string]string{"json": "jsonrpc"}),
+		Id("ID").Qual(json, "RawMessage").Tag(map[string]string{"json": "id"}),
+		Id("Result").Interface().Tag(map[string]string{"json": "result,omitempty"}),
+		Id("Error").Op("*").Id(rpcErrorType).Tag(map[string]string{"json": "error,omitempty"}),
+	)
+
+	f.Type().Id(rpcErrorType).Struct(
+		Id("Code").Int().Tag(map[string]string{"json": "code"}),
+		Id("Message").String().Tag(map[string]string{"json": "message"}),
+		Id("Data").Interface().Tag(map[string]string{"json": "data,omitempty"}),
+	)
+
+	f.Func().Params(Id("e").Op("*").Id(rpcErrorType)).Id("Error").Params().String().Block(
+		Return(Id("e").Dot("Message")),
+	)
+
+	f.Func().Id("newJSONRPCError").Params(
+		Id("id").Qual(json, "RawMessage"), Id("code").Int(), Id("message").String(),
+	).Op("*").Id(rpcResponseType).Block(
+		If(Len(Id("id")).Op("==").Lit(0)).Block(
+			Id("id").Op("=").Qual(json, "RawMessage").Parens(Lit("null")),
+		),
+		Return(Op("&").Id(rpcResponseType).Values(Dict{
+			Id("JSONRPC"): Lit("2.0"),
+			Id("ID"):      Id("id"),
+			Id("Error"):   Op("&").Id(rpcErrorType).Values(Dict{Id("Code"): Id("code"), Id("Message"): Id("message")}),
+		})),
+	)
+
+	//callJSONRPCHandler calls method handler and converts errors to error objects.
+	f.Func().Id("callJSONRPCHandler").Params(
+		Id("ctx").Qual("context", "Context"), Id("handler").Id(rpcHandlerType),
+		Id("request").Id("jsonrpcRequest"),
+	).Params(Id("response").Op("*").Id(rpcResponseType)).Block(
+		Defer().Func().Params().Block(
+			If(Id("r").Op(":=").Recover(), Id("r").Op("!=").Nil()).Block(
+				Id("response").Op("=").Id("newJSONRPCError").Call(
+					Id("request").Dot("ID"), Id("jsonrpcInternalError"), Qual("fmt", "Sprint").Call(Id("r")),
+				),
+			),
+		).Call(),
+		List(Id("result"), Err()).Op(":=").Id("handler").Call(Id("ctx"), Id("request").Dot("Params")),
+		If(Err().Op("!=").Nil()).Block(
+			If(
+				List(Id("rpcErr"), Id("ok")).Op(":=").Err().Assert(Op("*").Id(rpcErrorType)),
+				Id("ok"),
+			).Block(
+				Return(Op("&").Id(rpcResponseType).Values(Dict{
+					Id("JSONRPC"): Lit("2.0"),
+					Id("ID"):      Id("request").Dot("ID"),
+					Id("Error"):   Id("rpcErr"),
+				})),
+			),
+			//Invalid fields of request are returned as error data
+			If(
+				List(Id("invalid"), Id("ok")).Op(":=").Err().Assert(Interface(Id("InvalidParams").Params().Interface())),
+				Id("ok"),
+			).Block(
+				Id("response").Op("=").Id("newJSONRPCError").Call(
+					Id("request").Dot("ID"), Id("jsonrpcInvalidParams"), Err().Dot("Error").Call(),
+				),
+				Id("response").Dot("Error").Dot("Data").Op("=").Id("invalid").Dot("InvalidParams").Call(),
+				Return(Id("response")),
+			),
+			Return(Id("newJSONRPCError").Call(
+				Id("request").Dot("ID"), Id("jsonrpcServerError"), Err().Dot("Error").Call(),
+			)),
+		),
+		Return(Op("&").Id(rpcResponseType).Values(Dict{
+			Id("JSONRPC"): Lit("2.0"),
+			Id("ID"):      Id("request").Dot("ID"),
+			Id("Result"):  Id("result"),
+		})),
+	)
+
+	//handleJSONRPCRequest returns nil response for notifications.
+	f.Func().Id("handleJSONRPCRequest").Params(
+		Id("ctx").Qual("context", "Context"), Id("methods").Map(String()).Id(rpcHandlerType),
+		Id("data").Qual(json, "RawMessage"),
+	).Op("*").Id(rpcResponseType).Block(
+		Var().Id("request").Id("jsonrpcRequest"),
+		If(
+			Err().Op(":=").Qual(json, "Unmarshal").Call(Id("data"), Op("&").Id("request")),
+			Err().Op("!=").Nil(),
+		).Block(
+			If(Op("!").Qual(json, "Valid").Call(Id("data"))).Block(
+				Return(Id("newJSONRPCError").Call(Nil(), Id("jsonrpcParseError"), Lit("Parse error"))),
+			),
+			Return(Id("newJSONRPCError").Call(Nil(), Id("jsonrpcInvalidRequest"), Lit("Invalid Request"))),
+		),
+		If(Id("request").Dot("JSONRPC").Op("!=").Lit("2.0").Op("||").Id("request").Dot("Method").Op("==").Lit("")).Block(
+			Return(Id("newJSONRPCError").Call(
+				Id("request").Dot("ID"), Id("jsonrpcInvalidRequest"), Lit("Invalid Request"),
+			)),
+		),
+
+		Var().Id("response").Op("*").Id(rpcResponseType),
+		If(
+			List(Id("handler"), Id("ok")).Op(":=").Id("methods").Index(Id("request").Dot("Method")),
+			Id("ok"),
+		).Block(
+			Id("response").Op("=").Id("callJSONRPCHandler").Call(Id("ctx"), Id("handler"), Id("request")),
+		).Else().Block(
+			Id("response").Op("=").Id("newJSONRPCError").Call(
+				Id("request").Dot("ID"), Id("jsonrpcMethodNotFound"), Lit("Method not found"),
+			),
+		),
+		//Request without id is notification, server must not reply
+		If(Len(Id("request").Dot("ID")).Op("==").Lit(0)).Block(Return(Nil())),
+		Return(Id("response")),
+	)
+
+	f.Func().Id(HandleMessageHelper).Params(
+		Id("ctx").Qual("context", "Context"), Id("methods").Map(String()).Id(rpcHandlerType),
+		Id("data").Index().Byte(),
+	).Index().Byte().Block(
+		Id("data").Op("=").Qual("bytes", "TrimSpace").Call(Id("data")),
+		Var().Id("reply").Interface(),
+		If(Len(Id("data")).Op(">").Lit(0).Op("&&").Id("data").Index(Lit(0)).Op("==").LitRune('[')).Block(
+			Var().Id("batch").Index().Qual(json, "RawMessage"),
+			If(
+				Err().Op(":=").Qual(json, "Unmarshal").Call(Id("data"), Op("&").Id("batch")),
+				Err().Op("!=").Nil(),
+			).Block(
+				Id("reply").Op("=").Id("newJSONRPCError").Call(Nil(), Id("jsonrpcParseError"), Lit("Parse error")),
+			).Else().If(Len(Id("batch")).Op("==").Lit(0)).Block(
+				Id("reply").Op("=").Id("newJSONRPCError").Call(Nil(), Id("jsonrpcInvalidRequest"), Lit("Invalid Request")),
+			).Else().Block(
+				Var().Id("responses").Index().Op("*").Id(rpcResponseType),
+				For(List(Id("_"), Id("item")).Op(":=").Range().Id("batch")).Block(
+					If(
+						Id("response").Op(":=").Id("handleJSONRPCRequest").Call(Id("ctx"), Id("methods"), Id("item")),
+						Id("response").Op("!=").Nil(),
+					).Block(
+						Id("responses").Op("=").Append(Id("responses"), Id("response")),
+					),
+				),
+				If(Len(Id("responses")).Op("==").Lit(0)).Block(Return(Nil())),
+				Id("reply").Op("=").Id("responses"),
+			),
+		).Else().Block(
+			Id("response").Op(":=").Id("handleJSONRPCRequest").Call(Id("ctx"), Id("methods"), Id("data")),
+			If(Id("response").Op("==").Nil()).Block(Return(Nil())),
+			Id("reply").Op("=").Id("response"),
+		),
+		List(Id("out"), Err()).Op(":=").Qual(json, "Marshal").Call(Id("reply")),
+		If(Err().Op("!=").Nil()).Block(
+			List(Id("out"), Id("_")).Op("=").Qual(json, "Marshal").Call(
+				Id("newJSONRPCError").Call(Nil(), Id("jsonrpcInternalError"), Err().Dot("Error").Call()),
+			),
+		),
+		Return(Id("out")),
+	)
+
+	methodsParam := Id("methods").Map(String()).Id(rpcHandlerType)
+
+	f.Func().Id(ReadBodyHelper).Params(
+		Id("w").Qual("net/http", "ResponseWriter"), Id("r").Op("*").Qual("net/http", "Request"),
+	).Params(Index().Byte(), Bool()).Block(
+		List(Id("data"), Err()).Op(":=").Qual("io/ioutil", "ReadAll").Call(
+			Qual("net/http", "MaxBytesReader").Call(Id("w"), Id("r").Dot("Body"), Id("jsonrpcBodyLimit")),
+		),
+		Var().Id("tooLarge").Op("*").Qual("net/http", "MaxBytesError"),
+		If(Qual("errors", "As").Call(Err(), Op("&").Id("tooLarge"))).Block(
+			List(Id("out"), Id("_")).Op(":=").Qual(json, "Marshal").Call(
+				Id("newJSONRPCError").Call(Nil(), Id("jsonrpcInvalidRequest"), Err().Dot("Error").Call()),
+			),
+			Id("w").Dot("Header").Call().Dot("Set").Call(Lit("Content-Type"), Lit("application/json")),
+			Id("w").Dot("WriteHeader").Call(Qual("net/http", "StatusRequestEntityTooLarge")),
+			Id("w").Dot("Write").Call(Id("out")),
+			Return(Nil(), False()),
+		),
+		If(Err().Op("!=").Nil()).Block(
+			Qual("net/http", "Error").Call(Id("w"), Err().Dot("Error").Call(), Qual("net/http", "StatusBadRequest")),
+			Return(Nil(), False()),
+		),
+		Return(Id("data"), True()),
+	)
+
+	f.Func().Id(ServeHTTPHelper).Params(methodsParam.Clone()).Qual("net/http", "HandlerFunc").Block(
+		Return(Func().Params(
+			Id("w").Qual("net/http", "ResponseWriter"), Id("r").Op("*").Qual("net/http", "Request"),
+		).Block(
+			If(Id("r").Dot("Method").Op("!=").Qual("net/http", "MethodPost")).Block(
+				Qual("net/http", "Error").Call(
+					Id("w"), Lit("method not allowed"), Qual("net/http", "StatusMethodNotAllowed"),
+				),
+				Return(),
+			),
+			List(Id("data"), Id("ok")).Op(":=").Id(ReadBodyHelper).Call(Id("w"), Id("r")),
+			If(Op("!").Id("ok")).Block(Return()),
+			Id("out").Op(":=").Id(HandleMessageHelper).Call(RequestContext(info), Id("methods"), Id("data")),
+			If(Id("out").Op("==").Nil()).Block(
+				Id("w").Dot("WriteHeader").Call(Qual("net/http", "StatusNoContent")),
+				Return(),
+			),
+			Id("w").Dot("Header").Call().Dot("Set").Call(Lit("Content-Type"), Lit("application/json")),
+			Id("w").Dot("Write").Call(Id("out")),
+		)),
+	)
+
+	f.Func().Id(ServeStdioHelper).Params(methodsParam.Clone()).Error().Block(
+		Id("scanner").Op(":=").Qual("bufio", "NewScanner").Call(Qual("os", "Stdin")),
+		Id("scanner").Dot("Buffer").Call(Make(Index().Byte(), Lit(64*1024)), Lit(16<<20)),
+		For(Id("scanner").Dot("Scan").Call()).Block(
+			Id("line").Op(":=").Id("scanner").Dot("Bytes").Call(),
+			If(Len(Qual("bytes", "TrimSpace").Call(Id("line"))).Op("==").Lit(0)).Block(Continue()),
+			Id("out").Op(":=").Id(HandleMessageHelper).Call(
+				Qual("context", "Background").Call(), Id("methods"), Id("line"),
+			),
+			If(Id("out").Op("==").Nil()).Block(Continue()),
+			If(
+				List(Id("_"), Err()).Op(":=").Qual("os", "Stdout").Dot("Write").
+					Call(Append(Id("out"), LitRune('\n'))),
+				Err().Op("!=").Nil(),
+			).Block(Return(Err())),
+		),
+		Return(Id("scanner").Dot("Err").Call()),
+	)
+}
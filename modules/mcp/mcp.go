@@ -0,0 +1,264 @@
+package mcp
+
+import (
+	encjson "encoding/json"
+	"log"
+	"strings"
+
+	httpmod "github.com/angrypie/tie/modules/http"
+	"github.com/angrypie/tie/modules/jsonrpc"
+	"github.com/angrypie/tie/parser"
+	"github.com/angrypie/tie/template"
+	"github.com/angrypie/tie/template/modutils"
+	. "github.com/dave/jennifer/jen"
+)
+
+const mcpModuleId = "MCP"
+const json = "encoding/json"
+const nethttp = "net/http"
+
+//StdioEnv is environment variable that switches server to stdio transport.
+const StdioEnv = "TIE_MCP_STDIO"
+
+//Endpoint is path of streamable HTTP transport endpoint.
+const Endpoint = "/mcp"
+
+//ProtocolVersion is latest supported MCP protocol revision.
+const ProtocolVersion = "2025-06-18"
+
+//protocolVersions are revisions server can negotiate with client.
+var protocolVersions = []string{"2024-11-05", "2025-03-26", ProtocolVersion}
+
+type PackageInfo = template.PackageInfo
+
+//NewModule creates module that exposes functions as Model Context Protocol tools.
+func NewModule(p *parser.Parser) template.Module {
+	return modutils.NewStandartModule("mcpmod", GenerateServer, p, nil).
+		WithValidator(template.NewDepsValidator("mcp", jsonrpc.Deps(), jsonrpc.IsSupported))
+}
+
+func GenerateServer(p *parser.Parser) *template.Package {
+	info := template.NewPackageInfoFromParser(p)
+	f := NewFile(strings.ToLower(mcpModuleId))
+
+	template.TemplateRpcServer(info, f, template.TemplateServerConfig{
+		GenResourceScope: func(g *Group, resource, instance string) {
+			makeStartServer(info, g, instance)
+		},
+		GenHandler: jsonrpc.MakeHandler,
+	})
+
+	jsonrpc.MakeRuntime(info, f)
+	makeTools(info, f)
+	makeRuntime(info, f)
+
+	return template.NewPackage(info, "mcpmod", "server.go", f.GoString())
+}
+
+//GetToolName returns tool name (e.g. receiver_type_method_name).
+func GetToolName(fn parser.Function) string {
+	route := strings.TrimPrefix(httpmod.GetRoute(fn), "/")
+	return strings.ReplaceAll(route, "/", "_")
+}
+
+func makeStartServer(info *PackageInfo, g *Group, resourceInstance string) {
+	g.Id("tools").Op(":=").Map(String()).Id(jsonrpc.HandlerType).Values(DictFunc(func(d Dict) {
+		template.ForEachFunction(info, true, func(fn parser.Function) {
+			if !jsonrpc.IsSupported(fn) {
+				return
+			}
+			handler, _, _ := template.GetMethodTypes(fn)
+			d[Lit(GetToolName(fn))] = Id(handler).Call(Id(resourceInstance))
+		})
+	}))
+	g.Id("methods").Op(":=").Id(newMethodsHelper).Call(Id("tools"))
+
+	//Service is stopped when stdin is closed
+	g.If(Qual("os", "Getenv").Call(Lit(StdioEnv)).Op("!=").Lit("")).Block(
+		Err().Op("=").Id(jsonrpc.ServeStdioHelper).Call(Id("methods")),
+		Return(),
+	)
+
+	template.MakeStartServerInit(info, g, "mcp")
+	g.Id("mux").Op(":=").Qual(nethttp, "NewServeMux").Call()
+	g.Id("mux").Dot("Handle").Call(Lit(Endpoint), Id(serveHTTPHelper).Call(Id("methods")))
+	template.MakeListenAndServe(info, g, Id("mux"))
+}
+
+//makeTools creates list of tool descriptions. Schemas are derived from
+//argument and result types at generation time.
+func makeTools(info *PackageInfo, f *File) {
+	f.Type().Id("mcpTool").Struct(
+		Id("Name").String().Tag(map[string]string{"json": "name"}),
+		Id("Description").String().Tag(map[string]string{"json": "description,omitempty"}),
+		Id("InputSchema").Qual(json, "RawMessage").Tag(map[string]string{"json": "inputSchema"}),
+		Id("OutputSchema").Qual(json, "RawMessage").Tag(map[string]string{"json": "outputSchema,omitempty"}),
+	)
+
+	schemaLit := func(schema parser.Schema) Code {
+		data, err := encjson.Marshal(schema)
+		if err != nil {
+			log.Printf("mcp: can't encode schema: %s\n", err)
+			data = []byte(`{"type":"object"}`)
+		}
+		return Qual(json, "RawMessage").Call(Lit(string(data)))
+	}
+
+	f.Var().Id("mcpTools").Op("=").Index().Id("mcpTool").ValuesFunc(func(g *Group) {
+		template.ForEachFunction(info, true, func(fn parser.Function) {
+			if !jsonrpc.IsSupported(fn) {
+				return
+			}
+			g.Values(Dict{
+				Id("Name"):         Lit(GetToolName(fn)),
+				Id("Description"):  Lit(fn.Doc),
+				Id("InputSchema"):  schemaLit(template.RequestSchema(fn, info)),
+				Id("OutputSchema"): schemaLit(template.ResponseSchema(fn, info)),
+			})
+		})
+	})
+}
+
+const newMethodsHelper = "newMCPMethods"
+const serveHTTPHelper = "serveMCPHTTP"
+
+//makeRuntime creates MCP methods on top of JSON-RPC dispatcher and streamable HTTP transport.
+func makeRuntime(info *PackageInfo, f *File) {
+	handler := func(body ...Code) *Statement {
+		return Func().Params(
+			Id("ctx").Qual("context", "Context"), Id("params").Qual(json, "RawMessage"),
+		).Params(Interface(), Error()).Block(body...)
+	}
+
+	f.Type().Id("mcpContent").Struct(
+		Id("Type").String().Tag(map[string]string{"json": "type"}),
+		Id("Text").String().Tag(map[string]string{"json": "text"}),
+	)
+
+	f.Type().Id("mcpToolResult").Struct(
+		Id("Content").Index().Id("mcpContent").Tag(map[string]string{"json": "content"}),
+		Id("StructuredContent").Interface().Tag(map[string]string{"json": "structuredContent,omitempty"}),
+		Id("IsError").Bool().Tag(map[string]string{"json": "isError"}),
+	)
+
+	f.Func().Id(newMethodsHelper).Params(
+		Id("tools").Map(String()).Id(jsonrpc.HandlerType),
+	).Map(String()).Id(jsonrpc.HandlerType).Block(
+		Return(Map(String()).Id(jsonrpc.HandlerType).Values(Dict{
+			//Server picks requested protocol version if supported, latest otherwise
+			Lit("initialize"): handler(
+				Var().Id("request").Struct(
+					Id("ProtocolVersion").String().Tag(map[string]string{"json": "protocolVersion"}),
+				),
+				Qual(json, "Unmarshal").Call(Id("params"), Op("&").Id("request")),
+				Id("version").Op(":=").Lit(ProtocolVersion),
+				For(List(Id("_"), Id("supported")).Op(":=").Range().Index().String().ValuesFunc(func(g *Group) {
+					for _, version := range protocolVersions {
+						g.Lit(version)
+					}
+				})).Block(
+					If(Id("supported").Op("==").Id("request").Dot("ProtocolVersion")).Block(
+						Id("version").Op("=").Id("supported"),
+					),
+				),
+				Return(Map(String()).Interface().Values(Dict{
+					Lit("protocolVersion"): Id("version"),
+					Lit("capabilities"): Map(String()).Interface().Values(Dict{
+						Lit("tools"): Map(String()).Interface().Values(),
+					}),
+					Lit("serverInfo"): Map(String()).String().Values(Dict{
+						Lit("name"):    Lit(info.Service.Alias),
+						Lit("version"): Lit("1.0.0"),
+					}),
+				}), Nil()),
+			),
+			Lit("ping"): handler(
+				Return(Struct().Values(), Nil()),
+			),
+			Lit("tools/list"): handler(
+				Return(Map(String()).Interface().Values(Dict{Lit("tools"): Id("mcpTools")}), Nil()),
+			),
+			//Errors of tool call are reported in result, so model can see them
+			Lit("tools/call"): handler(
+				Var().Id("request").Struct(
+					Id("Name").String().Tag(map[string]string{"json": "name"}),
+					Id("Arguments").Qual(json, "RawMessage").Tag(map[string]string{"json": "arguments"}),
+				),
+				If(
+					Err().Op(":=").Qual(json, "Unmarshal").Call(Id("params"), Op("&").Id("request")),
+					Err().Op("!=").Nil(),
+				).Block(
+					Return(Nil(), Op("&").Id("jsonrpcError").Values(Dict{
+						Id("Code"): Id("jsonrpcInvalidParams"), Id("Message"): Err().Dot("Error").Call(),
+					})),
+				),
+				List(Id("tool"), Id("ok")).Op(":=").Id("tools").Index(Id("request").Dot("Name")),
+				If(Op("!").Id("ok")).Block(
+					Return(Nil(), Op("&").Id("jsonrpcError").Values(Dict{
+						Id("Code"):    Id("jsonrpcInvalidParams"),
+						Id("Message"): Lit("Unknown tool: ").Op("+").Id("request").Dot("Name"),
+					})),
+				),
+				List(Id("result"), Err()).Op(":=").Id("tool").Call(Id("ctx"), Id("request").Dot("Arguments")),
+				If(Err().Op("!=").Nil()).Block(
+					Return(Op("&").Id("mcpToolResult").Values(Dict{
+						Id("Content"): Index().Id("mcpContent").Values(Values(Lit("text"), Err().Dot("Error").Call())),
+						Id("IsError"): True(),
+					}), Nil()),
+				),
+				List(Id("data"), Err()).Op(":=").Qual(json, "Marshal").Call(Id("result")),
+				If(Err().Op("!=").Nil()).Block(Return(Nil(), Err())),
+				Return(Op("&").Id("mcpToolResult").Values(Dict{
+					Id("Content"):           Index().Id("mcpContent").Values(Values(Lit("text"), String().Parens(Id("data")))),
+					Id("StructuredContent"): Id("result"),
+				}), Nil()),
+			),
+		})),
+	)
+
+	//serveMCPHTTP implements streamable HTTP transport without server-initiated streams:
+	//each POST gets JSON reply, notifications and responses are accepted with 202.
+	//Origin is validated to prevent DNS rebinding attacks.
+	f.Func().Id(serveHTTPHelper).Params(
+		Id("methods").Map(String()).Id(jsonrpc.HandlerType),
+	).Qual(nethttp, "HandlerFunc").Block(
+		Return(Func().Params(
+			Id("w").Qual(nethttp, "ResponseWriter"), Id("r").Op("*").Qual(nethttp, "Request"),
+		).Block(
+			If(
+				Id("origin").Op(":=").Id("r").Dot("Header").Dot("Get").Call(Lit("Origin")),
+				Id("origin").Op("!=").Lit(""),
+			).Block(
+				List(Id("u"), Err()).Op(":=").Qual("net/url", "Parse").Call(Id("origin")),
+				Id("local").Op(":=").Err().Op("==").Nil().Op("&&").Parens(
+					Id("u").Dot("Host").Op("==").Id("r").Dot("Host").
+						Op("||").Id("u").Dot("Hostname").Call().Op("==").Lit("localhost").
+						Op("||").Id("u").Dot("Hostname").Call().Op("==").Lit("127.0.0.1").
+						Op("||").Id("u").Dot("Hostname").Call().Op("==").Lit("::1"),
+				),
+				If(Op("!").Id("local")).Block(
+					Qual(nethttp, "Error").Call(Id("w"), Lit("forbidden origin"), Qual(nethttp, "StatusForbidden")),
+					Return(),
+				),
+			),
+			If(Id("r").Dot("Method").Op("!=").Qual(nethttp, "MethodPost")).Block(
+				Id("w").Dot("Header").Call().Dot("Set").Call(Lit("Allow"), Qual(nethttp, "MethodPost")),
+				Qual(nethttp, "Error").Call(
+					Id("w"), Lit("method not allowed"), Qual(nethttp, "StatusMethodNotAllowed"),
+				),
+				Return(),
+			),
+			List(Id("data"), Id("ok")).Op(":=").Id(jsonrpc.ReadBodyHelper).Call(Id("w"), Id("r")),
+			If(Op("!").Id("ok")).Block(Return()),
+			Id("out").Op(":=").Id(jsonrpc.HandleMessageHelper).Call(
+				jsonrpc.RequestContext(info), Id("methods"), Id("data"),
+			),
+			If(Id("out").Op("==").Nil()).Block(
+				Id("w").Dot("WriteHeader").Call(Qual(nethttp, "StatusAccepted")),
+				Return(),
+			),
+			Id("w").Dot("Header").Call().Dot("Set").Call(Lit("Content-Type"), Lit("application/json")),
+			Id("w").Dot("Write").Call(Id("out")),
+		)),
+	)
+}
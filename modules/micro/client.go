@@ -16,19 +16,55 @@ func NewClientModule(p *parser.Parser) template.Module {
 
 func GenerateClient(p *parser.Parser) (pkg *template.Package) {
 	info := template.NewPackageInfoFromParser(p)
-	//TODO all modules needs to create upgraded subpackage to make ServicePath reusable,
-	info.SetServicePath(info.Service.Name + "/tie_modules/micromod/upgraded")
 	f := NewFile(strings.ToLower(microModuleId))
 
 	template.TemplateClient(info, f, func(ids template.ClientMethodIds, g *Group) {
 		f.Comment("go-micro specific call").Line()
-		g.Id(ids.Err).Op("=").Qual(microUtils, "NewClient").
-			Call().Dot("Call").Call(
-			Lit(ids.Resource),
-			Lit(fmt.Sprintf("%s.%s", ids.Resource, ids.Method)),
-			Id(ids.Request), Id(ids.Response),
+		endpoint := Lit(fmt.Sprintf("%s.%s", ids.Resource, ids.Method))
+		g.Var().Id("client").Qual(gomicroClient, "Client")
+		g.If(List(Id("client"), Id(ids.Err)).Op("=").Id(microClientHelper).Call(), Id(ids.Err).Op("==").Nil()).Block(
+			//Errors of function can't be told from errors of transport
+			Id(ids.Err).Op("=").Id(template.RetryableHelper).Call(Id("client").Dot("Call").Call(
+				ids.Context,
+				Id("client").Dot("NewRequest").Call(Lit(ids.Resource), endpoint, Id(ids.Request)),
+				Id(ids.Response),
+			)),
 		)
 	})
+	makeClientHelper(info, f)
 
 	return modutils.NewPackage("client", "client.go", f.GoString())
 }
+
+const microClientHelper = "microClientHelper"
+
+//makeClientHelper creates helper that returns go-micro client (it is created once and
+//reused by calls), client uses TLS transport if service uses TLS.
+func makeClientHelper(info *PackageInfo, f *File) {
+	if !template.IsTLS(info) {
+		f.Var().Id("microClient").Op("=").Qual(gomicroClient, "NewClient").Call()
+		f.Func().Id(microClientHelper).Params().Params(Qual(gomicroClient, "Client"), Error()).Block(
+			Return(Id("microClient"), Nil()),
+		)
+		return
+	}
+	template.AddClientTLSHelpers(info, f)
+	f.Var().Id("microClient").Struct(
+		Qual("sync", "Once"),
+		Id("client").Qual(gomicroClient, "Client"),
+		Err().Error(),
+	)
+	f.Func().Id(microClientHelper).Params().Params(Qual(gomicroClient, "Client"), Error()).Block(
+		Id("microClient").Dot("Do").Call(Func().Params().Block(
+			List(Id("config"), Err()).Op(":=").Id(template.ClientTLSHelper).Call(),
+			If(Err().Op("!=").Nil()).Block(
+				Id("microClient").Dot("err").Op("=").Err(),
+				Return(),
+			),
+			Id("microClient").Dot("client").Op("=").Qual(gomicroClient, "NewClient").Call(
+				Qual(gomicroClient, "Transport").Call(secureTransport(Id("config"))),
+			),
+		)),
+		Return(Id("microClient").Dot("client"), Id("microClient").Dot("err")),
+	)
+}
@@ -12,8 +12,9 @@ import (
 
 const gomicro = "github.com/micro/go-micro/v2"
 const gomicroClient = "github.com/micro/go-micro/v2/client"
+const gomicroTransport = "github.com/micro/go-micro/v2/transport"
+const gomicroMetadata = "github.com/micro/go-micro/v2/metadata"
 const microModuleId = "GoMicro"
-const microUtils = "github.com/angrypie/tie-modules/micro/microutils"
 
 type PackageInfo = template.PackageInfo
 
@@ -27,7 +28,8 @@ func NewModule(p *parser.Parser, services []string) template.Module {
 		NewUpgradedModule(p, services),
 		protobuf.NewModule(p),
 	}
-	return modutils.NewStandartModule("micromod", GenerateServer, p, deps)
+	return modutils.NewStandartModule("micromod", GenerateServer, p, deps).
+		WithValidator(template.NewDepsValidator("micro", template.RpcDeps(), nil))
 }
 
 func NewUpgradedModule(p *parser.Parser, services []string) template.Module {
@@ -54,20 +56,98 @@ func GenerateUpgraded(p *parser.Parser, services []string) (pkg *template.Packag
 
 func GenerateServer(p *parser.Parser) *template.Package {
 	info := template.NewPackageInfoFromParser(p)
-	info.SetServicePath(info.Service.Name + "/tie_modules/micromod/upgraded")
 	f := NewFile(strings.ToLower(microModuleId))
 
 	template.TemplateRpcServer(info, f, template.TemplateServerConfig{
 		GenResourceScope: func(g *Group, resource, instance string) {
-			g.Id("service").Op(":=").Qual(gomicro, "NewService").Call(
+			//Service is stopped by shutdown (cancel) instead of its own signal handler
+			g.List(Id("ctx"), Id("cancel")).Op(":=").Qual("context", "WithCancel").Call(Qual("context", "Background").Call())
+			options := []Code{
 				Qual(gomicro, "Name").Call(Lit(resource)),
-			)
+				Qual(gomicro, "Context").Call(Id("ctx")),
+				Qual(gomicro, "HandleSignal").Call(False()),
+				//Service is ready when its server is started
+				Qual(gomicro, "AfterStart").Call(Func().Params().Error().BlockFunc(func(g *Group) {
+					template.MakeReady(info, g)
+					g.Return(Nil())
+				})),
+			}
+			if template.IsTLS(info) {
+				g.List(Id("tlsConfig"), Err()).Op(":=").Add(template.Lifecycle(info, template.TLSConfigHelper)).Call()
+				template.AddIfErrorGuard(g, nil, "err", Err())
+				options = append(options, Qual(gomicro, "Transport").Call(secureTransport(Id("tlsConfig"))))
+			}
+			g.Id("service").Op(":=").Qual(gomicro, "NewService").Call(options...)
 			g.Id("service").Dot("Init").Call()
 
+			g.Id("stopped").Op(":=").Make(Chan().Struct())
+			template.MakeAddServerHook(info, g,
+				Func().Params(Id("ctx").Qual("context", "Context")).Error().Block(
+					Id("cancel").Call(),
+					Select().Block(
+						Case(Op("<-").Id("stopped")).Block(Return(Nil())),
+						Case(Op("<-").Id("ctx").Dot("Done").Call()).Block(Return(Id("ctx").Dot("Err").Call())),
+					),
+				),
+			)
 			g.Qual(gomicro, "RegisterHandler").Call(Id("service").Dot("Server").Call(), Op("&").Id(instance))
-			g.Id("service").Dot("Run").Call()
+			g.Qual(gomicro, "RegisterHandler").Call(Id("service").Dot("Server").Call(), Op("&").Id(healthHandler).Values())
+			g.Err().Op("=").Id("service").Dot("Run").Call()
+			g.Close(Id("stopped"))
 		},
 	})
 
-	return modutils.NewPackage("micromod", "server.go", f.GoString())
+	makeHealthHandler(info, f)
+	makeAuthHeaderHelper(info, f)
+
+	return template.NewPackage(info, "micromod", "server.go", f.GoString())
+}
+
+//makeAuthHeaderHelper creates helpers that authenticate calls by Authorization metadata.
+func makeAuthHeaderHelper(info *PackageInfo, f *File) {
+	template.AddPrincipalHelpers(f)
+	if !template.IsAuth(info) {
+		return
+	}
+	template.AddCallAuthHelpers(info, f)
+	f.Func().Id(template.AuthHeaderHelper).Params(Id("ctx").Qual("context", "Context")).Qual("net/http", "Header").Block(
+		Id("header").Op(":=").Qual("net/http", "Header").Values(),
+		If(
+			List(Id("value"), Id("ok")).Op(":=").Qual(gomicroMetadata, "Get").Call(Id("ctx"), Lit("Authorization")),
+			Id("ok"),
+		).Block(Id("header").Dot("Set").Call(Lit("Authorization"), Id("value"))),
+		Return(Id("header")),
+	)
+}
+
+//secureTransport returns go-micro transport that uses TLS configuration.
+func secureTransport(config Code) *Statement {
+	return Qual(gomicroTransport, "NewTransport").Call(
+		Qual(gomicroTransport, "Secure").Call(True()),
+		Qual(gomicroTransport, "TLSConfig").Call(config),
+	)
+}
+
+const healthHandler = "TieHealth"
+
+//makeHealthHandler creates TieHealth service with Live and Ready methods.
+func makeHealthHandler(info *template.PackageInfo, f *File) {
+	f.Type().Id("HealthRequest").Struct()
+	f.Type().Id("HealthResponse").Struct(Id("Status").String().Tag(map[string]string{"json": "status"}))
+	f.Type().Id(healthHandler).Struct()
+
+	params := List(
+		Id("ctx").Qual("context", "Context"),
+		Id("request").Op("*").Id("HealthRequest"),
+		Id("response").Op("*").Id("HealthResponse"),
+	)
+	f.Func().Params(Id("h").Op("*").Id(healthHandler)).Id("Live").Params(params).Error().Block(
+		Id("response").Dot("Status").Op("=").Lit("ok"),
+		Return(Nil()),
+	)
+	f.Func().Params(Id("h").Op("*").Id(healthHandler)).Id("Ready").Params(params).Error().Block(
+		If(Err().Op(":=").Add(template.Lifecycle(info, template.HealthReadyHelper)).Call(), Err().Op("!=").Nil()).Block(Return(Err())),
+		Id("response").Dot("Status").Op("=").Lit("ok"),
+		Return(Nil()),
+	)
 }
@@ -0,0 +1,326 @@
+package stdhttp
+
+import (
+	"fmt"
+	"strings"
+
+	httpmod "github.com/angrypie/tie/modules/http"
+	"github.com/angrypie/tie/parser"
+	"github.com/angrypie/tie/template"
+	"github.com/angrypie/tie/types"
+	. "github.com/dave/jennifer/jen"
+)
+
+const corsMiddleware = "corsMiddleware"
+const gzipMiddleware = "gzipMiddleware"
+const keyAuthMiddleware = "keyAuthMiddleware"
+const requestIDMiddleware = "requestIDMiddleware"
+const limitMiddleware = "limitMiddleware"
+const idempotencyMiddleware = "idempotencyMiddleware"
+const recoverMiddleware = "recoverMiddleware"
+const secureHeadersMiddleware = "secureHeadersMiddleware"
+const bodyLimitMiddleware = "bodyLimitMiddleware"
+const timeoutMiddleware = "timeoutMiddleware"
+const gzipWriter = "gzipResponseWriter"
+
+//middlewareFunc declares function that wraps next handler with body.
+func middlewareFunc(name string, body ...Code) *Statement {
+	return Func().Id(name).Params(Id("next").Qual(nethttp, "Handler")).Qual(nethttp, "Handler").Block(
+		Return(Qual(nethttp, "HandlerFunc").Call(Func().Params(getHandlerArgs()).Block(body...))),
+	)
+}
+
+//makeCORSMiddleware creates middleware that allows origins matching patterns (e.g. https://*.example.com)
+//and answers preflight requests like echo CORS middleware.
+func makeCORSMiddleware(f *File, cors types.CORS) {
+	var origins []Code
+	for _, origin := range httpmod.CORSOrigins(cors) {
+		origins = append(origins, Lit(origin))
+	}
+	f.Var().Id("corsOrigins").Op("=").Index().String().Values(origins...)
+
+	methods := "GET,HEAD,PUT,PATCH,POST,DELETE"
+	if len(cors.Methods) != 0 {
+		methods = strings.Join(cors.Methods, ",")
+	}
+	next := Id("next").Dot("ServeHTTP").Call(Id("w"), Id("r"))
+	body := []Code{
+		Id("origin").Op(":=").Id("r").Dot("Header").Dot("Get").Call(Lit("Origin")),
+		If(Id("origin").Op("==").Lit("")).Block(next, Return()),
+		Id("w").Dot("Header").Call().Dot("Add").Call(Lit("Vary"), Lit("Origin")),
+		Id("allowed").Op(":=").Lit(""),
+		For(List(Id("_"), Id("pattern")).Op(":=").Range().Id("corsOrigins")).Block(
+			If(Id("pattern").Op("==").Lit("*")).Block(Id("allowed").Op("=").Id("pattern"), Break()),
+			If(
+				List(Id("matched"), Id("_")).Op(":=").Qual("path", "Match").Call(Id("pattern"), Id("origin")),
+				Id("matched"),
+			).Block(Id("allowed").Op("=").Id("origin"), Break()),
+		),
+		//Preflight request of origin that is not allowed is answered without CORS headers
+		If(Id("allowed").Op("==").Lit("")).Block(
+			If(Id("r").Dot("Method").Op("==").Qual(nethttp, "MethodOptions")).Block(
+				Id("w").Dot("WriteHeader").Call(Qual(nethttp, "StatusNoContent")),
+				Return(),
+			),
+			next,
+			Return(),
+		),
+		setHeader("Access-Control-Allow-Origin", Id("allowed")),
+	}
+	if cors.Credentials {
+		body = append(body, setHeader("Access-Control-Allow-Credentials", Lit("true")))
+	}
+	body = append(body,
+		If(Id("r").Dot("Method").Op("!=").Qual(nethttp, "MethodOptions")).Block(next, Return()),
+		setHeader("Access-Control-Allow-Methods", Lit(methods)),
+	)
+	if len(cors.Headers) != 0 {
+		body = append(body, setHeader("Access-Control-Allow-Headers", Lit(strings.Join(cors.Headers, ","))))
+	} else {
+		body = append(body, If(
+			Id("headers").Op(":=").Id("r").Dot("Header").Dot("Get").Call(Lit("Access-Control-Request-Headers")),
+			Id("headers").Op("!=").Lit(""),
+		).Block(setHeader("Access-Control-Allow-Headers", Id("headers"))))
+	}
+	if cors.MaxAge != 0 {
+		body = append(body, setHeader("Access-Control-Max-Age", Lit(fmt.Sprint(cors.MaxAge))))
+	}
+	body = append(body, Id("w").Dot("WriteHeader").Call(Qual(nethttp, "StatusNoContent")))
+	f.Add(middlewareFunc(corsMiddleware, body...))
+}
+
+//makeGzipMiddleware creates gzip middleware, responses smaller than min size are not compressed
+//(event streams are not compressed if request accepts them, otherwise they are flushed with each event).
+func makeGzipMiddleware(f *File, gzip types.Gzip) {
+	level := gzip.Level
+	if level == 0 {
+		level = httpmod.DefaultGzipLevel
+	}
+	f.Const().Defs(
+		Id("gzipLevel").Op("=").Lit(level),
+		Id("gzipMinSize").Op("=").Lit(gzip.MinSize),
+	)
+
+	//Response is buffered with its status until it reaches min size
+	f.Type().Id(gzipWriter).Struct(
+		Qual(nethttp, "ResponseWriter"),
+		Id("writer").Op("*").Qual("compress/gzip", "Writer"),
+		Id("buffer").Index().Byte(),
+		Id("code").Int(),
+	)
+	receiver := func() *Statement {
+		return Func().Params(Id("w").Op("*").Id(gzipWriter))
+	}
+	writeHeader := If(Id("w").Dot("code").Op("!=").Lit(0)).Block(
+		Id("w").Dot("ResponseWriter").Dot("WriteHeader").Call(Id("w").Dot("code")),
+	)
+
+	f.Add(receiver()).Id("WriteHeader").Params(Id("code").Int()).Block(
+		If(Id("w").Dot("code").Op("==").Lit(0)).Block(Id("w").Dot("code").Op("=").Id("code")),
+	)
+
+	f.Add(receiver()).Id("Write").Params(Id("data").Index().Byte()).Params(Int(), Error()).Block(
+		If(Id("w").Dot("writer").Op("!=").Nil()).Block(
+			Return(Id("w").Dot("writer").Dot("Write").Call(Id("data"))),
+		),
+		Id("w").Dot("buffer").Op("=").Append(Id("w").Dot("buffer"), Id("data").Op("...")),
+		If(Len(Id("w").Dot("buffer")).Op(">=").Id("gzipMinSize")).Block(
+			If(Err().Op(":=").Id("w").Dot("compress").Call(), Err().Op("!=").Nil()).Block(
+				Return(Lit(0), Err()),
+			),
+		),
+		Return(Len(Id("data")), Nil()),
+	)
+
+	//Flush writes compressed data to client, so streams are not buffered
+	f.Add(receiver()).Id("Flush").Params().Block(
+		If(Id("w").Dot("writer").Op("==").Nil()).Block(Id("w").Dot("compress").Call()),
+		Id("w").Dot("writer").Dot("Flush").Call(),
+		If(
+			List(Id("flusher"), Id("ok")).Op(":=").Id("w").Dot("ResponseWriter").Assert(Qual(nethttp, "Flusher")),
+			Id("ok"),
+		).Block(Id("flusher").Dot("Flush").Call()),
+	)
+
+	f.Add(receiver()).Id("compress").Params().Error().Block(
+		Id("w").Dot("Header").Call().Dot("Set").Call(Lit("Content-Encoding"), Lit("gzip")),
+		Id("w").Dot("Header").Call().Dot("Add").Call(Lit("Vary"), Lit("Accept-Encoding")),
+		Id("w").Dot("Header").Call().Dot("Del").Call(Lit("Content-Length")),
+		writeHeader,
+		List(Id("w").Dot("writer"), Id("_")).Op("=").Qual("compress/gzip", "NewWriterLevel").
+			Call(Id("w").Dot("ResponseWriter"), Id("gzipLevel")),
+		List(Id("_"), Err()).Op(":=").Id("w").Dot("writer").Dot("Write").Call(Id("w").Dot("buffer")),
+		Id("w").Dot("buffer").Op("=").Nil(),
+		Return(Err()),
+	)
+
+	//Response smaller than min size is written without compression
+	f.Add(receiver()).Id("close").Params().Block(
+		If(Id("w").Dot("writer").Op("!=").Nil()).Block(
+			Id("w").Dot("writer").Dot("Close").Call(),
+			Return(),
+		),
+		writeHeader,
+		Id("w").Dot("ResponseWriter").Dot("Write").Call(Id("w").Dot("buffer")),
+	)
+
+	f.Add(middlewareFunc(gzipMiddleware,
+		If(
+			Op("!").Qual("strings", "Contains").Call(
+				Id("r").Dot("Header").Dot("Get").Call(Lit("Accept-Encoding")), Lit("gzip"),
+			).Op("||").Add(isStream()),
+		).Block(
+			Id("next").Dot("ServeHTTP").Call(Id("w"), Id("r")),
+			Return(),
+		),
+		Id("writer").Op(":=").Op("&").Id(gzipWriter).Values(Dict{Id("ResponseWriter"): Id("w")}),
+		Defer().Id("writer").Dot("close").Call(),
+		Id("next").Dot("ServeHTTP").Call(Id("writer"), Id("r")),
+	))
+}
+
+//validate checks dependencies of functions and middleware configuration of http section,
+//middleware functions (//tie:middleware) are echo handlers, so they are served only by http module.
+func validate(p *parser.Parser) error {
+	if err := template.NewDepsValidator("stdhttp", getDeps(), httpmod.IsSupported)(p); err != nil {
+		return err
+	}
+	if err := httpmod.ValidateConfig(template.NewPackageInfoFromParser(p)); err != nil {
+		return err
+	}
+	if middleware := p.GetDirectiveFunctions(httpmod.MiddlewareDirective); len(middleware) != 0 {
+		return fmt.Errorf("%s: //tie:middleware is echo middleware, it is not supported by stdhttp", middleware[0].Name)
+	}
+	return nil
+}
+
+//setHeader sets header of response.
+func setHeader(name string, value Code) *Statement {
+	return Id("w").Dot("Header").Call().Dot("Set").Call(Lit(name), value)
+}
+
+//isStream checks if request accepts event stream (streams are not compressed and not limited by timeout).
+func isStream() *Statement {
+	return Id("r").Dot("Header").Dot("Get").Call(Lit("Accept")).Op("==").Lit(sseContentType)
+}
+
+func makeMiddlewares(info *PackageInfo, f *File) {
+	config := httpmod.Config(info)
+	next := Id("next").Dot("ServeHTTP").Call(Id("w"), Id("r"))
+
+	//Recover middleware responds with 500 instead of crashing process.
+	if config.Recover {
+		f.Add(middlewareFunc(recoverMiddleware,
+			Defer().Func().Params().Block(
+				If(Id("value").Op(":=").Recover(), Id("value").Op("!=").Nil()).Block(
+					If(Id("value").Op("==").Qual(nethttp, "ErrAbortHandler")).Block(Panic(Id("value"))),
+					Id(writeJSONHelper).Call(
+						Id("w"), Qual(nethttp, "StatusInternalServerError"),
+						Id(template.ErrorBodyHelper).Call(Qual("fmt", "Errorf").Call(Lit("%v"), Id("value"))),
+					),
+				),
+			).Call(),
+			next,
+		))
+	}
+
+	//Secure headers middleware adds XSS protection, nosniff, frame options and HSTS (with TLS).
+	if config.SecureHeaders {
+		headers := []Code{
+			setHeader("X-XSS-Protection", Lit("1; mode=block")),
+			setHeader("X-Content-Type-Options", Lit("nosniff")),
+			setHeader("X-Frame-Options", Lit("SAMEORIGIN")),
+		}
+		if template.IsTLS(info) {
+			headers = append(headers, If(
+				Id("r").Dot("TLS").Op("!=").Nil().Op("||").
+					Id("r").Dot("Header").Dot("Get").Call(Lit("X-Forwarded-Proto")).Op("==").Lit("https"),
+			).Block(setHeader("Strict-Transport-Security", Lit("max-age=31536000; includeSubdomains"))))
+		}
+		f.Add(middlewareFunc(secureHeadersMiddleware, append(headers, next)...))
+	}
+
+	//CORS middleware allows configured origins (any by default) and answers preflight requests.
+	if cors := config.CORS; cors == nil || !cors.Disable {
+		if cors == nil {
+			cors = &types.CORS{}
+		}
+		makeCORSMiddleware(f, *cors)
+	}
+
+	//Body limit middleware rejects requests larger than limit with 413.
+	if limit, ok, _ := template.BodyLimit(info); ok {
+		f.Const().Id("bodyLimit").Op("=").Lit(limit)
+		f.Add(middlewareFunc(bodyLimitMiddleware,
+			If(Id("r").Dot("ContentLength").Op(">").Id("bodyLimit")).Block(
+				Id(writeJSONHelper).Call(
+					Id("w"), Qual(nethttp, "StatusRequestEntityTooLarge"),
+					Id(template.ErrorBodyHelper).Call(Qual("errors", "New").Call(
+						Qual(nethttp, "StatusText").Call(Qual(nethttp, "StatusRequestEntityTooLarge")),
+					)),
+				),
+				Return(),
+			),
+			Id("r").Dot("Body").Op("=").Qual(nethttp, "MaxBytesReader").Call(Id("w"), Id("r").Dot("Body"), Id("bodyLimit")),
+			next,
+		))
+	}
+
+	if gzip := config.Gzip; gzip == nil || !gzip.Disable {
+		if gzip == nil {
+			gzip = &types.Gzip{}
+		}
+		makeGzipMiddleware(f, *gzip)
+	}
+
+	//Timeout middleware cancels context of request (event streams are not limited).
+	if timeout, _ := httpmod.RequestTimeout(config); timeout != 0 {
+		f.Add(middlewareFunc(timeoutMiddleware,
+			If(isStream()).Block(next, Return()),
+			List(Id("ctx"), Id("cancel")).Op(":=").Qual("context", "WithTimeout").Call(
+				Id("r").Dot("Context").Call(), Lit(int(timeout.Milliseconds())).Op("*").Qual("time", "Millisecond"),
+			),
+			Defer().Id("cancel").Call(),
+			Id("next").Dot("ServeHTTP").Call(Id("w"), Id("r").Dot("WithContext").Call(Id("ctx"))),
+		))
+	}
+
+	//Request ID middleware takes ID from header or generates new one.
+	f.Add(middlewareFunc(requestIDMiddleware,
+		Id(template.WithRequestIDHelper).Call(Id("w"), Id("r")),
+		Id("next").Dot("ServeHTTP").Call(Id("w"), Id("r")),
+	))
+
+	//Limit middleware rejects requests over rate and concurrency limits of route.
+	if template.IsLimited(info) {
+		template.AddLimitHelpers(info, f, httpmod.GetRoute)
+		f.Add(middlewareFunc(limitMiddleware,
+			List(Id("release"), Id("ok")).Op(":=").Id(template.LimitHelper).Call(Id("w"), Id("r")),
+			If(Op("!").Id("ok")).Block(Return()),
+			Defer().Id("release").Call(),
+			Id("next").Dot("ServeHTTP").Call(Id("w"), Id("r")),
+		))
+	}
+
+	//Idempotency middleware replays responses of requests with idempotency key.
+	if template.UsesIdempotencyKeys(info) {
+		template.AddIdempotencyHelpers(info, f, httpmod.GetRoute)
+		f.Add(middlewareFunc(idempotencyMiddleware,
+			List(Id("w"), Id("done"), Id("ok")).Op(":=").Id(template.IdempotencyHelper).Call(Id("w"), Id("r")),
+			If(Op("!").Id("ok")).Block(Return()),
+			Defer().Id("done").Call(),
+			Id("next").Dot("ServeHTTP").Call(Id("w"), Id("r")),
+		))
+	}
+
+	if !template.IsAuth(info) {
+		return
+	}
+
+	//Auth middleware authenticates and authorizes request and passes principal to handlers.
+	template.AddAuthHelpers(info, f, httpmod.GetRoute)
+	f.Add(middlewareFunc(keyAuthMiddleware,
+		List(Id("r"), Id("ok")).Op(":=").Id(template.AuthHelper).Call(Id("w"), Id("r")),
+		If(Id("ok")).Block(Id("next").Dot("ServeHTTP").Call(Id("w"), Id("r"))),
+	))
+}
@@ -0,0 +1,281 @@
+package stdhttp
+
+import (
+	"log"
+	"strings"
+
+	httpmod "github.com/angrypie/tie/modules/http"
+	"github.com/angrypie/tie/parser"
+	"github.com/angrypie/tie/template"
+	"github.com/angrypie/tie/template/modutils"
+	. "github.com/dave/jennifer/jen"
+)
+
+const nethttp = "net/http"
+const json = "encoding/json"
+const stdhttpModuleId = "STDHTTP"
+const sseContentType = "text/event-stream"
+
+type PackageInfo = template.PackageInfo
+
+//NewModule creates module that generates HTTP API server on top of net/http
+//without third-party dependencies. Routes and requests match http module,
+//so http module client is reused.
+func NewModule(p *parser.Parser) template.Module {
+	var deps []template.Module
+	if p.GetPackageName() != "main" {
+		deps = append(deps, httpmod.NewClientModule(p))
+	}
+	return modutils.NewStandartModule("stdhttpmod", GenerateServer, p, deps).
+		WithValidator(validate)
+}
+
+func GenerateServer(p *parser.Parser) *template.Package {
+	info := template.NewPackageInfoFromParser(p)
+	f := NewFile(strings.ToLower(stdhttpModuleId))
+
+	template.TemplateRpcServer(info, f, template.TemplateServerConfig{
+		GenResourceScope: func(g *Group, resource, instance string) {
+			makeStartServer(info, g, instance)
+		},
+		GenHandler: makeHandler,
+	})
+
+	makeHelpers(f)
+	template.AddErrorBodyHelper(info, f)
+	template.AddRequestHelpers(f)
+	makeMiddlewares(info, f)
+
+	return template.NewPackage(info, "stdhttpmod", "server.go", f.GoString())
+}
+
+func getDeps() template.DepsMap {
+	return template.RequestDeps(Id("w"), Id("r"))
+}
+
+func makeHandler(info *PackageInfo, f *File, fn parser.Function) {
+	if !httpmod.IsSupported(fn) {
+		log.Printf("stdhttp: skip function %s: channel arguments are served by ws\n", fn.Name)
+		return
+	}
+	if _, ok := template.GetStreamResult(fn); ok {
+		makeSSEHandler(info, f, fn)
+		return
+	}
+	_, request, response := template.GetMethodTypes(fn)
+	body := func(g *Group, resourceInstance string) {
+		g.Comment("makeHandler body:").Line()
+		arguments := template.CreateCombinedHandlerArgs(fn, info)
+		if len(arguments) != 0 {
+			g.Id("request").Op(":=").New(Id(request))
+			template.AddIfErrorGuard(g, Err().Op(":=").Id(bindHelper).Call(Id("r"), Id("request")), "err", Err())
+			template.InjectContextArgs(g, fn, "request", Id("r").Dot("Context").Call())
+		}
+
+		g.Id("response").Op(":=").New(Id(response))
+		template.MakeOriginalCall(info, fn, g, getDeps(), ifErrorReturnErr, resourceInstance)
+		g.Return(Id(writeJSONHelper).Call(Id("w"), Qual(nethttp, "StatusOK"), Id("response")))
+	}
+
+	template.MakeHandlerWrapper(f, body, info, fn, getHandlerArgs(), Err().Error())
+}
+
+//makeSSEHandler creates handler that streams channel values as Server-Sent Events.
+func makeSSEHandler(info *PackageInfo, f *File, fn parser.Function) {
+	_, request, response := template.GetMethodTypes(fn)
+	stream, _ := template.GetStreamResult(fn)
+	body := func(g *Group, resourceInstance string) {
+		g.Comment("makeSSEHandler body:").Line()
+		g.Id("request").Op(":=").New(Id(request))
+		arguments := template.CreateCombinedHandlerArgs(fn, info)
+		if len(arguments) != 0 {
+			template.AddIfErrorGuard(g, Err().Op(":=").Id(bindHelper).Call(Id("r"), Id("request")), "err", Err())
+		}
+		g.Id("response").Op(":=").New(Id(response))
+
+		//Context is cancelled when client disconnects or stream ends
+		g.List(Id("streamCtx"), Id("cancel")).Op(":=").Qual("context", "WithCancel").
+			Call(Id("r").Dot("Context").Call())
+		g.Defer().Id("cancel").Call()
+		template.InjectContextArgs(g, fn, "request", Id("streamCtx"))
+
+		template.MakeOriginalCall(info, fn, g, getDeps(), ifErrorReturnErr, resourceInstance)
+
+		g.List(Id("flusher"), Id("_")).Op(":=").Id("w").Assert(Qual(nethttp, "Flusher"))
+		g.Id("w").Dot("Header").Call().Dot("Set").Call(Lit("Content-Type"), Lit(sseContentType))
+		g.Id("w").Dot("Header").Call().Dot("Set").Call(Lit("Cache-Control"), Lit("no-cache"))
+		g.Id("w").Dot("WriteHeader").Call(Qual(nethttp, "StatusOK"))
+		flush := If(Id("flusher").Op("!=").Nil()).Block(Id("flusher").Dot("Flush").Call())
+		g.Add(flush)
+
+		g.For().Block(Select().Block(
+			Case(Op("<-").Id("streamCtx").Dot("Done").Call()).Block(Return(Nil())),
+			Case(List(Id("event"), Id("ok")).Op(":=").Op("<-").
+				Id("response").Dot(strings.Title(stream.Name()))).Block(
+				If(Op("!").Id("ok")).Block(Return(Nil())),
+				List(Id("data"), Err()).Op(":=").Qual(json, "Marshal").Call(Id("event")),
+				If(Err().Op("!=").Nil()).Block(httpmod.WriteErrorEvent(Id("w"))...),
+				//Client has gone, stop streaming
+				If(
+					List(Id("_"), Err()).Op(":=").Qual("fmt", "Fprintf").
+						Call(Id("w"), Lit("data: %s\n\n"), Id("data")),
+					Err().Op("!=").Nil(),
+				).Block(Return(Nil())),
+				flush,
+			),
+		))
+	}
+
+	template.MakeHandlerWrapper(f, body, info, fn, getHandlerArgs(), Err().Error())
+}
+
+func getHandlerArgs() *Statement {
+	return List(
+		Id("w").Qual(nethttp, "ResponseWriter"),
+		Id("r").Op("*").Qual(nethttp, "Request"),
+	)
+}
+
+func ifErrorReturnErr(scope *Group, statement *Statement) {
+	ret := Id(writeJSONHelper).Call(
+		Id("w"), Qual(nethttp, "StatusBadRequest"),
+		Id(template.ErrorBodyHelper).Call(Err()),
+	)
+	template.AddIfErrorGuard(scope, statement, "err", ret)
+}
+
+func makeStartServer(info *PackageInfo, g *Group, resourceInstance string) {
+	template.MakeStartServerInit(info, g, "stdhttp")
+	g.Id("mux").Op(":=").Qual(nethttp, "NewServeMux").Call()
+
+	//Add handler for each function with any method (like echo), GET binds query, POST binds body.
+	template.ForEachFunction(info, true, func(fn parser.Function) {
+		if !httpmod.IsSupported(fn) {
+			return
+		}
+		handler, _, _ := template.GetMethodTypes(fn)
+		g.Id("mux").Dot("Handle").Call(
+			Lit(httpmod.GetRoute(fn)),
+			Id(handleHelper).Call(Id(handler).Call(Id(resourceInstance))),
+		)
+	})
+
+	//Middlewares are applied in reverse order, recover is the outermost one.
+	g.Var().Id("handler").Qual(nethttp, "Handler").Op("=").Id("mux")
+	if template.UsesIdempotencyKeys(info) {
+		g.Id("handler").Op("=").Id(idempotencyMiddleware).Call(Id("handler"))
+	}
+	if template.IsLimited(info) {
+		g.Id("handler").Op("=").Id(limitMiddleware).Call(Id("handler"))
+	}
+	if template.IsAuth(info) {
+		g.Id("handler").Op("=").Id(keyAuthMiddleware).Call(Id("handler"))
+	}
+	g.Id("handler").Op("=").Id(requestIDMiddleware).Call(Id("handler"))
+	//Configured middleware wraps others in the same order as in http module
+	config := httpmod.Config(info)
+	if timeout, _ := httpmod.RequestTimeout(config); timeout != 0 {
+		g.Id("handler").Op("=").Id(timeoutMiddleware).Call(Id("handler"))
+	}
+	if gzip := config.Gzip; gzip == nil || !gzip.Disable {
+		g.Id("handler").Op("=").Id(gzipMiddleware).Call(Id("handler"))
+	}
+	if _, ok, _ := template.BodyLimit(info); ok {
+		g.Id("handler").Op("=").Id(bodyLimitMiddleware).Call(Id("handler"))
+	}
+	if cors := config.CORS; cors == nil || !cors.Disable {
+		g.Id("handler").Op("=").Id(corsMiddleware).Call(Id("handler"))
+	}
+	if config.SecureHeaders {
+		g.Id("handler").Op("=").Id(secureHeadersMiddleware).Call(Id("handler"))
+	}
+	if config.Recover {
+		g.Id("handler").Op("=").Id(recoverMiddleware).Call(Id("handler"))
+	}
+
+	template.MakeListenAndServe(info, g, Id("handler"))
+}
+
+const handleHelper = "handleHelper"
+const bindHelper = "bindHelper"
+const writeJSONHelper = "writeJSONHelper"
+
+func makeHelpers(f *File) {
+	handlerFunc := Func().Params(Qual(nethttp, "ResponseWriter"), Op("*").Qual(nethttp, "Request")).Error()
+
+	//handleHelper converts handler error to JSON response (413 if body is larger than body limit).
+	f.Func().Id(handleHelper).Params(Id("handler").Add(handlerFunc)).Qual(nethttp, "HandlerFunc").Block(
+		Return(Func().Params(getHandlerArgs()).Block(
+			Err().Op(":=").Id("handler").Call(Id("w"), Id("r")),
+			If(Err().Op("==").Nil()).Block(Return()),
+			Id("code").Op(":=").Qual(nethttp, "StatusInternalServerError"),
+			Var().Id("tooLarge").Op("*").Qual(nethttp, "MaxBytesError"),
+			If(Qual("errors", "As").Call(Err(), Op("&").Id("tooLarge"))).Block(
+				Id("code").Op("=").Qual(nethttp, "StatusRequestEntityTooLarge"),
+				Err().Op("=").Qual("errors", "New").Call(Qual(nethttp, "StatusText").Call(Id("code"))),
+			),
+			Id(writeJSONHelper).Call(Id("w"), Id("code"), Id(template.ErrorBodyHelper).Call(Err())),
+		)),
+	)
+
+	f.Func().Id(writeJSONHelper).Params(
+		Id("w").Qual(nethttp, "ResponseWriter"), Id("code").Int(), Id("value").Interface(),
+	).Error().Block(
+		Id("w").Dot("Header").Call().Dot("Set").Call(Lit("Content-Type"), Lit("application/json")),
+		Id("w").Dot("WriteHeader").Call(Id("code")),
+		Return(Qual(json, "NewEncoder").Call(Id("w")).Dot("Encode").Call(Id("value"))),
+	)
+
+	//bindHelper binds query parameters for GET, DELETE and HEAD requests and JSON body (like echo).
+	//Query values of string fields are taken as is, other values are decoded as JSON if possible.
+	f.Func().Id(bindHelper).Params(
+		Id("r").Op("*").Qual(nethttp, "Request"), Id("request").Interface(),
+	).Error().Block(
+		Switch(Id("r").Dot("Method")).Block(Case(
+			Qual(nethttp, "MethodGet"), Qual(nethttp, "MethodDelete"), Qual(nethttp, "MethodHead"),
+		).Block(
+			Id("kinds").Op(":=").Make(Map(String()).Qual("reflect", "Kind")),
+			Id("t").Op(":=").Qual("reflect", "TypeOf").Call(Id("request")).Dot("Elem").Call(),
+			For(Id("i").Op(":=").Lit(0), Id("i").Op("<").Id("t").Dot("NumField").Call(), Id("i").Op("++")).Block(
+				Id("field").Op(":=").Id("t").Dot("Field").Call(Id("i")),
+				Id("name").Op(":=").Qual("strings", "Split").Call(
+					Id("field").Dot("Tag").Dot("Get").Call(Lit("json")), Lit(","),
+				).Index(Lit(0)),
+				If(Id("name").Op("==").Lit("")).Block(Id("name").Op("=").Id("field").Dot("Name")),
+				Id("elem").Op(":=").Id("field").Dot("Type"),
+				For(
+					Id("elem").Dot("Kind").Call().Op("==").Qual("reflect", "Ptr").Op("||").
+						Id("elem").Dot("Kind").Call().Op("==").Qual("reflect", "Slice"),
+				).Block(Id("elem").Op("=").Id("elem").Dot("Elem").Call()),
+				Id("kinds").Index(Qual("strings", "ToLower").Call(Id("name"))).Op("=").Id("elem").Dot("Kind").Call(),
+			),
+			Id("values").Op(":=").Make(Map(String()).Interface()),
+			For(List(Id("key"), Id("list")).Op(":=").Range().Id("r").Dot("URL").Dot("Query").Call()).Block(
+				Id("isString").Op(":=").Id("kinds").Index(Qual("strings", "ToLower").Call(Id("key"))).
+					Op("==").Qual("reflect", "String"),
+				Id("decoded").Op(":=").Make(Index().Interface(), Len(Id("list"))),
+				For(List(Id("i"), Id("raw")).Op(":=").Range().Id("list")).Block(
+					If(
+						Id("isString").Op("||").Qual(json, "Unmarshal").Call(
+							Index().Byte().Parens(Id("raw")), Op("&").Id("decoded").Index(Id("i")),
+						).Op("!=").Nil(),
+					).Block(
+						Id("decoded").Index(Id("i")).Op("=").Id("raw"),
+					),
+				),
+				Id("values").Index(Id("key")).Op("=").Id("decoded"),
+				If(Len(Id("decoded")).Op("==").Lit(1)).Block(
+					Id("values").Index(Id("key")).Op("=").Id("decoded").Index(Lit(0)),
+				),
+			),
+			List(Id("data"), Err()).Op(":=").Qual(json, "Marshal").Call(Id("values")),
+			If(Err().Op("!=").Nil()).Block(Return(Err())),
+			If(Err().Op(":=").Qual(json, "Unmarshal").Call(Id("data"), Id("request")), Err().Op("!=").Nil()).Block(
+				Return(Err()),
+			),
+		)),
+		Err().Op(":=").Qual(json, "NewDecoder").Call(Id("r").Dot("Body")).Dot("Decode").Call(Id("request")),
+		If(Err().Op("==").Qual("io", "EOF")).Block(Return(Nil())),
+		Return(Err()),
+	)
+}
@@ -0,0 +1,129 @@
+package wsmod
+
+import (
+	"fmt"
+	"strings"
+
+	httpmod "github.com/angrypie/tie/modules/http"
+	"github.com/angrypie/tie/parser"
+	"github.com/angrypie/tie/template"
+	"github.com/angrypie/tie/template/modutils"
+	. "github.com/dave/jennifer/jen"
+)
+
+func NewClientModule(p *parser.Parser) template.Module {
+	return modutils.NewStandartModule("client", GenerateClient, p, nil)
+}
+
+//GenerateClient creates client that exposes bidirectional streaming functions.
+//Functions that are not bidirectional streams return error.
+func GenerateClient(p *parser.Parser) (pkg *template.Package) {
+	info := template.NewPackageInfoFromParser(p)
+	f := NewFile(strings.ToLower(wsModuleId))
+
+	template.TemplateClient(info, f, func(ids template.ClientMethodIds, g *Group) {
+		fn := ids.Function
+		if !isBidirectional(fn) {
+			g.Id("_").Op("=").Id(ids.Request)
+			g.Id(ids.Err).Op("=").Qual("errors", "New").
+				Call(Lit(fmt.Sprintf("%s is not available over websocket", fn.Name)))
+			return
+		}
+		makeStreamClientCall(info, ids, httpmod.GetRoute(fn), g)
+	})
+	makeClientHelpersWS(info, f)
+
+	return modutils.NewPackage("client", "client.go", f.GoString())
+}
+
+//makeStreamClientCall dials connection, sends request and pumps streams.
+func makeStreamClientCall(info *PackageInfo, ids template.ClientMethodIds, route string, g *Group) {
+	fn := ids.Function
+	in, _ := template.GetStreamArgument(fn)
+	out, _ := template.GetStreamResult(fn)
+	conn, replies := template.ID("conn"), template.ID("replies")
+	ctx := ids.Context
+
+	g.Var().Id(conn).Op("*").Qual(websocketPath, "Conn")
+	g.List(Id(conn), Id(ids.Err)).Op("=").Id(dialWSHelper).Call(ctx, ids.ShardKey, Lit(route), Id(ids.Request))
+	template.AddIfErrorGuard(g, nil, ids.Err, nil)
+
+	//Write input stream to connection
+	g.Go().Func().Params().Block(For().Block(Select().Block(
+		Case(List(Id("msg"), Id("ok")).Op(":=").Op("<-").
+			Id(ids.Request).Dot(strings.Title(in.Name()))).Block(
+			//Empty message signals end of input stream
+			If(Op("!").Id("ok")).Block(
+				Id(conn).Dot("WriteMessage").Call(Qual(websocketPath, "TextMessage"), Nil()),
+				Return(),
+			),
+			If(
+				Err().Op(":=").Id(conn).Dot("WriteJSON").Call(Id("msg")),
+				Err().Op("!=").Nil(),
+			).Block(Return()),
+		),
+		Case(Op("<-").Add(ctx).Dot("Done").Call()).Block(
+			Id(conn).Dot("Close").Call(),
+			Return(),
+		),
+	))).Call()
+
+	//Read output stream from connection
+	outElem := template.CreateChanElemType(out, info)
+	g.Id(replies).Op(":=").Make(Chan().Add(outElem))
+	g.Go().Func().Params().Block(
+		Defer().Close(Id(replies)),
+		Defer().Id(conn).Dot("Close").Call(),
+		For().Block(
+			Var().Id("reply").Add(outElem),
+			If(
+				Err().Op(":=").Id(conn).Dot("ReadJSON").Call(Op("&").Id("reply")),
+				Err().Op("!=").Nil(),
+			).Block(Return()),
+			Select().Block(
+				Case(Id(replies).Op("<-").Id("reply")),
+				Case(Op("<-").Add(ctx).Dot("Done").Call()).Block(Return()),
+			),
+		),
+	).Call()
+
+	g.Id(ids.Response).Dot(strings.Title(out.Name())).Op("=").Id(replies)
+}
+
+const dialWSHelper = "dialWSHelper"
+
+//GetAddressEnv returns environment variable name that holds service address for clients.
+func GetAddressEnv(info *PackageInfo) string {
+	alias := strings.ToUpper(strings.ReplaceAll(info.Service.Alias, "-", "_"))
+	return fmt.Sprintf("TIE_%s_WS_ADDRESS", alias)
+}
+
+func makeClientHelpersWS(info *PackageInfo, f *File) {
+	defaultAddress := template.ClientScheme(info, "ws") + "://127.0.0.1"
+	if port := template.ClientPort(info.Service, "ws"); port != "" {
+		defaultAddress += ":" + port
+	}
+
+	template.AddClientAddressHelper(info, f, GetAddressEnv(info), defaultAddress)
+	template.AddClientTLSHelpers(info, f)
+
+	//dialWSHelper opens connection and sends request as first message.
+	f.Func().Id(dialWSHelper).Params(
+		Id("ctx").Qual("context", "Context"), List(Id("key"), Id("route")).String(), Id("request").Interface(),
+	).Params(Id("conn").Op("*").Qual(websocketPath, "Conn"), Err().Error()).Block(
+		Id("dialer").Op(":=").Op("*").Qual(websocketPath, "DefaultDialer"),
+		List(Id("dialer").Dot("TLSClientConfig"), Err()).Op("=").Id(template.ClientTLSHelper).Call(),
+		If(Err().Op("!=").Nil()).Block(Return()),
+		List(Id("conn"), Id("_"), Err()).Op("=").Id("dialer").
+			Dot("DialContext").Call(Id("ctx"), Id(template.ClientAddressHelper).Call(Id("key")).Op("+").Id("route"), Nil()),
+		If(Err().Op("!=").Nil()).Block(Return()),
+		If(
+			Err().Op("=").Id("conn").Dot("WriteJSON").Call(Id("request")),
+			Err().Op("!=").Nil(),
+		).Block(
+			Id("conn").Dot("Close").Call(),
+			Return(Nil(), Err()),
+		),
+		Return(),
+	)
+}
@@ -0,0 +1,272 @@
+package wsmod
+
+import (
+	"log"
+	"strings"
+
+	httpmod "github.com/angrypie/tie/modules/http"
+	"github.com/angrypie/tie/parser"
+	"github.com/angrypie/tie/template"
+	"github.com/angrypie/tie/template/modutils"
+	. "github.com/dave/jennifer/jen"
+)
+
+const websocketPath = "github.com/gorilla/websocket"
+const wsModuleId = "WS"
+
+type PackageInfo = template.PackageInfo
+
+//NewModule creates module that serves bidirectional streaming functions
+//(func(in <-chan Msg) (<-chan Reply, error)) over WebSocket.
+func NewModule(p *parser.Parser) template.Module {
+	var deps []template.Module
+	if p.GetPackageName() != "main" {
+		deps = append(deps, NewClientModule(p))
+	}
+	return modutils.NewStandartModule("wsmod", GenerateServer, p, deps).
+		WithValidator(template.NewDepsValidator("ws", getDeps(), isBidirectional))
+}
+
+//getDeps returns dependencies available after connection upgrade.
+func getDeps() template.DepsMap {
+	deps := template.DefaultDeps()
+	deps[template.DepContext.Name] = Id("ctx")
+	deps[template.DepGetHeader.Name] = Id(template.GetHeaderHelper).Call(Id("r"))
+	deps[template.DepGetCookie.Name] = Id(template.GetCookieHelper).Call(Id("r"))
+	deps[template.DepClientIP.Name] = Id(template.ClientIPHelper).Call(Id("r"))
+	deps[template.DepRequest.Name] = Id("r")
+	deps[template.DepPrincipal.Name] = Id(template.PrincipalHelper).Call(Id("ctx"))
+	deps[template.CallAuthorization] = Id("ctx")
+	return deps
+}
+
+func GenerateServer(p *parser.Parser) *template.Package {
+	info := template.NewPackageInfoFromParser(p)
+	f := NewFile(strings.ToLower(wsModuleId))
+
+	template.TemplateRpcServer(info, f, template.TemplateServerConfig{
+		GenResourceScope: func(g *Group, resource, instance string) {
+			makeStartWSServer(info, g, instance)
+		},
+		GenHandler: makeWSHandler,
+	})
+
+	makeConstantsWS(f)
+	makeHelpersWS(f)
+	template.AddRequestHelpers(f)
+	template.AddCallAuthHelpers(info, f)
+
+	return template.NewPackage(info, "wsmod", "server.go", f.GoString())
+}
+
+//isBidirectional returns true if function can be exposed over WebSocket.
+func isBidirectional(fn parser.Function) bool {
+	_, ok := template.GetStreamArgument(fn)
+	return ok
+}
+
+//makeWSHandler creates handler that reads request from first message,
+//then pumps incoming messages to input stream and output stream to connection.
+func makeWSHandler(info *PackageInfo, file *File, fn parser.Function) {
+	if !isBidirectional(fn) {
+		log.Printf("ws: skip function %s: it is not bidirectional stream\n", fn.Name)
+		return
+	}
+	_, request, response := template.GetMethodTypes(fn)
+	in, _ := template.GetStreamArgument(fn)
+	out, _ := template.GetStreamResult(fn)
+
+	handlerBody := func(g *Group, resourceInstance string) {
+		g.Comment("makeWSHandler body:").Line()
+		//First message contains request arguments (except streams)
+		g.Id("request").Op(":=").New(Id(request))
+		template.AddIfErrorGuard(g, Err().Op(":=").Id("conn").Dot("ReadJSON").Call(Id("request")), "err", Err())
+
+		//Call is authenticated by Authorization header of upgrade request
+		ctx := Id("r").Dot("Context").Call()
+		if template.IsAuth(info) {
+			ctx = Id(template.AuthContextHelper).Call(ctx, Id("r").Dot("Header"))
+		}
+		g.List(Id("ctx"), Id("cancel")).Op(":=").Qual("context", "WithCancel").Call(ctx)
+		g.Defer().Id("cancel").Call()
+		template.InjectContextArgs(g, fn, "request", Id("ctx"))
+
+		//Buffered input stream, reading stops when buffer is full (backpressure)
+		inElem := template.CreateChanElemType(in, info)
+		g.Id("in").Op(":=").Make(Chan().Add(inElem), Id(wsBufferSize))
+		g.Id("request").Dot(strings.Title(in.Name())).Op("=").Id("in")
+
+		g.Id("response").Op(":=").New(Id(response))
+		template.MakeOriginalCall(info, fn, g, getDeps(), ifErrorReturnErrWS, resourceInstance)
+
+		readDeadline := Id("conn").Dot("SetReadDeadline").Call(
+			Qual("time", "Now").Call().Dot("Add").Call(Id(wsPongWait)),
+		)
+		g.Go().Func().Params().Block(
+			Defer().Id("cancel").Call(),
+			Func().Params().Block(
+				Defer().Close(Id("in")),
+				For().Block(
+					readDeadline,
+					List(Id("_"), Id("data"), Err()).Op(":=").Id("conn").Dot("ReadMessage").Call(),
+					//Empty message signals end of input stream
+					If(Err().Op("!=").Nil().Op("||").Len(Id("data")).Op("==").Lit(0)).Block(Return()),
+					Var().Id("msg").Add(inElem),
+					//Message that can't be decoded closes connection and cancels call
+					If(
+						Err().Op(":=").Qual("encoding/json", "Unmarshal").Call(Id("data"), Op("&").Id("msg")),
+						Err().Op("!=").Nil(),
+					).Block(
+						Id("conn").Dot("WriteControl").Call(
+							Qual(websocketPath, "CloseMessage"),
+							Qual(websocketPath, "FormatCloseMessage").Call(
+								Qual(websocketPath, "CloseUnsupportedData"), Err().Dot("Error").Call(),
+							),
+							Qual("time", "Now").Call().Dot("Add").Call(Id(wsWriteWait)),
+						),
+						Id("cancel").Call(),
+						Return(),
+					),
+					Select().Block(
+						Case(Id("in").Op("<-").Id("msg")),
+						Case(Op("<-").Id("ctx").Dot("Done").Call()).Block(Return()),
+					),
+				),
+			).Call(),
+			//Keep reading control messages until connection is closed
+			For().Block(
+				readDeadline,
+				If(
+					List(Id("_"), Id("_"), Err()).Op(":=").Id("conn").Dot("NextReader").Call(),
+					Err().Op("!=").Nil(),
+				).Block(Return()),
+			),
+		).Call()
+
+		g.Id("ticker").Op(":=").Qual("time", "NewTicker").Call(Id(wsPingPeriod))
+		g.Defer().Id("ticker").Dot("Stop").Call()
+		g.For().Block(Select().Block(
+			Case(Op("<-").Id("ctx").Dot("Done").Call()).Block(Return(Nil())),
+			Case(List(Id("reply"), Id("ok")).Op(":=").Op("<-").
+				Id("response").Dot(strings.Title(out.Name()))).Block(
+				If(Op("!").Id("ok")).Block(Return(Nil())),
+				Id("conn").Dot("SetWriteDeadline").Call(
+					Qual("time", "Now").Call().Dot("Add").Call(Id(wsWriteWait)),
+				),
+				If(
+					Err().Op(":=").Id("conn").Dot("WriteJSON").Call(Id("reply")),
+					Err().Op("!=").Nil(),
+				).Block(Return(Err())),
+			),
+			Case(Op("<-").Id("ticker").Dot("C")).Block(
+				If(
+					Err().Op(":=").Id("conn").Dot("WriteControl").Call(
+						Qual(websocketPath, "PingMessage"), Nil(),
+						Qual("time", "Now").Call().Dot("Add").Call(Id(wsWriteWait)),
+					),
+					Err().Op("!=").Nil(),
+				).Block(Return(Err())),
+			),
+		))
+	}
+
+	template.MakeHandlerWrapper(
+		file, handlerBody, info, fn,
+		List(
+			Id("conn").Op("*").Qual(websocketPath, "Conn"),
+			Id("r").Op("*").Qual("net/http", "Request"),
+		),
+		Err().Error(),
+	)
+}
+
+func ifErrorReturnErrWS(scope *Group, statement *Statement) {
+	template.AddIfErrorGuard(scope, statement, "err", Err())
+}
+
+func makeStartWSServer(info *PackageInfo, g *Group, resourceInstance string) {
+	template.MakeStartServerInit(info, g, "ws")
+	g.Id("mux").Op(":=").Qual("net/http", "NewServeMux").Call()
+
+	template.ForEachFunction(info, true, func(fn parser.Function) {
+		if !isBidirectional(fn) {
+			return
+		}
+		handler, _, _ := template.GetMethodTypes(fn)
+		g.Id("mux").Dot("Handle").Call(
+			Lit(httpmod.GetRoute(fn)),
+			Id(serveWSHelper).Call(Id(handler).Call(Id(resourceInstance))),
+		)
+	})
+
+	template.MakeListenAndServe(info, g, Id("mux"))
+}
+
+const wsWriteWait = "wsWriteWait"
+const wsPongWait = "wsPongWait"
+const wsPingPeriod = "wsPingPeriod"
+const wsBufferSize = "wsBufferSize"
+const wsMaxMessageSize = "wsMaxMessageSize"
+
+func makeConstantsWS(f *File) {
+	f.Const().Defs(
+		Comment("Time allowed to write a message to the peer."),
+		Id(wsWriteWait).Op("=").Lit(10).Op("*").Qual("time", "Second"),
+		Comment("Time allowed to read the next pong message from the peer."),
+		Id(wsPongWait).Op("=").Lit(60).Op("*").Qual("time", "Second"),
+		Comment("Send pings to peer with this period. Must be less than pong wait."),
+		Id(wsPingPeriod).Op("=").Parens(Id(wsPongWait).Op("*").Lit(9)).Op("/").Lit(10),
+		Comment("Number of incoming messages buffered before reading is paused."),
+		Id(wsBufferSize).Op("=").Lit(16),
+		Comment("Maximum message size allowed from peer."),
+		Id(wsMaxMessageSize).Op("=").Lit(1<<20),
+	)
+}
+
+const serveWSHelper = "serveWSHelper"
+
+func makeHelpersWS(f *File) {
+	f.Var().Id("wsUpgrader").Op("=").Qual(websocketPath, "Upgrader").Values()
+
+	handlerType := Func().Params(
+		Op("*").Qual(websocketPath, "Conn"),
+		Op("*").Qual("net/http", "Request"),
+	).Error()
+
+	//serveWSHelper upgrades connection and closes it with handler error.
+	f.Func().Id(serveWSHelper).Params(Id("handler").Add(handlerType)).
+		Qual("net/http", "HandlerFunc").Block(
+		Return(Func().Params(
+			Id("w").Qual("net/http", "ResponseWriter"),
+			Id("r").Op("*").Qual("net/http", "Request"),
+		).Block(
+			List(Id("conn"), Err()).Op(":=").Id("wsUpgrader").Dot("Upgrade").
+				Call(Id("w"), Id("r"), Nil()),
+			If(Err().Op("!=").Nil()).Block(Return()),
+			Defer().Id("conn").Dot("Close").Call(),
+			Id("conn").Dot("SetReadLimit").Call(Id(wsMaxMessageSize)),
+			Id("conn").Dot("SetPongHandler").Call(
+				Func().Params(String()).Error().Block(
+					Return(Id("conn").Dot("SetReadDeadline").Call(
+						Qual("time", "Now").Call().Dot("Add").Call(Id(wsPongWait)),
+					)),
+				),
+			),
+
+			List(Id("code"), Id("text")).Op(":=").
+				List(Qual(websocketPath, "CloseNormalClosure"), Lit("")),
+			If(
+				Err().Op(":=").Id("handler").Call(Id("conn"), Id("r")),
+				Err().Op("!=").Nil(),
+			).Block(
+				List(Id("code"), Id("text")).Op("=").
+					List(Qual(websocketPath, "CloseInternalServerErr"), Err().Dot("Error").Call()),
+			),
+			Id("conn").Dot("WriteControl").Call(
+				Qual(websocketPath, "CloseMessage"),
+				Qual(websocketPath, "FormatCloseMessage").Call(Id("code"), Id("text")),
+				Qual("time", "Now").Call().Dot("Add").Call(Id(wsWriteWait)),
+			),
+		)),
+	)
+}
@@ -0,0 +1,120 @@
+package parser
+
+import (
+	"errors"
+	"fmt"
+	"go/token"
+	"go/types"
+)
+
+//instance is generic function instantiated by generics of service config.
+type instance struct {
+	name     string
+	sig      *types.Signature
+	typeArgs []Field
+}
+
+//instances returns instances of generic function declared in generics of service config.
+func (p *Parser) instances(f *types.Func) (instances []instance, err error) {
+	for _, generic := range p.Service.Generics {
+		if generic.Function != f.Name() {
+			continue
+		}
+		name := generic.Name
+		if name == "" {
+			name = f.Name()
+		}
+		var targs []types.Type
+		var typeArgs []Field
+		for _, expr := range generic.Types {
+			//Types are evaluated in file scope of function, so imported packages can be used
+			tv, err := types.Eval(p.fset, p.Pkg, f.Pos(), expr)
+			if err != nil {
+				return nil, fmt.Errorf("%s: type %s: %w", name, expr, err)
+			}
+			if !tv.IsType() {
+				return nil, fmt.Errorf("%s: %s is not type", name, expr)
+			}
+			targs = append(targs, tv.Type)
+			typeArgs = append(typeArgs, Field{Type: Type{tv.Type}})
+		}
+		instantiated, err := types.Instantiate(nil, f.Type(), targs, true)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		instances = append(instances, instance{name, instantiated.(*types.Signature), typeArgs})
+	}
+	return
+}
+
+//ValidateGenerics returns error if generics of service config can't be instantiated
+//or if names of instances are not unique.
+func (p *Parser) ValidateGenerics() error {
+	names := make(map[string]bool)
+	for _, generic := range p.Service.Generics {
+		f, ok := p.Pkg.Scope().Lookup(generic.Function).(*types.Func)
+		if !ok || !f.Exported() {
+			return fmt.Errorf("generics: unknown function %s", generic.Function)
+		}
+		if f.Type().(*types.Signature).TypeParams().Len() == 0 {
+			return fmt.Errorf("generics: function %s is not generic", generic.Function)
+		}
+		name := generic.Name
+		if name == "" {
+			name = generic.Function
+		}
+		if !token.IsIdentifier(name) || !token.IsExported(name) {
+			return fmt.Errorf("generics: %s is not exported identifier", name)
+		}
+		if names[name] || name != generic.Function && p.Pkg.Scope().Lookup(name) != nil {
+			return fmt.Errorf("generics: name %s is already used", name)
+		}
+		names[name] = true
+	}
+	for _, generic := range p.Service.Generics {
+		f := p.Pkg.Scope().Lookup(generic.Function).(*types.Func)
+		if _, err := p.instances(f); err != nil {
+			return fmt.Errorf("generics: %w", err)
+		}
+	}
+	return nil
+}
+
+//CheckWire returns error if values of type can't be transferred over the wire by generated
+//code (anonymous structs, functions and instances of generic types). Named types are
+//encoded by encoding/json, their fields are not checked.
+func (t Type) CheckWire() error {
+	return checkWire(t.typ)
+}
+
+func checkWire(typ types.Type) error {
+	switch t := typ.(type) {
+	case *types.Named:
+		if t.TypeArgs().Len() != 0 {
+			return fmt.Errorf("instance of generic type %s is not supported", t.Obj().Name())
+		}
+		if _, ok := t.Underlying().(*types.Signature); ok {
+			return errors.New("func type can't be transferred over the wire")
+		}
+	case *types.Struct:
+		return errors.New("anonymous struct type is not supported (declare named type)")
+	case *types.Signature:
+		return errors.New("func type can't be transferred over the wire")
+	case *types.TypeParam:
+		return errors.New("type parameter is not supported")
+	case *types.Pointer:
+		return checkWire(t.Elem())
+	case *types.Slice:
+		return checkWire(t.Elem())
+	case *types.Array:
+		return checkWire(t.Elem())
+	case *types.Chan:
+		return checkWire(t.Elem())
+	case *types.Map:
+		if err := checkWire(t.Key()); err != nil {
+			return err
+		}
+		return checkWire(t.Elem())
+	}
+	return nil
+}
@@ -14,6 +14,7 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"sort"
 	"strings"
 
 	tieTypes "github.com/angrypie/tie/types"
@@ -170,31 +171,59 @@ func (p *Parser) GetPackageName() string {
 	return p.pkg.Name
 }
 
-//GetFunctions returns exported functions from package
+//GetFunctions returns exported functions from package. Generic functions are instantiated
+//by generics of service config, methods of generic types are skipped.
 func (p *Parser) GetFunctions() (functions []Function) {
-	addFunc := func(f *types.Func) {
-		if !f.Exported() {
-			return
-		}
-		sig := f.Type().(*types.Signature)
+	//Package is not parsed
+	if p.pkg == nil {
+		return
+	}
+	docs, directives := p.getDocs()
+	add := func(f *types.Func, name string, sig *types.Signature, generic string, typeArgs []Field) {
 		receiver := NewField(sig.Recv())
-		args := extractArgsList(sig.Params())
-		results, err := resultsFromArgs(extractArgsList(sig.Results()))
+		args := extractArgsList(sig.Params(), sig.Variadic())
+		results, err := resultsFromArgs(extractArgsList(sig.Results(), false))
 		if err != nil {
 			log.Printf("skip function %s: %e\n", f.FullName(), err)
 			return
 		}
 
 		function := Function{
-			Name:        f.Name(),
+			Name:        name,
 			Arguments:   args,
 			Results:     results,
 			Receiver:    receiver,
 			Package:     p.Service.Alias,
 			ServiceType: p.Service.Type,
+			Doc:         docs[f.Pos()],
+			Directives:  directives[f.Pos()],
+			Generic:     generic,
+			TypeArgs:    typeArgs,
 		}
 		functions = append(functions, function)
 	}
+	addFunc := func(f *types.Func) {
+		if !f.Exported() {
+			return
+		}
+		sig := f.Type().(*types.Signature)
+		if sig.RecvTypeParams().Len() != 0 {
+			log.Printf("skip function %s: methods of generic types are not supported\n", f.FullName())
+			return
+		}
+		if sig.TypeParams().Len() == 0 {
+			add(f, f.Name(), sig, "", nil)
+			return
+		}
+		instances, err := p.instances(f)
+		if err != nil || len(instances) == 0 {
+			log.Printf("skip function %s: generic function requires instance in generics of service config\n", f.FullName())
+			return
+		}
+		for _, instance := range instances {
+			add(f, instance.name, instance.sig, f.Name(), instance.typeArgs)
+		}
+	}
 	scope := p.Pkg.Scope()
 	for _, name := range scope.Names() {
 		o := scope.Lookup(name)
@@ -212,6 +241,83 @@ func (p *Parser) GetFunctions() (functions []Function) {
 	return
 }
 
+//GetDirectiveFunctions returns exported package functions with directive in order of declaration.
+func (p *Parser) GetDirectiveFunctions(name string) (functions []DirectiveFunction) {
+	if p.pkg == nil {
+		return
+	}
+	_, directives := p.getDocs()
+	var funcs []*types.Func
+	scope := p.Pkg.Scope()
+	for _, name := range scope.Names() {
+		if f, ok := scope.Lookup(name).(*types.Func); ok && f.Exported() {
+			funcs = append(funcs, f)
+		}
+	}
+	sort.Slice(funcs, func(i, j int) bool { return funcs[i].Pos() < funcs[j].Pos() })
+	for _, f := range funcs {
+		for _, directive := range directives[f.Pos()] {
+			if directive.Name != name {
+				continue
+			}
+			functions = append(functions, DirectiveFunction{
+				Name:      f.Name(),
+				Signature: signatureString(f.Type().(*types.Signature)),
+				Directive: directive,
+			})
+		}
+	}
+	return
+}
+
+//signatureString returns function type without parameter names.
+func signatureString(sig *types.Signature) string {
+	typesOf := func(list *types.Tuple) (names []string) {
+		for i := 0; i < list.Len(); i++ {
+			names = append(names, types.TypeString(list.At(i).Type(), nil))
+		}
+		return
+	}
+	signature := "func(" + strings.Join(typesOf(sig.Params()), ", ") + ")"
+	switch results := typesOf(sig.Results()); len(results) {
+	case 0:
+		return signature
+	case 1:
+		return signature + " " + results[0]
+	default:
+		return signature + " (" + strings.Join(results, ", ") + ")"
+	}
+}
+
+//getDocs returns doc comments and directives of functions and methods declared in package by name position.
+func (p *Parser) getDocs() (docs map[token.Pos]string, directives map[token.Pos][]Directive) {
+	docs, directives = make(map[token.Pos]string), make(map[token.Pos][]Directive)
+	if p.pkg == nil {
+		return
+	}
+	for _, file := range p.pkg.Files {
+		for _, decl := range file.Decls {
+			fn, ok := decl.(*ast.FuncDecl)
+			if !ok || fn.Doc == nil {
+				continue
+			}
+			//Directives are not part of doc comment text
+			docs[fn.Name.Pos()] = strings.TrimSpace(fn.Doc.Text())
+			for _, comment := range fn.Doc.List {
+				if directive, ok := ParseDirective(comment.Text); ok {
+					directives[fn.Name.Pos()] = append(directives[fn.Name.Pos()], directive)
+				}
+			}
+		}
+	}
+	return
+}
+
+//NewResultFields creates results list, last field must have error type.
+func NewResultFields(fields ...Field) (results ResultFields, err error) {
+	return resultsFromArgs(fields)
+}
+
 //resultsFromArgs creates field list that contain error field type at last position
 func resultsFromArgs(args []Field) (results ResultFields, err error) {
 	length := len(args)
@@ -228,7 +334,9 @@ func resultsFromArgs(args []Field) (results ResultFields, err error) {
 	return
 }
 
-func extractArgsList(list *types.Tuple) (args []Field) {
+//extractArgsList creates fields from parameters or results, unnamed fields are named argN.
+//Last parameter of variadic function is variadic.
+func extractArgsList(list *types.Tuple, variadic bool) (args []Field) {
 	if list == nil {
 		return
 	}
@@ -240,8 +348,9 @@ func extractArgsList(list *types.Tuple) (args []Field) {
 		}
 
 		field := NewField(v)
+		field.variadic = variadic && count == length-1
 
-		if field.name == "" {
+		if field.name == "" || field.name == "_" {
 			field.name = fmt.Sprintf("arg%d", count)
 		}
 
@@ -0,0 +1,206 @@
+package parser
+
+import (
+	"go/types"
+	"reflect"
+	"strings"
+)
+
+//Schema is JSON Schema of value encoded with encoding/json.
+type Schema map[string]interface{}
+
+//Schema returns JSON Schema of type. Channels and functions can't be encoded,
+//nil is returned for them.
+func (t Type) Schema() Schema {
+	return typeSchema(t.typ, make(map[*types.Named]bool))
+}
+
+//ObjectSchema creates object schema from properties. Properties with nil schema are skipped.
+func ObjectSchema(properties map[string]Schema, required []string) Schema {
+	props := make(map[string]interface{})
+	var req []string
+	for name, schema := range properties {
+		if schema != nil {
+			props[name] = schema
+		}
+	}
+	seen := make(map[string]bool)
+	for _, name := range required {
+		if _, ok := props[name]; ok && !seen[name] {
+			seen[name] = true
+			req = append(req, name)
+		}
+	}
+	schema := Schema{"type": "object", "properties": props}
+	if len(req) != 0 {
+		schema["required"] = req
+	}
+	return schema
+}
+
+//IsOptional returns true if value of type may be omitted (nil pointer, slice, map or interface).
+func (t Type) IsOptional() bool {
+	switch t.typ.Underlying().(type) {
+	case *types.Pointer, *types.Slice, *types.Map, *types.Interface:
+		return true
+	}
+	return false
+}
+
+func typeSchema(typ types.Type, visited map[*types.Named]bool) Schema {
+	switch t := typ.(type) {
+	case *types.Basic:
+		return basicSchema(t)
+	case *types.Named:
+		if schema, ok := namedSchema(t); ok {
+			return schema
+		}
+		//Recursive types are described as any value of their kind
+		if visited[t] {
+			if _, ok := t.Underlying().(*types.Struct); ok {
+				return Schema{"type": "object"}
+			}
+			return Schema{}
+		}
+		visited[t] = true
+		defer delete(visited, t)
+		return typeSchema(t.Underlying(), visited)
+	case *types.Pointer:
+		return typeSchema(t.Elem(), visited)
+	case *types.Slice:
+		if isByte(t.Elem()) {
+			return Schema{"type": "string", "contentEncoding": "base64"}
+		}
+		return arraySchema(t.Elem(), visited)
+	case *types.Array:
+		schema := arraySchema(t.Elem(), visited)
+		if schema != nil {
+			schema["minItems"], schema["maxItems"] = t.Len(), t.Len()
+		}
+		return schema
+	case *types.Map:
+		basic, ok := t.Key().Underlying().(*types.Basic)
+		if !ok || basic.Info()&(types.IsString|types.IsInteger) == 0 {
+			return Schema{}
+		}
+		items := typeSchema(t.Elem(), visited)
+		if items == nil {
+			return nil
+		}
+		return Schema{"type": "object", "additionalProperties": items}
+	case *types.Struct:
+		properties := make(map[string]Schema)
+		var required []string
+		structFields(t, visited, properties, &required, false)
+		return ObjectSchema(properties, required)
+	case *types.Interface:
+		return Schema{}
+	}
+	return nil
+}
+
+func basicSchema(t *types.Basic) Schema {
+	info := t.Info()
+	switch {
+	case info&types.IsBoolean != 0:
+		return Schema{"type": "boolean"}
+	case info&types.IsUnsigned != 0:
+		return Schema{"type": "integer", "minimum": 0}
+	case info&types.IsInteger != 0:
+		return Schema{"type": "integer"}
+	case info&types.IsFloat != 0:
+		return Schema{"type": "number"}
+	case info&types.IsString != 0:
+		return Schema{"type": "string"}
+	}
+	return nil
+}
+
+//namedSchema returns schema for types that define their own encoding.
+func namedSchema(t *types.Named) (schema Schema, ok bool) {
+	obj := t.Obj()
+	if obj.Pkg() != nil && obj.Pkg().Path() == "time" && obj.Name() == "Time" {
+		return Schema{"type": "string", "format": "date-time"}, true
+	}
+	if hasMethod(t, "MarshalJSON") {
+		return Schema{}, true
+	}
+	if hasMethod(t, "MarshalText") {
+		return Schema{"type": "string"}, true
+	}
+	return nil, false
+}
+
+func hasMethod(t types.Type, name string) bool {
+	mset := types.NewMethodSet(types.NewPointer(t))
+	for i := 0; i < mset.Len(); i++ {
+		if mset.At(i).Obj().Name() == name {
+			return true
+		}
+	}
+	return false
+}
+
+func isByte(t types.Type) bool {
+	basic, ok := t.(*types.Basic)
+	return ok && basic.Kind() == types.Byte
+}
+
+func arraySchema(elem types.Type, visited map[*types.Named]bool) Schema {
+	items := typeSchema(elem, visited)
+	if items == nil {
+		return nil
+	}
+	return Schema{"type": "array", "items": items}
+}
+
+//structFields collects properties of struct fields by encoding/json rules,
+//fields of embedded structs are promoted unless outer struct has field with same name.
+//Rules of validate tags are described by schema keywords.
+func structFields(
+	t *types.Struct, visited map[*types.Named]bool,
+	properties map[string]Schema, required *[]string, promoted bool,
+) {
+	for i := 0; i < t.NumFields(); i++ {
+		field := t.Field(i)
+		name, opts := parseJSONTag(reflect.StructTag(t.Tag(i)).Get("json"))
+		if name == "-" && opts == "" {
+			continue
+		}
+		if field.Embedded() && name == "" {
+			typ := field.Type()
+			if ptr, ok := typ.(*types.Pointer); ok {
+				typ = ptr.Elem()
+			}
+			if embedded, ok := typ.Underlying().(*types.Struct); ok {
+				structFields(embedded, visited, properties, required, true)
+				continue
+			}
+		}
+		if !field.Exported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name()
+		}
+		if _, ok := properties[name]; ok && promoted {
+			continue
+		}
+		schema := typeSchema(field.Type(), visited)
+		if strings.Contains(opts, "string") && schema != nil {
+			schema = Schema{"type": "string"}
+		}
+		isRequired := ApplyRules(schema, ParseRules(reflect.StructTag(t.Tag(i)).Get(ValidateTag)), Type{field.Type()})
+		properties[name] = schema
+		if isRequired || !strings.Contains(opts, "omitempty") && !(Type{field.Type()}).IsOptional() {
+			*required = append(*required, name)
+		}
+	}
+}
+
+func parseJSONTag(tag string) (name, opts string) {
+	if idx := strings.Index(tag, ","); idx != -1 {
+		return tag[:idx], tag[idx+1:]
+	}
+	return tag, ""
+}
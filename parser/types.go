@@ -24,6 +24,62 @@ type Function struct {
 	Receiver    Field
 	Package     string
 	ServiceType string
+	//Doc is function doc comment without comment markers
+	Doc string
+	//Directives are tie directives from doc comment (e.g. //tie:shard key=name)
+	Directives []Directive
+	//Generic is name of generic function that function instantiates with TypeArgs,
+	//it is empty for not generic functions (see types.Generic).
+	Generic  string
+	TypeArgs []Field
+}
+
+//Directive is doc comment line in form //tie:name key=value flag.
+type Directive struct {
+	Name string
+	Args map[string]string
+}
+
+//GetDirective returns function directive by name.
+func (fn Function) GetDirective(name string) (directive Directive, ok bool) {
+	for _, directive := range fn.Directives {
+		if directive.Name == name {
+			return directive, true
+		}
+	}
+	return
+}
+
+//DirectiveFunction is exported package function with directive, its signature is not
+//restricted like signature of API function (e.g. //tie:middleware).
+type DirectiveFunction struct {
+	Name string
+	//Signature is function type without parameter names (e.g. func(int) error).
+	Signature string
+	Directive Directive
+}
+
+//DirectivePrefix starts tie directive comment.
+const DirectivePrefix = "//tie:"
+
+//ParseDirective parses directive comment, flags without value have empty value.
+func ParseDirective(comment string) (directive Directive, ok bool) {
+	if !strings.HasPrefix(comment, DirectivePrefix) {
+		return
+	}
+	parts := strings.Fields(strings.TrimPrefix(comment, DirectivePrefix))
+	if len(parts) == 0 {
+		return
+	}
+	directive = Directive{Name: parts[0], Args: make(map[string]string)}
+	for _, arg := range parts[1:] {
+		kv := strings.SplitN(arg, "=", 2)
+		if len(kv) == 1 {
+			kv = append(kv, "")
+		}
+		directive.Args[kv[0]] = kv[1]
+	}
+	return directive, true
 }
 
 type TypeSpec struct {
@@ -47,6 +103,20 @@ type Field struct {
 	name string
 	Var  *types.Var
 	Type
+	variadic bool
+}
+
+//IsVariadic returns true if field is variadic parameter (its type is slice of parameter type).
+func (field Field) IsVariadic() bool {
+	return field.variadic
+}
+
+//VariadicElem returns field with type of variadic parameter elements.
+func (field Field) VariadicElem() Field {
+	if slice, ok := field.typ.(*types.Slice); ok && field.variadic {
+		return Field{name: field.name, Var: field.Var, Type: Type{slice.Elem()}}
+	}
+	return field
 }
 
 //IsDefined return true if Var type is set.
@@ -58,10 +128,54 @@ func (field Field) Name() string {
 	return field.name
 }
 
+//RecvChanElem returns field with element type if field is receive-only channel.
+func (field Field) RecvChanElem() (elem Field, ok bool) {
+	ch, ok := field.typ.(*types.Chan)
+	if !ok || ch.Dir() != types.RecvOnly {
+		return elem, false
+	}
+	return Field{name: field.name, Var: field.Var, Type: Type{ch.Elem()}}, true
+}
+
 type Type struct {
 	typ types.Type
 }
 
+//Getters returns methods of named interface type if all of them are getters
+//(methods without arguments that return single value). Each getter is returned
+//as field with method name and result type.
+func (t Type) Getters() (getters []Field, ok bool) {
+	named, ok := t.typ.(*types.Named)
+	if !ok {
+		return nil, false
+	}
+	iface, ok := named.Underlying().(*types.Interface)
+	if !ok || iface.NumMethods() == 0 {
+		return nil, false
+	}
+	for i := 0; i < iface.NumMethods(); i++ {
+		method := iface.Method(i)
+		sig := method.Type().(*types.Signature)
+		if sig.Params().Len() != 0 || sig.Results().Len() != 1 || sig.Variadic() {
+			return nil, false
+		}
+		result := sig.Results().At(0)
+		getters = append(getters, Field{name: method.Name(), Var: result, Type: Type{result.Type()}})
+	}
+	return getters, true
+}
+
+//TypeString returns type with full package paths (e.g. *net/http.Request).
+func (t Type) TypeString() string {
+	return t.typ.String()
+}
+
+//IsChan returns true if type is channel of any direction.
+func (t Type) IsChan() bool {
+	_, ok := t.typ.(*types.Chan)
+	return ok
+}
+
 func (t Type) TypeName() string {
 	arr := strings.Split(t.typ.String(), t.fullPkgPath()+".")
 	return arr[len(arr)-1]
@@ -99,13 +213,14 @@ func traverseType(typ types.Type) (path string) {
 		return traverseType(t.Elem())
 	case *types.Map:
 		return traverseType(t.Elem())
+	case *types.Chan:
+		return traverseType(t.Elem())
 
 	case *types.Struct:
 	case *types.Tuple:
 	case *types.Signature:
 		return
 	case *types.Interface:
-	case *types.Chan:
 	}
 	log.Println("WARN Using unsuported type", reflect.TypeOf(typ), typ.String())
 	return
@@ -0,0 +1,262 @@
+package parser
+
+import (
+	"fmt"
+	"go/types"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+//ValidateTag is struct tag that holds validation rules of field (e.g. validate:"required,max=150").
+const ValidateTag = "validate"
+
+//Kind is kind of value that rules are checked against.
+type Kind int
+
+const (
+	KindOther Kind = iota
+	KindString
+	KindInt
+	KindUint
+	KindFloat
+	KindBool
+	//KindCollection is slice, array or map (rules check length).
+	KindCollection
+	KindPointer
+	KindStruct
+)
+
+//Kind returns kind of underlying type.
+func (t Type) Kind() Kind {
+	switch u := t.typ.Underlying().(type) {
+	case *types.Basic:
+		info := u.Info()
+		switch {
+		case info&types.IsString != 0:
+			return KindString
+		case info&types.IsUnsigned != 0:
+			return KindUint
+		case info&types.IsInteger != 0:
+			return KindInt
+		case info&types.IsFloat != 0:
+			return KindFloat
+		case info&types.IsBoolean != 0:
+			return KindBool
+		}
+	case *types.Slice, *types.Array, *types.Map:
+		return KindCollection
+	case *types.Pointer:
+		return KindPointer
+	case *types.Struct:
+		return KindStruct
+	}
+	return KindOther
+}
+
+//Elem returns element type of pointer type (or type itself).
+func (t Type) Elem() Type {
+	if ptr, ok := t.typ.Underlying().(*types.Pointer); ok {
+		return Type{ptr.Elem()}
+	}
+	return t
+}
+
+//Rule is validation rule, value is empty for rules without argument (e.g. required).
+type Rule struct {
+	Name, Value string
+}
+
+//ParseRules parses comma separated rules of validate tag, "-" disables validation.
+func ParseRules(tag string) (rules []Rule) {
+	for _, part := range strings.Split(tag, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" || part == "-" {
+			continue
+		}
+		kv := strings.SplitN(part, "=", 2)
+		rule := Rule{Name: kv[0]}
+		if len(kv) == 2 {
+			rule.Value = kv[1]
+		}
+		rules = append(rules, rule)
+	}
+	return
+}
+
+//OneOf returns allowed values of oneof rule, they are separated by spaces or |.
+func (rule Rule) OneOf() []string {
+	return strings.FieldsFunc(rule.Value, func(r rune) bool { return r == ' ' || r == '|' })
+}
+
+//CheckRules returns error if rules can't be checked for value of type.
+func CheckRules(rules []Rule, t Type) error {
+	kind := t.Kind()
+	if kind == KindPointer {
+		kind = t.Elem().Kind()
+	}
+	for _, rule := range rules {
+		switch rule.Name {
+		case "required", "omitempty":
+			if rule.Value != "" {
+				return fmt.Errorf("%s rule has no value", rule.Name)
+			}
+			if kind == KindStruct && t.Kind() != KindPointer {
+				return fmt.Errorf("%s rule can't be used with struct", rule.Name)
+			}
+		case "min", "max", "len":
+			if err := checkNumber(rule, kind); err != nil {
+				return err
+			}
+		case "oneof":
+			values := rule.OneOf()
+			switch {
+			case len(values) == 0:
+				return fmt.Errorf("oneof rule requires values")
+			case kind == KindString:
+				continue
+			case kind != KindInt && kind != KindUint && kind != KindFloat:
+				return fmt.Errorf("oneof rule can be used only with strings and numbers")
+			}
+			for _, value := range values {
+				if err := checkNumber(Rule{rule.Name, value}, kind); err != nil {
+					return err
+				}
+			}
+		default:
+			return fmt.Errorf("unknown rule %s (required, omitempty, min, max, len and oneof are supported)", rule.Name)
+		}
+	}
+	return nil
+}
+
+//checkNumber returns error if rule value is not number that can be compared with value
+//of kind, length is compared for strings and collections.
+func checkNumber(rule Rule, kind Kind) (err error) {
+	isLength := kind == KindString || kind == KindCollection
+	switch {
+	case rule.Name == "len" && !isLength:
+		return fmt.Errorf("len rule can be used only with strings and collections")
+	case isLength, kind == KindUint:
+		_, err = strconv.ParseUint(rule.Value, 10, 64)
+	case kind == KindInt:
+		_, err = strconv.ParseInt(rule.Value, 10, 64)
+	case kind == KindFloat:
+		_, err = strconv.ParseFloat(rule.Value, 64)
+	default:
+		return fmt.Errorf("%s rule can't be used with this type", rule.Name)
+	}
+	if err != nil {
+		return fmt.Errorf("%s rule: invalid value %q", rule.Name, rule.Value)
+	}
+	return nil
+}
+
+//ValidatedField is struct field with validation rules or with nested fields that have rules.
+type ValidatedField struct {
+	//Name is Go name of field, JSON is its name in encoded object.
+	Name, JSON string
+	Type       Type
+	Rules      []Rule
+	Fields     []ValidatedField
+}
+
+//ValidatedFields returns fields of struct (or pointer to struct) type that have validate tag,
+//nested structs are included if their fields have rules. Fields of embedded structs are
+//promoted like by encoding/json, embedded pointers are skipped.
+func (t Type) ValidatedFields() []ValidatedField {
+	return validatedFields(t.Elem().typ, make(map[*types.Named]bool))
+}
+
+func validatedFields(typ types.Type, visited map[*types.Named]bool) (fields []ValidatedField) {
+	if named, ok := typ.(*types.Named); ok {
+		if visited[named] {
+			return nil
+		}
+		visited[named] = true
+		defer delete(visited, named)
+	}
+	st, ok := typ.Underlying().(*types.Struct)
+	if !ok {
+		return nil
+	}
+	for i := 0; i < st.NumFields(); i++ {
+		field, tag := st.Field(i), reflect.StructTag(st.Tag(i))
+		name, _ := parseJSONTag(tag.Get("json"))
+		if name == "-" || !field.Exported() && !field.Embedded() {
+			continue
+		}
+		if field.Embedded() && name == "" {
+			if _, ok := field.Type().Underlying().(*types.Struct); ok {
+				fields = append(fields, validatedFields(field.Type(), visited)...)
+			}
+			continue
+		}
+		if name == "" {
+			name = field.Name()
+		}
+		validated := ValidatedField{
+			Name: field.Name(), JSON: name, Type: Type{field.Type()},
+			Rules: ParseRules(tag.Get(ValidateTag)),
+		}
+		if elem := validated.Type.Elem(); elem.Kind() == KindStruct {
+			validated.Fields = validatedFields(elem.typ, visited)
+		}
+		if len(validated.Rules) != 0 || len(validated.Fields) != 0 {
+			fields = append(fields, validated)
+		}
+	}
+	return
+}
+
+//ApplyRules adds keywords of rules to schema of value, required is true if value
+//must be present.
+func ApplyRules(schema Schema, rules []Rule, t Type) (required bool) {
+	if schema == nil {
+		return false
+	}
+	kind := t.Elem().Kind()
+	bounds := map[Kind][2]string{
+		KindString:     {"minLength", "maxLength"},
+		KindInt:        {"minimum", "maximum"},
+		KindUint:       {"minimum", "maximum"},
+		KindFloat:      {"minimum", "maximum"},
+		KindCollection: {"minItems", "maxItems"},
+	}[kind]
+	if _, isMap := t.Elem().typ.Underlying().(*types.Map); isMap {
+		bounds = [2]string{"minProperties", "maxProperties"}
+	}
+	number := func(value string) interface{} {
+		n, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return value
+		}
+		return n
+	}
+	for _, rule := range rules {
+		switch rule.Name {
+		case "required":
+			required = true
+			if kind == KindString {
+				schema["minLength"] = 1
+			}
+		case "min":
+			schema[bounds[0]] = number(rule.Value)
+		case "max":
+			schema[bounds[1]] = number(rule.Value)
+		case "len":
+			schema[bounds[0]], schema[bounds[1]] = number(rule.Value), number(rule.Value)
+		case "oneof":
+			var enum []interface{}
+			for _, value := range rule.OneOf() {
+				if kind == KindString {
+					enum = append(enum, value)
+				} else {
+					enum = append(enum, number(value))
+				}
+			}
+			schema["enum"] = enum
+		}
+	}
+	return
+}
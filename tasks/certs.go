@@ -0,0 +1,39 @@
+package tasks
+
+import (
+	"errors"
+	"path"
+
+	"github.com/angrypie/tie/tasks/certs"
+	"github.com/spf13/afero"
+)
+
+//CertsDir is directory of development certificates created by tie certs.
+const CertsDir = "certs"
+
+//CreateCerts creates development certificate authority and certificates of services
+//in certs directory, services are taken from tie.yaml if names are not specified.
+func CreateCerts(dest string, names []string) (dir string, created []string, err error) {
+	if len(names) == 0 {
+		buf, err := afero.ReadFile(afero.NewOsFs(), path.Join(dest, "tie.yaml"))
+		if err != nil {
+			return "", nil, ErrConfigNotFound
+		}
+		config, err := configFromYaml(buf, dest)
+		if err != nil {
+			return "", nil, err
+		}
+		for _, service := range config.Services {
+			name := service.Alias
+			if name == "" {
+				name = path.Base(service.Name)
+			}
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return "", nil, errors.New("no services to create certificates for")
+	}
+	dir = path.Join(dest, CertsDir)
+	return dir, names, certs.Generate(dir, names...)
+}
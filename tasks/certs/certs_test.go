@@ -0,0 +1,40 @@
+package certs
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerate(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, Generate(dir, "ping"))
+	ca, err := ioutil.ReadFile(filepath.Join(dir, CAFile))
+	require.NoError(t, err)
+
+	//CA is reused by next call
+	require.NoError(t, Generate(dir, "pong"))
+	again, err := ioutil.ReadFile(filepath.Join(dir, CAFile))
+	require.NoError(t, err)
+	require.Equal(t, ca, again)
+
+	pool := x509.NewCertPool()
+	require.True(t, pool.AppendCertsFromPEM(ca))
+	for _, name := range []string{"ping", "pong"} {
+		certFile, keyFile := CertFiles(name)
+		pair, err := tls.LoadX509KeyPair(filepath.Join(dir, certFile), filepath.Join(dir, keyFile))
+		require.NoError(t, err)
+		cert, err := x509.ParseCertificate(pair.Certificate[0])
+		require.NoError(t, err)
+		for _, usage := range []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth} {
+			_, err = cert.Verify(x509.VerifyOptions{Roots: pool, DNSName: "localhost", KeyUsages: []x509.ExtKeyUsage{usage}})
+			require.NoError(t, err)
+		}
+		require.NoError(t, cert.VerifyHostname(name))
+		require.NoError(t, cert.VerifyHostname("127.0.0.1"))
+	}
+}
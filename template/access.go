@@ -0,0 +1,180 @@
+package template
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/angrypie/tie/parser"
+	. "github.com/dave/jennifer/jen"
+)
+
+//Authorization directives of method or receiver constructor (rule of all receiver methods),
+//method directive overrides receiver one: //tie:auth role=admin,ops or //tie:public.
+const (
+	AuthDirective   = "auth"
+	PublicDirective = "public"
+)
+
+//APIDescriptionFile is name of generated file that describes functions and their access.
+const APIDescriptionFile = "api.json"
+
+//Access is authorization rule of function.
+type Access struct {
+	//Public is true if function can be called without authentication.
+	Public bool
+	//Roles are roles allowed to call function (any of them), empty if any principal is allowed.
+	Roles []string
+	//Explicit is true if rule is set by directive.
+	Explicit bool
+}
+
+//accessDirective returns authorization directive of function or its receiver constructor.
+func accessDirective(info *PackageInfo, fn parser.Function) (directive parser.Directive, ok bool) {
+	find := func(fn parser.Function) (parser.Directive, bool) {
+		for _, directive := range fn.Directives {
+			if directive.Name == AuthDirective || directive.Name == PublicDirective {
+				return directive, true
+			}
+		}
+		return parser.Directive{}, false
+	}
+	if directive, ok = find(fn); ok || !HasReceiver(fn) {
+		return
+	}
+	if c, isReceiver := info.GetConstructor(fn.Receiver); isReceiver {
+		return find(c.Function)
+	}
+	return
+}
+
+//GetAccess returns authorization rule of function, functions without directive
+//are public if service is not authenticated.
+func GetAccess(info *PackageInfo, fn parser.Function) Access {
+	directive, ok := accessDirective(info, fn)
+	switch {
+	case !ok:
+		return Access{Public: !IsAuth(info)}
+	case directive.Name == PublicDirective:
+		return Access{Public: true, Explicit: true}
+	}
+	access := Access{Explicit: true}
+	if roles := directive.Args["role"]; roles != "" {
+		access.Roles = strings.Split(roles, ",")
+	}
+	return access
+}
+
+//functionName returns name of function in errors and API description (Receiver.Method).
+func functionName(fn parser.Function) string {
+	if HasReceiver(fn) {
+		return TrimPrefix(fn.Receiver.TypeName()) + "." + fn.Name
+	}
+	return fn.Name
+}
+
+//ValidateAccess returns error if authorization directives are malformed or can't be
+//checked (service is not authenticated or principal has no roles).
+func ValidateAccess(info *PackageInfo) error {
+	for _, fn := range info.Functions {
+		_, isAuth := fn.GetDirective(AuthDirective)
+		public, isPublic := fn.GetDirective(PublicDirective)
+		name := functionName(fn)
+		switch {
+		case isAuth && isPublic:
+			return fmt.Errorf("%s: //tie:auth and //tie:public can't be used together", name)
+		case isPublic && len(public.Args) != 0:
+			return fmt.Errorf("%s: //tie:public has no arguments", name)
+		case !isAuth:
+			continue
+		case !IsAuth(info):
+			return fmt.Errorf("%s: //tie:auth requires auth or authentication in service config", name)
+		}
+		directive, _ := fn.GetDirective(AuthDirective)
+		for arg, value := range directive.Args {
+			if arg != "role" || value == "" {
+				return fmt.Errorf("%s: //tie:auth accepts only role=name[,name]", name)
+			}
+		}
+		if _, ok := directive.Args["role"]; ok && info.Service.Authentication == nil {
+			return fmt.Errorf("%s: roles require authentication (auth key has no roles)", name)
+		}
+	}
+	return nil
+}
+
+//CallAuthorization is DepsMap key of context of call in modules that authorize each call
+//(see AddCallAuthHelpers), modules with principal dependency without it authorize requests by route.
+const CallAuthorization = "callAuthorization"
+
+//makeAccessGuard rejects call of function that is not public or is not allowed to principal
+//in module which authorizes each call. Module which does not authenticate requests (module
+//dependencies have no principal) rejects every function that is not public.
+func makeAccessGuard(info *PackageInfo, fn parser.Function, g *Group, deps DepsMap, errGuard IfErrorGuard) {
+	access := GetAccess(info, fn)
+	if access.Public {
+		return
+	}
+	if ctx, ok := deps[CallAuthorization]; ok {
+		args := []Code{ctx, Lit(functionName(fn))}
+		for _, role := range access.Roles {
+			args = append(args, Lit(role))
+		}
+		errGuard(g, Err().Op("=").Id(AuthorizeHelper).Call(args...))
+		return
+	}
+	if _, ok := deps[DepPrincipal.Name]; ok {
+		return
+	}
+	errGuard(g, Err().Op("=").Qual("errors", "New").Call(
+		Lit(fmt.Sprintf("forbidden: %s requires authentication", functionName(fn))),
+	))
+}
+
+//makeRouteAccess creates maps of public routes and roles required by routes of
+//authenticated HTTP module.
+func makeRouteAccess(info *PackageInfo, f *File, route func(parser.Function) string) {
+	public, roles := Dict{}, Dict{}
+	ForEachFunction(info, true, func(fn parser.Function) {
+		access := GetAccess(info, fn)
+		switch {
+		case access.Public:
+			public[Lit(route(fn))] = True()
+		case len(access.Roles) != 0:
+			var list []Code
+			for _, role := range access.Roles {
+				list = append(list, Lit(role))
+			}
+			roles[Lit(route(fn))] = Values(list...)
+		}
+	})
+	f.Var().Id("publicRoutes").Op("=").Map(String()).Bool().Values(public)
+	f.Var().Id("routeRoles").Op("=").Map(String()).Index().String().Values(roles)
+}
+
+//GetAPIDescription returns JSON description of functions and their access, it is
+//written to tie_modules to audit which functions are public.
+func GetAPIDescription(info *PackageInfo) []byte {
+	type function struct {
+		Name   string   `json:"name"`
+		Doc    string   `json:"doc,omitempty"`
+		Public bool     `json:"public"`
+		Roles  []string `json:"roles,omitempty"`
+	}
+	description := struct {
+		Package        string     `json:"package"`
+		Authentication string     `json:"authentication,omitempty"`
+		Functions      []function `json:"functions"`
+	}{Package: info.ModulePath, Functions: []function{}}
+	if IsAuth(info) {
+		description.Authentication = authentication(info.Service).Type
+	}
+	ForEachFunction(info, true, func(fn parser.Function) {
+		access := GetAccess(info, fn)
+		description.Functions = append(description.Functions, function{
+			Name: functionName(fn), Doc: fn.Doc, Public: access.Public, Roles: access.Roles,
+		})
+	})
+	data, _ := json.MarshalIndent(description, "", "  ")
+	return append(data, '\n')
+}
@@ -0,0 +1,38 @@
+package template
+
+import (
+	"testing"
+
+	"github.com/angrypie/tie/parser"
+	"github.com/angrypie/tie/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetAccess(t *testing.T) {
+	admin := parser.Directive{Name: AuthDirective, Args: map[string]string{"role": "admin,ops"}}
+	public := parser.Directive{Name: PublicDirective, Args: map[string]string{}}
+	info := &PackageInfo{Service: &types.Service{Authentication: &types.Authentication{Type: AuthKeys}}}
+	info.Functions = []parser.Function{
+		{Name: "Hello"},
+		{Name: "Ping", Directives: []parser.Directive{public}},
+		{Name: "Reset", Directives: []parser.Directive{admin}},
+	}
+	require.NoError(t, ValidateAccess(info))
+	require.Equal(t, Access{}, GetAccess(info, info.Functions[0]))
+	require.Equal(t, Access{Public: true, Explicit: true}, GetAccess(info, info.Functions[1]))
+	require.Equal(t, Access{Roles: []string{"admin", "ops"}, Explicit: true}, GetAccess(info, info.Functions[2]))
+
+	info.Functions[2].Directives = append(info.Functions[2].Directives, public)
+	require.EqualError(t, ValidateAccess(info), "Reset: //tie:auth and //tie:public can't be used together")
+
+	info.Functions[2].Directives = []parser.Directive{{Name: AuthDirective, Args: map[string]string{"user": "bob"}}}
+	require.EqualError(t, ValidateAccess(info), "Reset: //tie:auth accepts only role=name[,name]")
+
+	info.Service = &types.Service{Auth: "key"}
+	info.Functions[2].Directives = []parser.Directive{admin}
+	require.EqualError(t, ValidateAccess(info), "Reset: roles require authentication (auth key has no roles)")
+
+	info.Service = &types.Service{}
+	require.EqualError(t, ValidateAccess(info), "Reset: //tie:auth requires auth or authentication in service config")
+	require.Equal(t, Access{Public: true}, GetAccess(info, info.Functions[0]))
+}
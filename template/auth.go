@@ -0,0 +1,620 @@
+package template
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/angrypie/tie/parser"
+	"github.com/angrypie/tie/types"
+	. "github.com/dave/jennifer/jen"
+)
+
+//Authentication types (see types.Authentication).
+const (
+	AuthKeys  = "keys"
+	AuthJWT   = "jwt"
+	AuthBasic = "basic"
+)
+
+//AuthHelper authenticates request, it returns request with principal or writes
+//error response and returns false.
+const AuthHelper = "authHelper"
+
+const authPrincipalHelper = "authPrincipalHelper"
+const authFileHelper = "authFileHelper"
+const jwtKeysHelper = "jwtKeysHelper"
+const jwtVerifyHelper = "jwtVerifyHelper"
+const jwtSignatureHelper = "jwtSignatureHelper"
+const htpasswdHelper = "htpasswdHelper"
+
+//IsAuth returns true if requests of HTTP modules are authenticated.
+func IsAuth(info *PackageInfo) bool {
+	return info.Service.Auth != "" || info.Service.Authentication != nil
+}
+
+//ValidateAuth returns error if authentication configuration is incomplete.
+func ValidateAuth(info *PackageInfo) error {
+	auth := info.Service.Authentication
+	if auth == nil {
+		return nil
+	}
+	if info.Service.Auth != "" {
+		return fmt.Errorf("auth: static key can't be used with authentication")
+	}
+	switch auth.Type {
+	case AuthKeys:
+		for _, key := range auth.Keys {
+			if hash, err := hex.DecodeString(key.Hash); err != nil || len(hash) != 32 {
+				return fmt.Errorf("authentication: key of %q must be hex encoded SHA-256 hash", key.Principal)
+			}
+			if key.Principal == "" {
+				return fmt.Errorf("authentication: key %s has no principal", key.Hash)
+			}
+		}
+	case AuthJWT, AuthBasic:
+		if auth.File == "" {
+			return fmt.Errorf("authentication: %s requires file", auth.Type)
+		}
+	default:
+		return fmt.Errorf("authentication: unknown type %q", auth.Type)
+	}
+	return nil
+}
+
+//authentication returns authentication configuration, static key is keys authentication
+//with plain key (it is kept for compatibility).
+func authentication(service *types.Service) types.Authentication {
+	if service.Authentication != nil {
+		return *service.Authentication
+	}
+	return types.Authentication{Type: AuthKeys}
+}
+
+//AddAuthHelpers creates helpers that authenticate and authorize requests of HTTP modules
+//(route returns path of function). Credentials are compared in constant time, files are
+//read again when they are changed (keys can be rotated without restart).
+func AddAuthHelpers(info *PackageInfo, f *File, route func(parser.Function) string) {
+	if !IsAuth(info) {
+		return
+	}
+	auth := authentication(info.Service)
+
+	w, r := Id("w").Qual("net/http", "ResponseWriter"), Id("r").Op("*").Qual("net/http", "Request")
+	status := func(code string, message Code) []Code {
+		return []Code{
+			Id("w").Dot("Header").Call().Dot("Set").Call(Lit("Content-Type"), Lit("application/json")),
+			Id("w").Dot("WriteHeader").Call(Qual("net/http", code)),
+			Qual("encoding/json", "NewEncoder").Call(Id("w")).Dot("Encode").Call(
+				Map(String()).String().Values(Dict{Lit("err"): message}),
+			),
+		}
+	}
+	makeRouteAccess(info, f, route)
+	addPrincipalAuth(info, f)
+
+	//Missing credentials are bad request, invalid ones are unauthorized (reason is not sent to client).
+	//Public routes are served without credentials, principal is set if credentials are valid.
+	f.Func().Id(AuthHelper).Params(w, r).Params(Op("*").Qual("net/http", "Request"), Bool()).BlockFunc(func(g *Group) {
+		g.List(Id("principal"), Id("roles"), Err()).Op(":=").Id(authPrincipalHelper).Call(Id("r"))
+		g.If(Id("publicRoutes").Index(Id("r").Dot("URL").Dot("Path"))).Block(
+			If(Err().Op("!=").Nil()).Block(Return(Id("r"), True())),
+			Return(Id(WithPrincipalHelper).Call(Id("r"), Id("principal")), True()),
+		)
+		g.If(Err().Op("!=").Nil()).BlockFunc(func(g *Group) {
+			if auth.Type == AuthBasic {
+				g.Id("w").Dot("Header").Call().Dot("Set").Call(Lit("WWW-Authenticate"), Lit(`Basic realm="tie"`))
+				g.If(Err().Op("==").Id("errAuthMissing")).Block(append(
+					status("StatusUnauthorized", Err().Dot("Error").Call()), Return(Nil(), False()),
+				)...)
+			} else {
+				g.If(Err().Op("==").Id("errAuthMissing")).Block(append(
+					status("StatusBadRequest", Err().Dot("Error").Call()), Return(Nil(), False()),
+				)...)
+			}
+			for _, c := range status("StatusUnauthorized", Lit("Unauthorized")) {
+				g.Add(c)
+			}
+			g.Return(Nil(), False())
+		})
+		g.Comment("Principal must have one of roles required by route")
+		g.If(List(Id("required"), Id("ok")).Op(":=").Id("routeRoles").Index(Id("r").Dot("URL").Dot("Path")), Id("ok")).Block(
+			Id("roles").Op("=").Append(Id("roles"), Id("principalRoles").Index(Id("principal")).Op("...")),
+			Id("allowed").Op(":=").False(),
+			For(List(Id("_"), Id("role")).Op(":=").Range().Id("roles")).Block(
+				For(List(Id("_"), Id("name")).Op(":=").Range().Id("required")).Block(
+					Id("allowed").Op("=").Id("allowed").Op("||").Id("role").Op("==").Id("name"),
+				),
+			),
+			If(Op("!").Id("allowed")).Block(append(
+				status("StatusForbidden", Lit("Forbidden")), Return(Nil(), False()),
+			)...),
+		)
+		g.Return(Id(WithPrincipalHelper).Call(Id("r"), Id("principal")), True())
+	})
+}
+
+//addPrincipalAuth creates authPrincipalHelper that authenticates credentials of request
+//and roles of principals from configuration.
+func addPrincipalAuth(info *PackageInfo, f *File) {
+	auth := authentication(info.Service)
+	missing := "missing key in request header"
+	if auth.Type == AuthBasic {
+		missing = "missing credentials in request header"
+	}
+
+	f.Var().Id("errAuthMissing").Op("=").Qual("errors", "New").Call(Lit(missing))
+
+	roles := Dict{}
+	for principal, list := range auth.Roles {
+		var values []Code
+		for _, role := range list {
+			values = append(values, Lit(role))
+		}
+		roles[Lit(principal)] = Values(values...)
+	}
+	f.Var().Id("principalRoles").Op("=").Map(String()).Index().String().Values(roles)
+
+	switch {
+	case info.Service.Auth != "":
+		addStaticKeyAuth(info, f)
+	case auth.Type == AuthKeys:
+		addKeysAuth(auth, f)
+	case auth.Type == AuthJWT:
+		addJWTAuth(auth, f)
+	case auth.Type == AuthBasic:
+		addBasicAuth(auth, f)
+	}
+	if auth.Type == AuthJWT || auth.Type == AuthBasic {
+		addAuthFileHelper(auth, f)
+	}
+}
+
+//AuthContextHelper authenticates credentials of call (func(context.Context, http.Header) context.Context),
+//principal and its roles or authentication error are stored in returned context.
+const AuthContextHelper = "authContextHelper"
+
+//AuthorizeHelper returns error if call with context is not allowed to call function
+//(func(ctx context.Context, function string, roles ...string) error).
+const AuthorizeHelper = "authorizeHelper"
+
+//AddCallAuthHelpers creates helpers that authenticate and authorize each call of modules
+//that don't route requests by function (JSON-RPC, MCP, WebSocket, go-micro, Dapr). Credentials
+//are taken from Authorization header or metadata, calls without them are rejected unless
+//function is public.
+func AddCallAuthHelpers(info *PackageInfo, f *File) {
+	if !IsAuth(info) {
+		return
+	}
+	addPrincipalAuth(info, f)
+
+	f.Type().Id("authStateKey").Struct()
+	f.Type().Id("authState").Struct(
+		Id("roles").Index().String(),
+		Id("err").Error(),
+	)
+
+	f.Func().Id(AuthContextHelper).Params(
+		Id("ctx").Qual("context", "Context"), Id("header").Qual("net/http", "Header"),
+	).Qual("context", "Context").Block(
+		List(Id("principal"), Id("roles"), Err()).Op(":=").Id(authPrincipalHelper).Call(
+			Op("&").Qual("net/http", "Request").Values(Dict{Id("Header"): Id("header")}),
+		),
+		If(Err().Op("!=").Nil()).Block(
+			Return(Qual("context", "WithValue").Call(Id("ctx"), Id("authStateKey").Values(), Id("authState").Values(Dict{
+				Id("err"): Err(),
+			}))),
+		),
+		Id("roles").Op("=").Append(Id("roles"), Id("principalRoles").Index(Id("principal")).Op("...")),
+		Id("ctx").Op("=").Qual("context", "WithValue").Call(Id("ctx"), Id(principalKey).Values(), Id("principal")),
+		Return(Qual("context", "WithValue").Call(Id("ctx"), Id("authStateKey").Values(), Id("authState").Values(Dict{
+			Id("roles"): Id("roles"),
+		}))),
+	)
+
+	//Reason of invalid credentials is not sent to client
+	f.Func().Id(AuthorizeHelper).Params(
+		Id("ctx").Qual("context", "Context"), Id("function").String(), Id("required").Op("...").String(),
+	).Error().Block(
+		List(Id("state"), Id("ok")).Op(":=").Id("ctx").Dot("Value").Call(Id("authStateKey").Values()).Assert(Id("authState")),
+		Switch().Block(
+			Case(Op("!").Id("ok").Op("||").Id("state").Dot("err").Op("==").Id("errAuthMissing")).Block(
+				Return(Qual("fmt", "Errorf").Call(Lit("forbidden: %s requires authentication"), Id("function"))),
+			),
+			Case(Id("state").Dot("err").Op("!=").Nil()).Block(
+				Return(Qual("errors", "New").Call(Lit("unauthorized"))),
+			),
+			Case(Len(Id("required")).Op("==").Lit(0)).Block(Return(Nil())),
+		),
+		For(List(Id("_"), Id("role")).Op(":=").Range().Id("state").Dot("roles")).Block(
+			For(List(Id("_"), Id("name")).Op(":=").Range().Id("required")).Block(
+				If(Id("role").Op("==").Id("name")).Block(Return(Nil())),
+			),
+		),
+		Return(Qual("fmt", "Errorf").Call(
+			Lit("forbidden: %s requires role %s"), Id("function"), Qual("strings", "Join").Call(Id("required"), Lit(",")),
+		)),
+	)
+}
+
+//bearerToken returns code that reads bearer token to token variable.
+func bearerToken(g *Group) {
+	g.Id("header").Op(":=").Id("r").Dot("Header").Dot("Get").Call(Lit("Authorization"))
+	g.If(Op("!").Qual("strings", "HasPrefix").Call(Id("header"), Lit("Bearer "))).Block(
+		Return(Lit(""), Nil(), Id("errAuthMissing")),
+	)
+	g.Id("token").Op(":=").Qual("strings", "TrimPrefix").Call(Id("header"), Lit("Bearer "))
+}
+
+//constantTimeCompare compares strings in constant time, result is 1 if they are equal.
+func constantTimeCompare(a, b Code) *Statement {
+	return Qual("crypto/subtle", "ConstantTimeCompare").Call(Index().Byte().Parens(a), Index().Byte().Parens(b))
+}
+
+//principalFunc declares helper that returns principal of request and its roles from
+//credentials (roles from configuration are added by AuthHelper).
+func principalFunc() *Statement {
+	return Func().Id(authPrincipalHelper).Params(Id("r").Op("*").Qual("net/http", "Request")).
+		Params(String(), Index().String(), Error())
+}
+
+//addStaticKeyAuth authenticates requests with service key (TIE_API_KEY environment variable
+//overrides key from configuration).
+func addStaticKeyAuth(info *PackageInfo, f *File) {
+	f.Add(principalFunc()).BlockFunc(func(g *Group) {
+		g.Id("key").Op(":=").Lit(info.Service.Auth)
+		g.If(Id("env").Op(":=").Id(GetEnvHelper).Call(Lit("TIE_API_KEY")), Id("env").Op("!=").Lit("")).Block(
+			Id("key").Op("=").Id("env"),
+		)
+		bearerToken(g)
+		g.If(constantTimeCompare(Id("token"), Id("key")).Op("!=").Lit(1)).Block(
+			Return(Lit(""), Nil(), Qual("errors", "New").Call(Lit("invalid key"))),
+		)
+		g.Return(Lit(DefaultPrincipal), Nil(), Nil())
+	})
+}
+
+//addKeysAuth authenticates requests with hashed API keys, additional keys can be passed
+//in TIE_AUTH_KEYS environment variable (comma separated principal:hash pairs).
+func addKeysAuth(auth types.Authentication, f *File) {
+	var keys []Code
+	for _, key := range auth.Keys {
+		keys = append(keys, Values(Lit(key.Principal), Lit(strings.ToLower(key.Hash))))
+	}
+	f.Add(principalFunc()).BlockFunc(func(g *Group) {
+		bearerToken(g)
+		g.Id("keys").Op(":=").Index().Index(Lit(2)).String().Values(keys...)
+		g.For(List(Id("_"), Id("pair")).Op(":=").Range().Qual("strings", "Split").Call(
+			Id(GetEnvHelper).Call(Lit("TIE_AUTH_KEYS")), Lit(","),
+		)).Block(
+			If(
+				Id("i").Op(":=").Qual("strings", "Index").Call(Id("pair"), Lit(":")),
+				Id("i").Op(">").Lit(0),
+			).Block(
+				Id("keys").Op("=").Append(Id("keys"), Index(Lit(2)).String().Values(
+					Qual("strings", "TrimSpace").Call(Id("pair").Index(Empty(), Id("i"))),
+					Qual("strings", "ToLower").Call(Qual("strings", "TrimSpace").Call(Id("pair").Index(Id("i").Op("+").Lit(1), Empty()))),
+				)),
+			),
+		)
+		g.Id("sum").Op(":=").Qual("crypto/sha256", "Sum256").Call(Index().Byte().Parens(Id("token")))
+		g.Id("hash").Op(":=").Qual("encoding/hex", "EncodeToString").Call(Id("sum").Index(Empty(), Empty()))
+		g.Comment("All keys are compared to not reveal position of matching key")
+		g.Id("principal").Op(":=").Lit("")
+		g.For(List(Id("_"), Id("key")).Op(":=").Range().Id("keys")).Block(
+			If(constantTimeCompare(Id("hash"), Id("key").Index(Lit(1))).Op("==").Lit(1)).Block(
+				Id("principal").Op("=").Id("key").Index(Lit(0)),
+			),
+		)
+		g.If(Id("principal").Op("==").Lit("")).Block(
+			Return(Lit(""), Nil(), Qual("errors", "New").Call(Lit("invalid key"))),
+		)
+		g.Return(Id("principal"), Nil(), Nil())
+	})
+}
+
+//addAuthFileHelper creates helper that parses authentication file, file is parsed
+//again when it is changed. TIE_AUTH_FILE environment variable overrides file path.
+func addAuthFileHelper(auth types.Authentication, f *File) {
+	f.Var().Id("authFile").Struct(
+		Qual("sync", "Mutex"),
+		Id("path").String(),
+		Id("modified").Qual("time", "Time"),
+		Id("value").Interface(),
+	)
+	f.Func().Id(authFileHelper).Params(
+		Id("parse").Func().Params(Index().Byte()).Params(Interface(), Error()),
+	).Params(Interface(), Error()).Block(
+		Id("path").Op(":=").Lit(auth.File),
+		If(Id("env").Op(":=").Id(GetEnvHelper).Call(Lit("TIE_AUTH_FILE")), Id("env").Op("!=").Lit("")).Block(
+			Id("path").Op("=").Id("env"),
+		),
+		List(Id("stat"), Err()).Op(":=").Qual("os", "Stat").Call(Id("path")),
+		If(Err().Op("!=").Nil()).Block(Return(Nil(), Err())),
+		Id("authFile").Dot("Lock").Call(),
+		Defer().Id("authFile").Dot("Unlock").Call(),
+		If(
+			Id("authFile").Dot("path").Op("==").Id("path").Op("&&").
+				Id("authFile").Dot("modified").Dot("Equal").Call(Id("stat").Dot("ModTime").Call()),
+		).Block(Return(Id("authFile").Dot("value"), Nil())),
+		List(Id("data"), Err()).Op(":=").Qual("io/ioutil", "ReadFile").Call(Id("path")),
+		If(Err().Op("!=").Nil()).Block(Return(Nil(), Err())),
+		List(Id("value"), Err()).Op(":=").Id("parse").Call(Id("data")),
+		If(Err().Op("!=").Nil()).Block(Return(Nil(), Err())),
+		List(Id("authFile").Dot("path"), Id("authFile").Dot("modified"), Id("authFile").Dot("value")).Op("=").
+			List(Id("path"), Id("stat").Dot("ModTime").Call(), Id("value")),
+		Return(Id("value"), Nil()),
+	)
+}
+
+//addBasicAuth authenticates requests with users from htpasswd file (bcrypt and SHA1 entries).
+func addBasicAuth(auth types.Authentication, f *File) {
+	f.Add(principalFunc()).Block(
+		List(Id("user"), Id("password"), Id("ok")).Op(":=").Id("r").Dot("BasicAuth").Call(),
+		If(Op("!").Id("ok")).Block(Return(Lit(""), Nil(), Id("errAuthMissing"))),
+		List(Id("users"), Err()).Op(":=").Id(authFileHelper).Call(Id(htpasswdHelper)),
+		If(Err().Op("!=").Nil()).Block(Return(Lit(""), Nil(), Err())),
+		List(Id("hash"), Id("ok")).Op(":=").Id("users").Assert(Map(String()).String()).Index(Id("user")),
+		Switch().Block(
+			Case(Op("!").Id("ok")).Block(
+				Return(Lit(""), Nil(), Qual("errors", "New").Call(Lit("unknown user"))),
+			),
+			Case(Qual("strings", "HasPrefix").Call(Id("hash"), Lit("$2"))).Block(
+				Err().Op("=").Qual("golang.org/x/crypto/bcrypt", "CompareHashAndPassword").Call(
+					Index().Byte().Parens(Id("hash")), Index().Byte().Parens(Id("password")),
+				),
+			),
+			Case(Qual("strings", "HasPrefix").Call(Id("hash"), Lit("{SHA}"))).Block(
+				Id("sum").Op(":=").Qual("crypto/sha1", "Sum").Call(Index().Byte().Parens(Id("password"))),
+				If(constantTimeCompare(
+					Qual("encoding/base64", "StdEncoding").Dot("EncodeToString").Call(Id("sum").Index(Empty(), Empty())),
+					Id("hash").Index(Lit(5), Empty()),
+				).Op("!=").Lit(1)).Block(Err().Op("=").Qual("errors", "New").Call(Lit("invalid password"))),
+			),
+			Default().Block(
+				Err().Op("=").Qual("fmt", "Errorf").Call(Lit("unsupported hash of user %s"), Id("user")),
+			),
+		),
+		If(Err().Op("!=").Nil()).Block(Return(Lit(""), Nil(), Err())),
+		Return(Id("user"), Nil(), Nil()),
+	)
+
+	//htpasswdHelper parses user:hash lines.
+	f.Func().Id(htpasswdHelper).Params(Id("data").Index().Byte()).Params(Interface(), Error()).Block(
+		Id("users").Op(":=").Make(Map(String()).String()),
+		For(List(Id("_"), Id("line")).Op(":=").Range().Qual("strings", "Split").Call(String().Parens(Id("data")), Lit("\n"))).Block(
+			Id("line").Op("=").Qual("strings", "TrimSpace").Call(Id("line")),
+			If(Id("i").Op(":=").Qual("strings", "Index").Call(Id("line"), Lit(":")), Id("i").Op(">").Lit(0)).Block(
+				Id("users").Index(Id("line").Index(Empty(), Id("i"))).Op("=").Id("line").Index(Id("i").Op("+").Lit(1), Empty()),
+			),
+		),
+		Return(Id("users"), Nil()),
+	)
+}
+
+//addJWTAuth authenticates requests with bearer JWT signed by one of keys from JWKS or PEM
+//file (RS*, PS*, ES* and EdDSA algorithms), principal is token subject. Token must not
+//be expired, issuer and audience are checked if they are configured. Roles are taken
+//from roles claim.
+func addJWTAuth(auth types.Authentication, f *File) {
+	f.Add(principalFunc()).BlockFunc(func(g *Group) {
+		bearerToken(g)
+		g.List(Id("keys"), Err()).Op(":=").Id(authFileHelper).Call(Id(jwtKeysHelper))
+		g.If(Err().Op("!=").Nil()).Block(Return(Lit(""), Nil(), Err()))
+		g.List(Id("claims"), Err()).Op(":=").Id(jwtVerifyHelper).Call(Id("token"), Id("keys").Assert(Index().Id("jwtKey")))
+		g.If(Err().Op("!=").Nil()).Block(Return(Lit(""), Nil(), Err()))
+		g.Id("now").Op(":=").Float64().Call(Qual("time", "Now").Call().Dot("Unix").Call())
+		g.Switch().Block(
+			Case(Id("claims").Dot("Exp").Op("==").Nil().Op("||").Id("now").Op(">=").Op("*").Id("claims").Dot("Exp")).Block(
+				Return(Lit(""), Nil(), Qual("errors", "New").Call(Lit("token is expired"))),
+			),
+			Case(Id("claims").Dot("Nbf").Op("!=").Nil().Op("&&").Id("now").Op("<").Op("*").Id("claims").Dot("Nbf")).Block(
+				Return(Lit(""), Nil(), Qual("errors", "New").Call(Lit("token is not valid yet"))),
+			),
+			Case(Id("claims").Dot("Sub").Op("==").Lit("")).Block(
+				Return(Lit(""), Nil(), Qual("errors", "New").Call(Lit("token has no subject"))),
+			),
+		)
+		if auth.Issuer != "" {
+			g.If(Id("claims").Dot("Iss").Op("!=").Lit(auth.Issuer)).Block(
+				Return(Lit(""), Nil(), Qual("errors", "New").Call(Lit("invalid token issuer"))),
+			)
+		}
+		if auth.Audience != "" {
+			//Audience is string or list of strings
+			g.Var().Id("audience").Index().String()
+			g.If(
+				Err().Op(":=").Qual("encoding/json", "Unmarshal").Call(Id("claims").Dot("Aud"), Op("&").Id("audience")),
+				Err().Op("!=").Nil(),
+			).Block(
+				Id("audience").Op("=").Index().String().Values(Lit("")),
+				Qual("encoding/json", "Unmarshal").Call(Id("claims").Dot("Aud"), Op("&").Id("audience").Index(Lit(0))),
+			)
+			g.Id("valid").Op(":=").False()
+			g.For(List(Id("_"), Id("aud")).Op(":=").Range().Id("audience")).Block(
+				Id("valid").Op("=").Id("valid").Op("||").Id("aud").Op("==").Lit(auth.Audience),
+			)
+			g.If(Op("!").Id("valid")).Block(
+				Return(Lit(""), Nil(), Qual("errors", "New").Call(Lit("invalid token audience"))),
+			)
+		}
+		//Roles claim is list of roles or space separated string
+		g.Var().Id("roles").Index().String()
+		g.If(
+			Err().Op(":=").Qual("encoding/json", "Unmarshal").Call(Id("claims").Dot("Roles"), Op("&").Id("roles")),
+			Err().Op("!=").Nil(),
+		).Block(
+			Var().Id("scope").String(),
+			Qual("encoding/json", "Unmarshal").Call(Id("claims").Dot("Roles"), Op("&").Id("scope")),
+			Return(Id("claims").Dot("Sub"), Qual("strings", "Fields").Call(Id("scope")), Nil()),
+		)
+		g.Return(Id("claims").Dot("Sub"), Id("roles"), Nil())
+	})
+
+	f.Type().Id("jwtKey").Struct(
+		List(Id("kid"), Id("alg")).String(),
+		Id("key").Qual("crypto", "PublicKey"),
+	)
+	f.Type().Id("jwtClaims").Struct(
+		List(Id("Sub"), Id("Iss")).String(),
+		List(Id("Aud"), Id("Roles")).Qual("encoding/json", "RawMessage"),
+		List(Id("Exp"), Id("Nbf")).Op("*").Float64(),
+	)
+
+	decode := Qual("encoding/base64", "RawURLEncoding").Dot("DecodeString")
+	bigInt := func(b Code) *Statement { return New(Qual("math/big", "Int")).Dot("SetBytes").Call(b) }
+	invalidKey := Return(Nil(), Qual("fmt", "Errorf").Call(Lit("invalid %s key %s"), Id("k").Dot("Kty"), Id("k").Dot("Kid")))
+
+	//jwtKeysHelper parses public keys and certificates (PEM) or JSON Web Key Set.
+	f.Func().Id(jwtKeysHelper).Params(Id("data").Index().Byte()).Params(Interface(), Error()).Block(
+		Var().Id("keys").Index().Id("jwtKey"),
+		If(List(Id("block"), Id("rest")).Op(":=").Qual("encoding/pem", "Decode").Call(Id("data")), Id("block").Op("!=").Nil()).Block(
+			For(Id("block").Op("!=").Nil()).Block(
+				Var().Id("key").Interface(),
+				Var().Err().Error(),
+				If(Id("block").Dot("Type").Op("==").Lit("CERTIFICATE")).Block(
+					Var().Id("cert").Op("*").Qual("crypto/x509", "Certificate"),
+					If(
+						List(Id("cert"), Err()).Op("=").Qual("crypto/x509", "ParseCertificate").Call(Id("block").Dot("Bytes")),
+						Err().Op("==").Nil(),
+					).Block(Id("key").Op("=").Id("cert").Dot("PublicKey")),
+				).Else().Block(
+					List(Id("key"), Err()).Op("=").Qual("crypto/x509", "ParsePKIXPublicKey").Call(Id("block").Dot("Bytes")),
+				),
+				If(Err().Op("!=").Nil()).Block(Return(Nil(), Err())),
+				Id("keys").Op("=").Append(Id("keys"), Id("jwtKey").Values(Dict{Id("key"): Id("key")})),
+				List(Id("block"), Id("rest")).Op("=").Qual("encoding/pem", "Decode").Call(Id("rest")),
+			),
+			Return(Id("keys"), Nil()),
+		),
+		Var().Id("set").Struct(
+			Id("Keys").Index().Struct(
+				List(Id("Kty"), Id("Kid"), Id("Alg"), Id("Crv"), Id("N"), Id("E"), Id("X"), Id("Y")).String(),
+			),
+		),
+		If(
+			Err().Op(":=").Qual("encoding/json", "Unmarshal").Call(Id("data"), Op("&").Id("set")),
+			Err().Op("!=").Nil(),
+		).Block(Return(Nil(), Err())),
+		Id("curves").Op(":=").Map(String()).Qual("crypto/elliptic", "Curve").Values(Dict{
+			Lit("P-256"): Qual("crypto/elliptic", "P256").Call(),
+			Lit("P-384"): Qual("crypto/elliptic", "P384").Call(),
+			Lit("P-521"): Qual("crypto/elliptic", "P521").Call(),
+		}),
+		For(List(Id("_"), Id("k")).Op(":=").Range().Id("set").Dot("Keys")).Block(
+			Id("key").Op(":=").Id("jwtKey").Values(Dict{Id("kid"): Id("k").Dot("Kid"), Id("alg"): Id("k").Dot("Alg")}),
+			List(Id("x"), Id("errX")).Op(":=").Add(decode).Call(Id("k").Dot("X")),
+			List(Id("y"), Id("errY")).Op(":=").Add(decode).Call(Id("k").Dot("Y")),
+			Switch(Id("k").Dot("Kty")).Block(
+				Case(Lit("RSA")).Block(
+					List(Id("n"), Id("errN")).Op(":=").Add(decode).Call(Id("k").Dot("N")),
+					List(Id("e"), Id("errE")).Op(":=").Add(decode).Call(Id("k").Dot("E")),
+					If(Id("errN").Op("!=").Nil().Op("||").Id("errE").Op("!=").Nil()).Block(invalidKey),
+					Id("key").Dot("key").Op("=").Op("&").Qual("crypto/rsa", "PublicKey").Values(Dict{
+						Id("N"): bigInt(Id("n")),
+						Id("E"): Int().Call(bigInt(Id("e")).Dot("Int64").Call()),
+					}),
+				),
+				Case(Lit("EC")).Block(
+					List(Id("curve"), Id("ok")).Op(":=").Id("curves").Index(Id("k").Dot("Crv")),
+					If(Op("!").Id("ok").Op("||").Id("errX").Op("!=").Nil().Op("||").Id("errY").Op("!=").Nil()).Block(invalidKey),
+					Id("key").Dot("key").Op("=").Op("&").Qual("crypto/ecdsa", "PublicKey").Values(Dict{
+						Id("Curve"): Id("curve"),
+						Id("X"):     bigInt(Id("x")),
+						Id("Y"):     bigInt(Id("y")),
+					}),
+				),
+				Case(Lit("OKP")).Block(
+					If(
+						Id("k").Dot("Crv").Op("!=").Lit("Ed25519").Op("||").Id("errX").Op("!=").Nil().Op("||").
+							Len(Id("x")).Op("!=").Qual("crypto/ed25519", "PublicKeySize"),
+					).Block(invalidKey),
+					Id("key").Dot("key").Op("=").Qual("crypto/ed25519", "PublicKey").Call(Id("x")),
+				),
+				Default().Block(Continue()),
+			),
+			Id("keys").Op("=").Append(Id("keys"), Id("key")),
+		),
+		Return(Id("keys"), Nil()),
+	)
+
+	//jwtVerifyHelper checks token signature with keys (key id and algorithm must match if
+	//both token and key have them) and returns token claims.
+	f.Func().Id(jwtVerifyHelper).Params(Id("token").String(), Id("keys").Index().Id("jwtKey")).
+		Params(Id("claims").Id("jwtClaims"), Err().Error()).Block(
+		Id("parts").Op(":=").Qual("strings", "Split").Call(Id("token"), Lit(".")),
+		If(Len(Id("parts")).Op("!=").Lit(3)).Block(
+			Return(Id("claims"), Qual("errors", "New").Call(Lit("malformed token"))),
+		),
+		Var().Id("header").Struct(List(Id("Alg"), Id("Kid")).String()),
+		List(Id("data"), Err()).Op(":=").Add(decode).Call(Id("parts").Index(Lit(0))),
+		If(Err().Op("==").Nil()).Block(
+			Err().Op("=").Qual("encoding/json", "Unmarshal").Call(Id("data"), Op("&").Id("header")),
+		),
+		If(Err().Op("!=").Nil()).Block(Return()),
+		List(Id("signature"), Err()).Op(":=").Add(decode).Call(Id("parts").Index(Lit(2))),
+		If(Err().Op("!=").Nil()).Block(Return()),
+		Id("signed").Op(":=").Index().Byte().Parens(Id("parts").Index(Lit(0)).Op("+").Lit(".").Op("+").Id("parts").Index(Lit(1))),
+		Id("verified").Op(":=").False(),
+		For(List(Id("_"), Id("key")).Op(":=").Range().Id("keys")).Block(
+			If(
+				Id("header").Dot("Kid").Op("!=").Lit("").Op("&&").Id("key").Dot("kid").Op("!=").Lit("").Op("&&").
+					Id("key").Dot("kid").Op("!=").Id("header").Dot("Kid").Op("||").
+					Id("key").Dot("alg").Op("!=").Lit("").Op("&&").Id("key").Dot("alg").Op("!=").Id("header").Dot("Alg"),
+			).Block(Continue()),
+			If(Id(jwtSignatureHelper).Call(Id("header").Dot("Alg"), Id("key").Dot("key"), Id("signed"), Id("signature"))).Block(
+				Id("verified").Op("=").True(),
+				Break(),
+			),
+		),
+		If(Op("!").Id("verified")).Block(
+			Return(Id("claims"), Qual("errors", "New").Call(Lit("invalid token signature"))),
+		),
+		If(List(Id("data"), Err()).Op("=").Add(decode).Call(Id("parts").Index(Lit(1))), Err().Op("!=").Nil()).Block(Return()),
+		Err().Op("=").Qual("encoding/json", "Unmarshal").Call(Id("data"), Op("&").Id("claims")),
+		Return(),
+	)
+
+	hashes := Dict{}
+	for _, size := range []string{"256", "384", "512"} {
+		hashes[Lit(size)] = Qual("crypto", "SHA"+size)
+	}
+	//jwtSignatureHelper verifies signature, algorithm must match key type.
+	f.Func().Id(jwtSignatureHelper).Params(
+		Id("alg").String(), Id("key").Qual("crypto", "PublicKey"), List(Id("signed"), Id("signature")).Index().Byte(),
+	).Bool().Block(
+		If(List(Id("k"), Id("ok")).Op(":=").Id("key").Assert(Qual("crypto/ed25519", "PublicKey")), Id("alg").Op("==").Lit("EdDSA")).Block(
+			Return(Id("ok").Op("&&").Qual("crypto/ed25519", "Verify").Call(Id("k"), Id("signed"), Id("signature"))),
+		),
+		If(Len(Id("alg")).Op("!=").Lit(5)).Block(Return(False())),
+		List(Id("hash"), Id("ok")).Op(":=").Map(String()).Qual("crypto", "Hash").Values(hashes).Index(Id("alg").Index(Lit(2), Empty())),
+		If(Op("!").Id("ok")).Block(Return(False())),
+		Id("h").Op(":=").Id("hash").Dot("New").Call(),
+		Id("h").Dot("Write").Call(Id("signed")),
+		Id("digest").Op(":=").Id("h").Dot("Sum").Call(Nil()),
+		Switch(Id("k").Op(":=").Id("key").Assert(Type())).Block(
+			Case(Op("*").Qual("crypto/rsa", "PublicKey")).Block(
+				Switch(Id("alg").Index(Empty(), Lit(2))).Block(
+					Case(Lit("RS")).Block(Return(
+						Qual("crypto/rsa", "VerifyPKCS1v15").Call(Id("k"), Id("hash"), Id("digest"), Id("signature")).Op("==").Nil(),
+					)),
+					Case(Lit("PS")).Block(Return(
+						Qual("crypto/rsa", "VerifyPSS").Call(Id("k"), Id("hash"), Id("digest"), Id("signature"), Nil()).Op("==").Nil(),
+					)),
+				),
+			),
+			Case(Op("*").Qual("crypto/ecdsa", "PublicKey")).Block(
+				Id("size").Op(":=").Parens(Id("k").Dot("Curve").Dot("Params").Call().Dot("BitSize").Op("+").Lit(7)).Op("/").Lit(8),
+				If(Id("alg").Index(Empty(), Lit(2)).Op("!=").Lit("ES").Op("||").Len(Id("signature")).Op("!=").Lit(2).Op("*").Id("size")).Block(
+					Return(False()),
+				),
+				Return(Qual("crypto/ecdsa", "Verify").Call(
+					Id("k"), Id("digest"),
+					bigInt(Id("signature").Index(Empty(), Id("size"))),
+					bigInt(Id("signature").Index(Id("size"), Empty())),
+				)),
+			),
+		),
+		Return(False()),
+	)
+}
@@ -0,0 +1,32 @@
+package template
+
+import (
+	"testing"
+
+	"github.com/angrypie/tie/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateAuth(t *testing.T) {
+	auth := &types.Authentication{Type: AuthKeys, Keys: []types.APIKey{
+		{Principal: "billing", Hash: "2c70e12b7a0646f92279f427c7b38e7334d8e5389cff167a1dc30e73f826b683"},
+	}}
+	info := &PackageInfo{Service: &types.Service{Authentication: auth}}
+	require.NoError(t, ValidateAuth(info))
+	require.True(t, IsAuth(info))
+
+	auth.Keys[0].Hash = "key"
+	require.EqualError(t, ValidateAuth(info), `authentication: key of "billing" must be hex encoded SHA-256 hash`)
+
+	auth.Type = AuthJWT
+	require.EqualError(t, ValidateAuth(info), "authentication: jwt requires file")
+	auth.File = "jwks.json"
+	require.NoError(t, ValidateAuth(info))
+
+	info.Service.Auth = "key"
+	require.EqualError(t, ValidateAuth(info), "auth: static key can't be used with authentication")
+
+	info.Service.Authentication = &types.Authentication{Type: "oauth"}
+	info.Service.Auth = ""
+	require.EqualError(t, ValidateAuth(info), `authentication: unknown type "oauth"`)
+}
@@ -0,0 +1,228 @@
+package template
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/angrypie/tie/parser"
+	. "github.com/dave/jennifer/jen"
+)
+
+//ConfigKey returns configuration key of top level receiver constructor argument
+//(e.g. provider.db_name), it is also used as command line flag name.
+func ConfigKey(receiverType, arg string) string {
+	return ToSnakeCase(TrimPrefix(receiverType)) + "." + ToSnakeCase(arg)
+}
+
+//ConfigEnv returns environment variable name for configuration key (e.g. PROVIDER_DB_NAME).
+func ConfigEnv(key string) string {
+	return strings.ToUpper(strings.ReplaceAll(key, ".", "_"))
+}
+
+//isConfigurable returns true if constructor argument can be populated from configuration.
+func isConfigurable(field parser.Field, info *PackageInfo) bool {
+	if _, ok := GetDependency(field); ok {
+		return false
+	}
+	if _, ok := info.GetConstructor(field); ok {
+		return false
+	}
+	return !isFuncType(field.TypeName()) && !field.IsChan()
+}
+
+//configDefault returns raw default value from service configuration.
+//Strings are used as is, other values are encoded as JSON.
+func configDefault(info *PackageInfo, key string, field parser.Field) (raw string, ok bool) {
+	value, ok := info.Service.Config[key]
+	if !ok || value == nil {
+		return "", false
+	}
+	if str, isStr := value.(string); isStr {
+		return str, true
+	}
+	if field.TypeName() == "string" {
+		return fmt.Sprint(value), true
+	}
+	data, err := json.Marshal(normalizeYAML(value))
+	if err != nil {
+		log.Printf("WARN config %s: %s\n", key, err)
+		return "", false
+	}
+	return string(data), true
+}
+
+//normalizeYAML converts yaml maps to JSON compatible maps.
+func normalizeYAML(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			m[fmt.Sprint(key)] = normalizeYAML(item)
+		}
+		return m
+	case []interface{}:
+		for i, item := range v {
+			v[i] = normalizeYAML(item)
+		}
+	}
+	return value
+}
+
+//ValidateConfig returns error if configuration refers to unknown constructor arguments.
+func ValidateConfig(info *PackageInfo) error {
+	known := make(map[string]bool)
+	for _, c := range info.Constructors {
+		if !HasTopLevelReceiver(c.Function, info) {
+			continue
+		}
+		for _, arg := range c.Function.Arguments {
+			if !isConfigurable(arg, info) {
+				continue
+			}
+			key := ConfigKey(c.Receiver.TypeName(), arg.Name())
+			known[key] = true
+			getters, _ := getProviderGetters(arg)
+			for _, getter := range getters {
+				known[key+"."+ToSnakeCase(getter.Name())] = true
+			}
+		}
+	}
+	for key := range info.Service.Config {
+		if !known[key] {
+			return fmt.Errorf("config: unknown key %s", key)
+		}
+	}
+	for _, key := range info.Service.Required {
+		if !known[key] {
+			return fmt.Errorf("config: unknown required key %s", key)
+		}
+	}
+	return nil
+}
+
+//makeConfiguredCall declares constructor arguments with zero values, populates them
+//from configuration and returns arguments list for constructor call.
+func makeConfiguredCall(c Constructor, info *PackageInfo, g *Group, deps DepsMap) func(g *Group) {
+	required := make(map[string]bool)
+	for _, key := range info.Service.Required {
+		required[key] = true
+	}
+
+	ids := make(map[string]string)
+	for _, arg := range c.Function.Arguments {
+		if !isConfigurable(arg, info) {
+			continue
+		}
+		key := ConfigKey(c.Receiver.TypeName(), arg.Name())
+		id := ID("config", c.Receiver.TypeName(), arg.Name())
+		ids[arg.Name()] = id
+
+		//Each getter of provided interface has its own key (e.g. provider.config.user_name)
+		if getters, ok := getProviderGetters(arg); ok {
+			g.Var().Id(id).Id(providerType(arg))
+			for _, getter := range getters {
+				getterKey := key + "." + ToSnakeCase(getter.Name())
+				addConfigValue(g, info, getterKey, getter, required[getterKey], Id(id).Dot(providerValue(getter)))
+			}
+			continue
+		}
+
+		g.Var().Id(id).Add(createTypeFromField(arg, info))
+		addConfigValue(g, info, key, arg, required[key], Id(id))
+	}
+
+	return CreateArgsList(c.Function.Arguments, func(arg *Statement, field parser.Field) *Statement {
+		if dep, ok := injectDependency(field, deps); ok {
+			return dep
+		}
+		if id, ok := ids[field.Name()]; ok && IsProvided(field) {
+			return Op("&").Id(id)
+		} else if ok {
+			return SpreadVariadic(Id(id), field)
+		}
+		return Nil()
+	})
+}
+
+//addConfigValue populates target from configuration value.
+func addConfigValue(g *Group, info *PackageInfo, key string, field parser.Field, required bool, target *Statement) {
+	def, hasDefault := configDefault(info, key, field)
+	AddIfErrorGuard(g, Err().Op("=").Id(configHelper).Call(
+		Lit(key), Lit(ConfigEnv(key)), Lit(def), Lit(hasDefault), Lit(required), Op("&").Add(target),
+	), "err", nil)
+}
+
+const configHelper = "configHelper"
+const lookupFlagHelper = "lookupFlagHelper"
+const decodeConfigHelper = "decodeConfigHelper"
+
+//AddConfigHelpers creates helpers that read configuration values from command line
+//flags (-key=value or -key value), environment variables and defaults.
+func AddConfigHelpers(f *File) {
+	f.Func().Id(lookupFlagHelper).Params(Id("name").String()).Params(Id("value").String(), Id("ok").Bool()).Block(
+		Id("args").Op(":=").Qual("os", "Args").Index(Lit(1), Empty()),
+		For(List(Id("i"), Id("arg")).Op(":=").Range().Id("args")).Block(
+			If(Op("!").Qual("strings", "HasPrefix").Call(Id("arg"), Lit("-"))).Block(Continue()),
+			Id("arg").Op("=").Qual("strings", "TrimLeft").Call(Id("arg"), Lit("-")),
+			If(Qual("strings", "HasPrefix").Call(Id("arg"), Id("name").Op("+").Lit("="))).Block(
+				Return(Qual("strings", "TrimPrefix").Call(Id("arg"), Id("name").Op("+").Lit("=")), True()),
+			),
+			If(Id("arg").Op("==").Id("name").Op("&&").Id("i").Op("+").Lit(1).Op("<").Len(Id("args"))).Block(
+				Return(Id("args").Index(Id("i").Op("+").Lit(1)), True()),
+			),
+		),
+		Return(Lit(""), False()),
+	)
+
+	//String kinds are used as is, durations are parsed, other values are decoded from JSON.
+	f.Func().Id(decodeConfigHelper).Params(Id("raw").String(), Id("target").Interface()).Error().Block(
+		If(
+			List(Id("d"), Id("ok")).Op(":=").Id("target").Assert(Op("*").Qual("time", "Duration")),
+			Id("ok"),
+		).Block(
+			List(Id("value"), Err()).Op(":=").Qual("time", "ParseDuration").Call(Id("raw")),
+			Op("*").Id("d").Op("=").Id("value"),
+			Return(Err()),
+		),
+		If(
+			Id("value").Op(":=").Qual("reflect", "ValueOf").Call(Id("target")).Dot("Elem").Call(),
+			Id("value").Dot("Kind").Call().Op("==").Qual("reflect", "String"),
+		).Block(
+			Id("value").Dot("SetString").Call(Id("raw")),
+			Return(Nil()),
+		),
+		Return(Qual("encoding/json", "Unmarshal").Call(Index().Byte().Parens(Id("raw")), Id("target"))),
+	)
+
+	f.Func().Id(configHelper).Params(
+		List(Id("key"), Id("env"), Id("def")).String(),
+		List(Id("hasDefault"), Id("required")).Bool(),
+		Id("target").Interface(),
+	).Error().Block(
+		List(Id("raw"), Id("ok")).Op(":=").Id(lookupFlagHelper).Call(Id("key")),
+		If(Op("!").Id("ok")).Block(
+			List(Id("raw"), Id("ok")).Op("=").Qual("os", "LookupEnv").Call(Id("env")),
+		),
+		If(Op("!").Id("ok").Op("&&").Id("hasDefault")).Block(
+			List(Id("raw"), Id("ok")).Op("=").List(Id("def"), True()),
+		),
+		If(Op("!").Id("ok")).Block(
+			If(Id("required")).Block(
+				Return(Qual("fmt", "Errorf").Call(
+					Lit("missing required configuration %s (flag -%s or environment variable %s)"),
+					Id("key"), Id("key"), Id("env"),
+				)),
+			),
+			Return(Nil()),
+		),
+		If(
+			Err().Op(":=").Id(decodeConfigHelper).Call(Id("raw"), Id("target")),
+			Err().Op("!=").Nil(),
+		).Block(
+			Return(Qual("fmt", "Errorf").Call(Lit("invalid configuration %s: %w"), Id("key"), Err())),
+		),
+		Return(Nil()),
+	)
+}
@@ -0,0 +1,105 @@
+package template
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/angrypie/tie/types"
+)
+
+//DepsGraph is dependency graph of receiver constructors. Nodes are constructors
+//(keyed as in PackageInfo.Constructors), edges point to receivers required by constructor arguments.
+type DepsGraph struct {
+	constructors map[string]Constructor
+	edges        map[string][]string
+}
+
+//NewDepsGraph creates dependency graph from package constructors.
+func NewDepsGraph(info *PackageInfo) *DepsGraph {
+	graph := &DepsGraph{
+		constructors: info.Constructors,
+		edges:        make(map[string][]string),
+	}
+	for key, c := range info.Constructors {
+		for _, arg := range c.Function.Arguments {
+			if _, ok := info.GetConstructor(arg); ok {
+				graph.edges[key] = append(graph.edges[key], constructorKey(arg))
+			}
+		}
+	}
+	return graph
+}
+
+//CycleError is returned when receiver constructors depend on each other.
+type CycleError struct {
+	//Receivers is list of receiver types that forms cycle, first and last elements are equal.
+	Receivers []string
+}
+
+func (e *CycleError) Error() string {
+	return fmt.Sprintf("receiver constructors dependency cycle: %s", strings.Join(e.Receivers, " -> "))
+}
+
+//Order returns constructors in instantiation order: each constructor goes after
+//constructors of its dependencies. All constructors are returned even if cycle
+//is detected, in this case error is *CycleError.
+func (graph *DepsGraph) Order() (order []Constructor, err error) {
+	const (
+		visiting = iota + 1
+		visited
+	)
+	state := make(map[string]int)
+	var stack []string
+
+	var visit func(key string)
+	visit = func(key string) {
+		switch state[key] {
+		case visited:
+			return
+		case visiting:
+			if err == nil {
+				err = graph.newCycleError(stack, key)
+			}
+			return
+		}
+		state[key] = visiting
+		stack = append(stack, key)
+		for _, dep := range graph.edges[key] {
+			visit(dep)
+		}
+		stack = stack[:len(stack)-1]
+		state[key] = visited
+		order = append(order, graph.constructors[key])
+	}
+
+	//Sort keys to make generated code stable
+	keys := make([]string, 0, len(graph.constructors))
+	for key := range graph.constructors {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		visit(key)
+	}
+	return
+}
+
+func (graph *DepsGraph) newCycleError(stack []string, key string) *CycleError {
+	start := 0
+	for i, k := range stack {
+		if k == key {
+			start = i
+		}
+	}
+	cycle := &CycleError{}
+	for _, k := range append(stack[start:], key) {
+		cycle.Receivers = append(cycle.Receivers, graph.constructors[k].Receiver.TypeName())
+	}
+	return cycle
+}
+
+func constructorKey(field types.Field) string {
+	_, path, local := field.TypeParts()
+	return path + "." + local
+}
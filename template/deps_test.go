@@ -0,0 +1,91 @@
+package template
+
+import (
+	"go/types"
+	"testing"
+
+	"github.com/angrypie/tie/parser"
+	. "github.com/dave/jennifer/jen"
+	"github.com/stretchr/testify/require"
+)
+
+//newTestInfo creates package info with constructors, deps maps receiver type to its dependencies.
+func newTestInfo(deps map[string][]string) *PackageInfo {
+	pkg := types.NewPackage("example.com/deps", "deps")
+	named := make(map[string]types.Type)
+	typeOf := func(name string) types.Type {
+		if _, ok := named[name]; !ok {
+			obj := types.NewTypeName(0, pkg, name, nil)
+			named[name] = types.NewPointer(types.NewNamed(obj, types.NewStruct(nil, nil), nil))
+		}
+		return named[name]
+	}
+
+	info := &PackageInfo{Constructors: make(map[string]Constructor)}
+	for name, list := range deps {
+		args := []parser.Field{parser.NewField(types.NewVar(0, pkg, "label", types.Typ[types.String]))}
+		for _, dep := range list {
+			args = append(args, parser.NewField(types.NewVar(0, pkg, "dep"+dep, typeOf(dep))))
+		}
+		receiver := parser.NewField(types.NewVar(0, pkg, "receiver", typeOf(name)))
+		fn := parser.Function{Name: "New" + name, Arguments: args}
+		info.Constructors[constructorKey(receiver)] = *NewTypeConstructor(fn, receiver)
+	}
+	return info
+}
+
+func TestDepsGraphOrder(t *testing.T) {
+	info := newTestInfo(map[string][]string{
+		"UserModel": {"API"},
+		"API":       {"User", "Admin"},
+		"Admin":     {"User"},
+		"User":      nil,
+	})
+
+	order, err := NewDepsGraph(info).Order()
+	require.NoError(t, err)
+	require.Len(t, order, 4)
+
+	position := make(map[string]int)
+	for i, c := range order {
+		position[c.Receiver.TypeName()] = i
+	}
+	require.Less(t, position["User"], position["Admin"])
+	require.Less(t, position["Admin"], position["API"])
+	require.Less(t, position["API"], position["UserModel"])
+}
+
+func TestDepsGraphCycle(t *testing.T) {
+	info := newTestInfo(map[string][]string{
+		"A": {"B"},
+		"B": {"C"},
+		"C": {"A"},
+		"D": nil,
+	})
+
+	order, err := NewDepsGraph(info).Order()
+	require.Len(t, order, 4)
+	cycle, ok := err.(*CycleError)
+	require.True(t, ok)
+	require.Equal(t, []string{"A", "B", "C", "A"}, cycle.Receivers)
+	require.EqualError(t, err, "receiver constructors dependency cycle: A -> B -> C -> A")
+}
+
+func TestReceiverInstanceCycle(t *testing.T) {
+	info := newTestInfo(map[string][]string{
+		"A": {"B"},
+		"B": {"A"},
+	})
+
+	var a Constructor
+	for _, c := range info.Constructors {
+		if c.Receiver.TypeName() == "A" {
+			a = c
+		}
+	}
+	guard := func(g *Group, statement *Statement) {}
+	err := makeReceiverInstance(info, a, &Group{}, DefaultDeps(), guard, "resource", "a", "request.A", nil)
+	cycle, ok := err.(*CycleError)
+	require.True(t, ok)
+	require.Equal(t, []string{"A", "B", "A"}, cycle.Receivers)
+}
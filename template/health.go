@@ -0,0 +1,95 @@
+package template
+
+import (
+	"github.com/angrypie/tie/parser"
+	. "github.com/dave/jennifer/jen"
+)
+
+//Health endpoints of HTTP servers (see MakeListenAndServe).
+const (
+	LivenessRoute  = "/healthz"
+	ReadinessRoute = "/readyz"
+)
+
+//HealthReadyHelper returns error if service is not ready to handle requests.
+const HealthReadyHelper = "HealthReady"
+
+//HealthHandlerHelper wraps http.Handler with health endpoints.
+const HealthHandlerHelper = "HealthHandler"
+
+const readyFlag = "readyFlag"
+
+//readyPending is number of servers that are not started yet.
+const readyPending = "readyPending"
+
+//isHealthHook returns true for package level Health() error function.
+func isHealthHook(fn parser.Function) bool {
+	return fn.Name == "Health" && !HasReceiver(fn) && len(fn.Arguments) == 0 && len(fn.Results.List()) == 1
+}
+
+//MakeReady marks server as ready, modules call it when server listens for requests.
+func MakeReady(info *PackageInfo, g *Group) {
+	g.Add(Lifecycle(info, ReadyHelper)).Call()
+}
+
+//makeSetReady marks service as ready (true) or not ready.
+func makeSetReady(g *Group, ready bool) {
+	value := 0
+	if ready {
+		value = 1
+	}
+	g.Qual("sync/atomic", "StoreInt32").Call(Op("&").Id(readyFlag), Lit(value))
+}
+
+//AddHealthHelpers creates readiness check and HTTP health endpoints. Service is ready
+//after InitService and receivers constructors succeed and all servers listen for requests
+//and until shutdown is started, package Health function is called on each readiness check.
+func AddHealthHelpers(info *PackageInfo, f *File) {
+	f.Var().Defs(Id(readyFlag).Int32(), Id(readyPending).Int32())
+
+	f.Comment("Ready marks server as ready, service is ready when all servers are ready.")
+	f.Func().Id(ReadyHelper).Params().Block(
+		If(Qual("sync/atomic", "AddInt32").Call(Op("&").Id(readyPending), Lit(-1)).Op("==").Lit(0)).Block(
+			Qual("sync/atomic", "StoreInt32").Call(Op("&").Id(readyFlag), Lit(1)),
+		),
+	)
+
+	f.Func().Id(HealthReadyHelper).Params().Error().BlockFunc(func(g *Group) {
+		g.If(Qual("sync/atomic", "LoadInt32").Call(Op("&").Id(readyFlag)).Op("==").Lit(0)).Block(
+			Return(Qual("errors", "New").Call(Lit("service is not ready"))),
+		)
+		if info.IsHealth {
+			g.Return(Qual(info.GetServicePath(), "Health").Call())
+			return
+		}
+		g.Return(Nil())
+	})
+
+	w, r := Id("w").Qual("net/http", "ResponseWriter"), Id("r").Op("*").Qual("net/http", "Request")
+	status := func(code Code, value Code) []Code {
+		return []Code{
+			Id("w").Dot("Header").Call().Dot("Set").Call(Lit("Content-Type"), Lit("application/json")),
+			Id("w").Dot("WriteHeader").Call(code),
+			Qual("encoding/json", "NewEncoder").Call(Id("w")).Dot("Encode").Call(value),
+		}
+	}
+	//Health endpoints are served before other handlers (authentication is not required)
+	f.Func().Id(HealthHandlerHelper).Params(Id("next").Qual("net/http", "Handler")).Qual("net/http", "Handler").Block(
+		Return(Qual("net/http", "HandlerFunc").Call(Func().Params(w, r).Block(
+			Switch(Id("r").Dot("URL").Dot("Path")).Block(
+				Case(Lit(LivenessRoute)).Block(
+					status(Qual("net/http", "StatusOK"), Map(String()).String().Values(Dict{Lit("status"): Lit("ok")}))...,
+				),
+				Case(Lit(ReadinessRoute)).Block(append([]Code{
+					If(Err().Op(":=").Id(HealthReadyHelper).Call(), Err().Op("!=").Nil()).Block(append(
+						status(Qual("net/http", "StatusServiceUnavailable"), Map(String()).String().Values(Dict{
+							Lit("status"): Lit("unavailable"), Lit("err"): Err().Dot("Error").Call(),
+						})),
+						Return(),
+					)...),
+				}, status(Qual("net/http", "StatusOK"), Map(String()).String().Values(Dict{Lit("status"): Lit("ok")}))...)...),
+				Default().Block(Id("next").Dot("ServeHTTP").Call(Id("w"), Id("r"))),
+			),
+		))),
+	)
+}
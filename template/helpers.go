@@ -54,7 +54,11 @@ func HasReceiver(fn parser.Function) bool {
 }
 
 //HasTopLevelReceiver returns false if function has other receiver as argumenet.
+//Session receivers are never top level, they are created by OpenSession call.
 func HasTopLevelReceiver(fn parser.Function, info *PackageInfo) bool {
+	if isSessionConstructor(fn, info) {
+		return false
+	}
 	for _, field := range fn.Arguments {
 		if _, ok := info.GetConstructor(field); ok {
 			return false
@@ -111,22 +115,84 @@ func isConventionalConstructor(fn parser.Function) (receiver parser.Field, ok bo
 	return
 }
 
+//GetStreamResult returns receive-only channel result of streaming function.
+//Streaming function returns exactly one channel along with error.
+func GetStreamResult(fn parser.Function) (stream parser.Field, ok bool) {
+	results := fn.Results.List()
+	if len(results) != 2 {
+		return
+	}
+	if _, ok = results[0].RecvChanElem(); !ok {
+		return
+	}
+	return results[0], true
+}
+
+//HasChanArgument returns true if function takes channel, such functions are served only
+//by ws module (see GetStreamArgument).
+func HasChanArgument(fn parser.Function) bool {
+	for _, arg := range fn.Arguments {
+		if arg.IsChan() {
+			return true
+		}
+	}
+	return false
+}
+
+//GetStreamArgument returns receive-only channel argument of bidirectional
+//streaming function, that also returns stream (see GetStreamResult).
+func GetStreamArgument(fn parser.Function) (stream parser.Field, ok bool) {
+	if _, isStream := GetStreamResult(fn); !isStream {
+		return
+	}
+	for _, arg := range fn.Arguments {
+		if _, isChan := arg.RecvChanElem(); isChan {
+			if ok {
+				//Only one input stream is supported
+				return stream, false
+			}
+			stream, ok = arg, true
+		}
+	}
+	return
+}
+
+//IsContextField returns true if field has context.Context type.
+func IsContextField(field types.Field) bool {
+	_, path, local := field.TypeParts()
+	return path == "context" && local == "Context"
+}
+
 func TrimPrefix(str string) string {
 	return strings.TrimPrefix(str, "*")
 }
 
+var matchAllCap = regexp.MustCompile("([a-z0-9])([A-Z])")
+
+//ToSnakeCase converts camel case to snake case (e.g. UserName to user_name).
+func ToSnakeCase(str string) string {
+	return strings.ToLower(matchAllCap.ReplaceAllString(str, "${1}_${2}"))
+}
+
 var matchFuncType = regexp.MustCompile("^func.*")
 
 func isFuncType(t string) bool {
 	return matchFuncType.MatchString(t)
 }
 
-//filterNotReceiverArgs removes receivers args from filed list
+//filterHelperArgs removes top level receivers, function args and built-in
+//dependencies (injected on server side) from field list.
 func filterHelperArgs(fields []parser.Field, info *PackageInfo) (filtered []parser.Field) {
 	for _, field := range fields {
 		if cons, ok := info.GetConstructor(field); ok && HasTopLevelReceiver(cons.Function, info) {
 			continue
 		}
+		if isFuncType(field.TypeName()) {
+			continue
+		}
+		if _, ok := GetDependency(field); ok {
+			continue
+		}
 		filtered = append(filtered, field)
 	}
 	return
@@ -144,8 +210,9 @@ func MakeForEachReceiver(
 		receiversProcessed[receiver.TypeName()] = receiver
 		cb(receiver, constructor)
 	}
-	//Create receivers for each constructor
-	for _, c := range info.Constructors {
+	//Create receivers for each constructor, dependencies go first
+	constructors, _ := NewDepsGraph(info).Order()
+	for _, c := range constructors {
 		cbWrapper(c.Receiver, NewOptionalConstructor(c))
 	}
 
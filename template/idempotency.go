@@ -0,0 +1,460 @@
+package template
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/angrypie/tie/parser"
+	"github.com/angrypie/tie/types"
+	. "github.com/dave/jennifer/jen"
+)
+
+//IdempotencyKeyHeader is header that holds idempotency key of request, keyed functions
+//replay first response for duplicate keys.
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+//IdempotencyHelper replays stored response of request with idempotency key or returns
+//response writer that stores response of first request.
+const IdempotencyHelper = "idempotencyHelper"
+
+//Client helpers of idempotency key: withIdempotencyKeyHelper adds key to context of call
+//(it is reused by retries), idempotencyKeyHelper returns key of context.
+const (
+	WithIdempotencyKeyHelper = "withIdempotencyKeyHelper"
+	IdempotencyKeyHelper     = "idempotencyKeyHelper"
+)
+
+const idempotencyInitHelper = "idempotencyInitHelper"
+const idempotencyLoadHelper = "IdempotencyLoad"
+const idempotencySaveHelper = "IdempotencySave"
+
+const defaultIdempotencyTTL = 24 * time.Hour
+
+//idempotentDirective returns idempotent directive of method or of its receiver constructor.
+func idempotentDirective(info *PackageInfo, fn parser.Function) (directive parser.Directive, ok bool) {
+	if directive, ok = fn.GetDirective(IdempotentDirective); ok || !HasReceiver(fn) {
+		return
+	}
+	if c, isReceiver := info.GetConstructor(fn.Receiver); isReceiver {
+		return c.Function.GetDirective(IdempotentDirective)
+	}
+	return
+}
+
+//idempotencyConfig returns idempotency configuration of service.
+func idempotencyConfig(info *PackageInfo) types.Idempotency {
+	if info.Service.Idempotency == nil {
+		return types.Idempotency{}
+	}
+	return *info.Service.Idempotency
+}
+
+//parseTTL parses positive duration, fallback is returned if value is empty.
+func parseTTL(value string, fallback time.Duration) (time.Duration, error) {
+	if value == "" {
+		return fallback, nil
+	}
+	ttl, err := time.ParseDuration(value)
+	if err != nil || ttl <= 0 {
+		return 0, fmt.Errorf("ttl must be positive duration (e.g. 24h)")
+	}
+	return ttl, nil
+}
+
+//GetIdempotencyKey returns time response of function is kept for idempotency key, keyed is
+//false if function does not accept key. Directive ttl overrides ttl of service.
+func GetIdempotencyKey(info *PackageInfo, fn parser.Function) (ttl time.Duration, keyed bool, err error) {
+	config := idempotencyConfig(info)
+	if ttl, err = parseTTL(config.TTL, defaultIdempotencyTTL); err != nil {
+		return
+	}
+	for _, name := range config.Functions {
+		keyed = keyed || name == functionName(fn)
+	}
+	directive, ok := idempotentDirective(info, fn)
+	if !ok {
+		return
+	}
+	for arg := range directive.Args {
+		if arg != "key" && arg != "ttl" {
+			return 0, false, fmt.Errorf("//tie:idempotent accepts key and ttl")
+		}
+	}
+	_, hasKey := directive.Args["key"]
+	value, hasTTL := directive.Args["ttl"]
+	if hasTTL && !hasKey {
+		return 0, false, fmt.Errorf("//tie:idempotent ttl requires key")
+	}
+	if ttl, err = parseTTL(value, ttl); err != nil {
+		return
+	}
+	return ttl, keyed || hasKey, nil
+}
+
+//IsKeyed returns true if function accepts idempotency key.
+func IsKeyed(info *PackageInfo, fn parser.Function) bool {
+	_, keyed, _ := GetIdempotencyKey(info, fn)
+	return keyed
+}
+
+//UsesIdempotencyKeys returns true if any function accepts idempotency key.
+func UsesIdempotencyKeys(info *PackageInfo) bool {
+	uses := false
+	ForEachFunction(info, true, func(fn parser.Function) {
+		uses = uses || IsKeyed(info, fn)
+	})
+	return uses
+}
+
+//ValidateIdempotency returns error if idempotency configuration is malformed or keys can't
+//be accepted by servers of service.
+func ValidateIdempotency(info *PackageInfo) (err error) {
+	config := idempotencyConfig(info)
+	if _, err = parseTTL(config.TTL, 0); err != nil {
+		return fmt.Errorf("idempotency: %w", err)
+	}
+	names, keyed := make(map[string]bool), false
+	ForEachFunction(info, true, func(fn parser.Function) {
+		names[functionName(fn)] = true
+		_, isKeyed, e := GetIdempotencyKey(info, fn)
+		switch {
+		case err != nil:
+		case e != nil:
+			err = fmt.Errorf("%s: %w", functionName(fn), e)
+		case isKeyed && isStreamFunction(fn):
+			err = fmt.Errorf("%s: stream function can't accept idempotency key", functionName(fn))
+		}
+		keyed = keyed || isKeyed
+	})
+	if err != nil {
+		return
+	}
+	for _, name := range config.Functions {
+		if !names[name] {
+			return fmt.Errorf("idempotency: unknown function %s", name)
+		}
+	}
+	if config.Store == "state" && info.Service.State == nil {
+		return fmt.Errorf("idempotency: state store requires state configuration")
+	}
+	if keyed && !hasTransport(info.Service, "http") && !hasTransport(info.Service, "stdhttp") {
+		return fmt.Errorf("idempotency: keys are accepted only by http and stdhttp service types")
+	}
+	return nil
+}
+
+//makeIdempotencyInit initializes idempotency store after state store (it can keep responses).
+func makeIdempotencyInit(info *PackageInfo, g *Group) {
+	if !UsesIdempotencyKeys(info) {
+		return
+	}
+	config := idempotencyConfig(info)
+	g.If(
+		Err().Op(":=").Id(idempotencyInitHelper).Call(Lit(config.Store), Lit(config.Path)),
+		Err().Op("!=").Nil(),
+	).Block(
+		createErrLog("failed to start service"),
+		Id(ShutdownHelper).Call(),
+		Qual("os", "Exit").Call(Lit(1)),
+	)
+}
+
+//AddIdempotencyStoreHelpers creates idempotency stores of lifecycle package. Memory store is
+//default, state store keeps responses in state store of service (they survive restarts).
+func AddIdempotencyStoreHelpers(info *PackageInfo, f *File) {
+	if !UsesIdempotencyKeys(info) {
+		return
+	}
+	key := Id("key").String()
+	data := Id("data").Index().Byte()
+	ttl := Id("ttl").Qual("time", "Duration")
+
+	f.Comment("IdempotencyStore keeps responses of requests with idempotency key until they expire.")
+	f.Type().Id("IdempotencyStore").Interface(
+		Id("Load").Params(key).Params(data, Id("ok").Bool(), Err().Error()),
+		Id("Save").Params(key, data, ttl).Error(),
+	)
+
+	stores := Dict{Lit("memory"): Id("newMemoryIdempotencyStore")}
+	if info.Service.State != nil {
+		stores[Lit("state")] = Id("newStateIdempotencyStore")
+	}
+	f.Comment("IdempotencyStores is map of idempotency store constructors by store type, modules")
+	f.Comment("can register additional stores in init function.")
+	f.Var().Defs(
+		Id("IdempotencyStores").Op("=").Map(String()).Func().Params(String()).Params(Id("IdempotencyStore"), Error()).
+			Values(stores),
+		Id("idempotency").Id("IdempotencyStore"),
+	)
+	f.Type().Id("idempotencyEntry").Struct(
+		Id("Data").Index().Byte().Tag(map[string]string{"json": "data"}),
+		Id("Expires").Qual("time", "Time").Tag(map[string]string{"json": "expires"}),
+	)
+
+	//Memory store removes expired entries when there are too many of them.
+	f.Type().Id("memoryIdempotencyStore").Struct(
+		Id("mu").Qual("sync", "Mutex"),
+		Id("entries").Map(String()).Id("idempotencyEntry"),
+	)
+	f.Func().Id("newMemoryIdempotencyStore").Params(String()).Params(Id("IdempotencyStore"), Error()).Block(
+		Return(Op("&").Id("memoryIdempotencyStore").Values(Dict{
+			Id("entries"): Make(Map(String()).Id("idempotencyEntry")),
+		}), Nil()),
+	)
+	memory := Id("s").Op("*").Id("memoryIdempotencyStore")
+	f.Func().Params(memory).Id("Load").Params(key).Params(Index().Byte(), Bool(), Error()).Block(
+		Id("s").Dot("mu").Dot("Lock").Call(),
+		Defer().Id("s").Dot("mu").Dot("Unlock").Call(),
+		List(Id("entry"), Id("ok")).Op(":=").Id("s").Dot("entries").Index(Id("key")),
+		If(Op("!").Id("ok").Op("||").Qual("time", "Now").Call().Dot("After").Call(Id("entry").Dot("Expires"))).Block(
+			Delete(Id("s").Dot("entries"), Id("key")),
+			Return(Nil(), False(), Nil()),
+		),
+		Return(Id("entry").Dot("Data"), True(), Nil()),
+	)
+	f.Func().Params(memory).Id("Save").Params(key, data, ttl).Error().Block(
+		Id("s").Dot("mu").Dot("Lock").Call(),
+		Defer().Id("s").Dot("mu").Dot("Unlock").Call(),
+		Id("now").Op(":=").Qual("time", "Now").Call(),
+		If(Len(Id("s").Dot("entries")).Op(">=").Lit(10000)).Block(
+			For(List(Id("key"), Id("entry")).Op(":=").Range().Id("s").Dot("entries")).Block(
+				If(Id("now").Dot("After").Call(Id("entry").Dot("Expires"))).Block(
+					Delete(Id("s").Dot("entries"), Id("key")),
+				),
+			),
+		),
+		Id("s").Dot("entries").Index(Id("key")).Op("=").Id("idempotencyEntry").Values(Id("data"), Id("now").Dot("Add").Call(Id("ttl"))),
+		Return(Nil()),
+	)
+
+	if info.Service.State != nil {
+		//State store keeps entry with expiration time, expired entry is deleted when it is loaded.
+		f.Type().Id("stateIdempotencyStore").Struct()
+		f.Func().Id("newStateIdempotencyStore").Params(String()).Params(Id("IdempotencyStore"), Error()).Block(
+			Return(Id("stateIdempotencyStore").Values(), Nil()),
+		)
+		stored := Id("s").Id("stateIdempotencyStore")
+		f.Func().Params(stored).Id("Load").Params(key).Params(Index().Byte(), Bool(), Error()).Block(
+			List(Id("data"), Id("ok"), Err()).Op(":=").Id("state").Dot("Load").Call(Lit("idempotency/").Op("+").Id("key")),
+			If(Err().Op("!=").Nil().Op("||").Op("!").Id("ok")).Block(Return(Nil(), False(), Err())),
+			Var().Id("entry").Id("idempotencyEntry"),
+			If(
+				Err().Op(":=").Qual("encoding/json", "Unmarshal").Call(Id("data"), Op("&").Id("entry")),
+				Err().Op("!=").Nil(),
+			).Block(Return(Nil(), False(), Err())),
+			If(Qual("time", "Now").Call().Dot("After").Call(Id("entry").Dot("Expires"))).Block(
+				Return(Nil(), False(), Id("state").Dot("Delete").Call(Lit("idempotency/").Op("+").Id("key"))),
+			),
+			Return(Id("entry").Dot("Data"), True(), Nil()),
+		)
+		f.Func().Params(stored).Id("Save").Params(key, data, ttl).Error().Block(
+			List(Id("entry"), Err()).Op(":=").Qual("encoding/json", "Marshal").Call(
+				Id("idempotencyEntry").Values(Id("data"), Qual("time", "Now").Call().Dot("Add").Call(Id("ttl"))),
+			),
+			If(Err().Op("!=").Nil()).Block(Return(Err())),
+			Return(Id("state").Dot("Save").Call(Lit("idempotency/").Op("+").Id("key"), Id("entry"))),
+		)
+	}
+
+	//Store type and path can be changed by environment variables.
+	f.Func().Id(idempotencyInitHelper).Params(List(Id("store"), Id("path")).String()).Error().Block(
+		If(Id("s").Op(":=").Qual("os", "Getenv").Call(Lit("TIE_IDEMPOTENCY_STORE")), Id("s").Op("!=").Lit("")).Block(
+			Id("store").Op("=").Id("s"),
+		),
+		If(Id("p").Op(":=").Qual("os", "Getenv").Call(Lit("TIE_IDEMPOTENCY_PATH")), Id("p").Op("!=").Lit("")).Block(
+			Id("path").Op("=").Id("p"),
+		),
+		If(Id("store").Op("==").Lit("")).Block(Id("store").Op("=").Lit("memory")),
+		List(Id("create"), Id("ok")).Op(":=").Id("IdempotencyStores").Index(Id("store")),
+		If(Op("!").Id("ok")).Block(
+			Return(Qual("fmt", "Errorf").Call(Lit("unknown idempotency store %s"), Id("store"))),
+		),
+		Var().Err().Error(),
+		List(Id("idempotency"), Err()).Op("=").Id("create").Call(Id("path")),
+		Return(Err()),
+	)
+
+	f.Comment("IdempotencyLoad returns response stored for key.")
+	f.Func().Id(idempotencyLoadHelper).Params(key).Params(Index().Byte(), Bool(), Error()).Block(
+		Return(Id("idempotency").Dot("Load").Call(Id("key"))),
+	)
+	f.Comment("IdempotencySave stores response for key, it expires after ttl.")
+	f.Func().Id(idempotencySaveHelper).Params(key, data, ttl).Error().Block(
+		Return(Id("idempotency").Dot("Save").Call(Id("key"), Id("data"), Id("ttl"))),
+	)
+}
+
+//AddIdempotencyHelpers creates idempotencyHelper of HTTP modules (route returns path of function).
+//Response of first request with key is stored (unless it is server failure), duplicates wait
+//for first request and get the same response, request with different body is rejected with 422.
+//Key is scoped by route and principal.
+func AddIdempotencyHelpers(info *PackageInfo, f *File, route func(parser.Function) string) {
+	if !UsesIdempotencyKeys(info) {
+		return
+	}
+	routes := Dict{}
+	ForEachFunction(info, true, func(fn parser.Function) {
+		if ttl, keyed, _ := GetIdempotencyKey(info, fn); keyed {
+			routes[Lit(route(fn))] = Lit(int(ttl.Seconds())).Op("*").Qual("time", "Second")
+		}
+	})
+	w := Id("w").Qual("net/http", "ResponseWriter")
+	r := Id("r").Op("*").Qual("net/http", "Request")
+
+	f.Var().Id("idempotencyRoutes").Op("=").Map(String()).Qual("time", "Duration").Values(routes)
+	f.Type().Id("idempotencyRecord").Struct(
+		Id("Hash").String().Tag(map[string]string{"json": "hash"}),
+		Id("Status").Int().Tag(map[string]string{"json": "status"}),
+		Id("ContentType").String().Tag(map[string]string{"json": "content_type"}),
+		Id("Body").Index().Byte().Tag(map[string]string{"json": "body"}),
+	)
+	f.Var().Id("idempotencyPending").Op("=").Struct(
+		Qual("sync", "Mutex"),
+		Id("keys").Map(String()).Chan().Struct(),
+	).Values(Dict{Id("keys"): Make(Map(String()).Chan().Struct())})
+
+	//idempotencyWriter captures response to store it.
+	f.Type().Id("idempotencyWriter").Struct(
+		Qual("net/http", "ResponseWriter"),
+		Id("status").Int(),
+		Id("body").Qual("bytes", "Buffer"),
+	)
+	writer := Id("w").Op("*").Id("idempotencyWriter")
+	f.Func().Params(writer).Id("WriteHeader").Params(Id("status").Int()).Block(
+		If(Id("w").Dot("status").Op("==").Lit(0)).Block(Id("w").Dot("status").Op("=").Id("status")),
+		Id("w").Dot("ResponseWriter").Dot("WriteHeader").Call(Id("status")),
+	)
+	f.Func().Params(writer).Id("Write").Params(Id("data").Index().Byte()).Params(Int(), Error()).Block(
+		If(Id("w").Dot("status").Op("==").Lit(0)).Block(Id("w").Dot("status").Op("=").Qual("net/http", "StatusOK")),
+		Id("w").Dot("body").Dot("Write").Call(Id("data")),
+		Return(Id("w").Dot("ResponseWriter").Dot("Write").Call(Id("data"))),
+	)
+
+	f.Func().Id("idempotencyRejectHelper").Params(w, Id("status").Int(), Id("message").String()).Block(
+		Id("w").Dot("Header").Call().Dot("Set").Call(Lit("Content-Type"), Lit("application/json")),
+		Id("w").Dot("WriteHeader").Call(Id("status")),
+		Qual("encoding/json", "NewEncoder").Call(Id("w")).Dot("Encode").Call(
+			Map(String()).String().Values(Dict{Lit("err"): Id("message")}),
+		),
+	)
+
+	//Request is passed to next handler with returned writer, done stores response and lets
+	//duplicates continue, ok is false if response is replayed or request is rejected.
+	f.Func().Id(IdempotencyHelper).Params(w, r).Params(
+		Id("next").Qual("net/http", "ResponseWriter"), Id("done").Func().Params(), Id("ok").Bool(),
+	).BlockFunc(func(g *Group) {
+		g.List(Id("ttl"), Id("found")).Op(":=").Id("idempotencyRoutes").Index(Id("r").Dot("URL").Dot("Path"))
+		g.Id("header").Op(":=").Id("r").Dot("Header").Dot("Get").Call(Lit(IdempotencyKeyHeader))
+		g.If(Op("!").Id("found").Op("||").Id("header").Op("==").Lit("")).Block(
+			Return(Id("w"), Func().Params().Block(), True()),
+		)
+		g.If(Len(Id("header")).Op(">").Lit(255)).Block(
+			Id("idempotencyRejectHelper").Call(Id("w"), Qual("net/http", "StatusBadRequest"), Lit("Idempotency-Key is too long")),
+			Return(Nil(), Nil(), False()),
+		)
+		g.List(Id("body"), Err()).Op(":=").Qual("io/ioutil", "ReadAll").Call(Id("r").Dot("Body"))
+		g.If(Err().Op("!=").Nil()).Block(
+			Id("idempotencyRejectHelper").Call(Id("w"), Qual("net/http", "StatusBadRequest"), Err().Dot("Error").Call()),
+			Return(Nil(), Nil(), False()),
+		)
+		g.Id("r").Dot("Body").Op("=").Qual("io/ioutil", "NopCloser").Call(Qual("bytes", "NewReader").Call(Id("body")))
+		g.Id("sum").Op(":=").Qual("crypto/sha256", "Sum256").Call(
+			Append(Index().Byte().Parens(Id("r").Dot("URL").Dot("RawQuery").Op("+").Lit("\n")), Id("body").Op("...")),
+		)
+		g.Id("hash").Op(":=").Qual("encoding/hex", "EncodeToString").Call(Id("sum").Index(Op(":")))
+		principal := Lit("")
+		if IsAuth(info) {
+			principal = Id(PrincipalHelper).Call(Id("r").Dot("Context").Call())
+		}
+		g.Id("scoped").Op(":=").Qual("crypto/sha256", "Sum256").Call(Index().Byte().Parens(
+			Id("r").Dot("URL").Dot("Path").Op("+").Lit("\n").Op("+").Add(principal).Op("+").Lit("\n").Op("+").Id("header"),
+		))
+		g.Id("key").Op(":=").Qual("encoding/hex", "EncodeToString").Call(Id("scoped").Index(Op(":")))
+
+		g.Comment("Duplicate waits while request with the same key is served")
+		g.Var().Id("release").Chan().Struct()
+		g.For(Id("release").Op("==").Nil()).Block(
+			Id("idempotencyPending").Dot("Lock").Call(),
+			List(Id("wait"), Id("busy")).Op(":=").Id("idempotencyPending").Dot("keys").Index(Id("key")),
+			If(Op("!").Id("busy")).Block(
+				Id("release").Op("=").Make(Chan().Struct()),
+				Id("idempotencyPending").Dot("keys").Index(Id("key")).Op("=").Id("release"),
+			),
+			Id("idempotencyPending").Dot("Unlock").Call(),
+			If(Id("busy")).Block(Select().Block(
+				Case(Op("<-").Id("wait")),
+				Case(Op("<-").Id("r").Dot("Context").Call().Dot("Done").Call()).Block(Return(Nil(), Nil(), False())),
+			)),
+		)
+		g.Id("unlock").Op(":=").Func().Params().Block(
+			Id("idempotencyPending").Dot("Lock").Call(),
+			Delete(Id("idempotencyPending").Dot("keys"), Id("key")),
+			Id("idempotencyPending").Dot("Unlock").Call(),
+			Close(Id("release")),
+		)
+
+		g.List(Id("data"), Id("stored"), Err()).Op(":=").Add(Lifecycle(info, idempotencyLoadHelper)).Call(Id("key"))
+		g.Var().Id("record").Id("idempotencyRecord")
+		g.If(Err().Op("==").Nil().Op("&&").Id("stored")).Block(
+			Err().Op("=").Qual("encoding/json", "Unmarshal").Call(Id("data"), Op("&").Id("record")),
+		)
+		g.Switch().Block(
+			Case(Err().Op("!=").Nil()).Block(
+				Id("unlock").Call(),
+				Id("idempotencyRejectHelper").Call(Id("w"), Qual("net/http", "StatusInternalServerError"), Err().Dot("Error").Call()),
+				Return(Nil(), Nil(), False()),
+			),
+			Case(Op("!").Id("stored")).Block(
+				Id("writer").Op(":=").Op("&").Id("idempotencyWriter").Values(Dict{Id("ResponseWriter"): Id("w")}),
+				Return(Id("writer"), Func().Params().Block(
+					Defer().Id("unlock").Call(),
+					Comment("Server failures are not stored, request can be retried with the same key"),
+					If(Id("writer").Dot("status").Op("==").Lit(0).Op("||").Id("writer").Dot("status").Op(">=").Lit(500)).Block(Return()),
+					List(Id("data"), Id("_")).Op(":=").Qual("encoding/json", "Marshal").Call(Id("idempotencyRecord").Values(
+						Id("hash"), Id("writer").Dot("status"), Id("w").Dot("Header").Call().Dot("Get").Call(Lit("Content-Type")),
+						Id("writer").Dot("body").Dot("Bytes").Call(),
+					)),
+					Add(Lifecycle(info, idempotencySaveHelper)).Call(Id("key"), Id("data"), Id("ttl")),
+				), True()),
+			),
+		)
+		g.Id("unlock").Call()
+		g.If(Id("record").Dot("Hash").Op("!=").Id("hash")).Block(
+			Id("idempotencyRejectHelper").Call(
+				Id("w"), Qual("net/http", "StatusUnprocessableEntity"), Lit("Idempotency-Key is used by request with different body"),
+			),
+			Return(Nil(), Nil(), False()),
+		)
+		g.Id("w").Dot("Header").Call().Dot("Set").Call(Lit("Content-Type"), Id("record").Dot("ContentType"))
+		g.Id("w").Dot("Header").Call().Dot("Set").Call(Lit("Idempotent-Replayed"), Lit("true"))
+		g.Id("w").Dot("WriteHeader").Call(Id("record").Dot("Status"))
+		g.Id("w").Dot("Write").Call(Id("record").Dot("Body"))
+		g.Return(Nil(), Nil(), False())
+	})
+}
+
+//AddClientIdempotencyHelpers creates helpers of clients: idempotencyKeyHelper is used by
+//transports to send key of call, key is generated for each call of keyed function
+//(retries send the same key) unless it is set by WithIdempotencyKey.
+func AddClientIdempotencyHelpers(info *PackageInfo, f *File) {
+	ctx := Id("ctx").Qual("context", "Context")
+	f.Type().Id("idempotencyKey").Struct()
+	f.Func().Id(IdempotencyKeyHelper).Params(ctx).String().Block(
+		List(Id("key"), Id("_")).Op(":=").Id("ctx").Dot("Value").Call(Id("idempotencyKey").Values()).Assert(String()),
+		Return(Id("key")),
+	)
+	if !UsesIdempotencyKeys(info) {
+		return
+	}
+	f.Comment("WithIdempotencyKey returns context with idempotency key of call, it replaces generated")
+	f.Comment("key (e.g. to deduplicate call repeated after restart of caller).")
+	f.Func().Id("WithIdempotencyKey").Params(ctx, Id("key").String()).Qual("context", "Context").Block(
+		Return(Qual("context", "WithValue").Call(Id("ctx"), Id("idempotencyKey").Values(), Id("key"))),
+	)
+	f.Func().Id(WithIdempotencyKeyHelper).Params(ctx).Qual("context", "Context").Block(
+		If(Id(IdempotencyKeyHelper).Call(Id("ctx")).Op("!=").Lit("")).Block(Return(Id("ctx"))),
+		Id("buf").Op(":=").Make(Index().Byte(), Lit(16)),
+		Qual("crypto/rand", "Read").Call(Id("buf")),
+		Return(Id("WithIdempotencyKey").Call(Id("ctx"), Qual("encoding/hex", "EncodeToString").Call(Id("buf")))),
+	)
+}
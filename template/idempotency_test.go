@@ -0,0 +1,43 @@
+package template
+
+import (
+	"testing"
+	"time"
+
+	"github.com/angrypie/tie/parser"
+	"github.com/angrypie/tie/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetIdempotencyKey(t *testing.T) {
+	keyed := parser.Directive{Name: IdempotentDirective, Args: map[string]string{"key": "", "ttl": "1h"}}
+	info := &PackageInfo{Service: &types.Service{Type: "http", Idempotency: &types.Idempotency{
+		TTL:       "2h",
+		Functions: []string{"Update"},
+	}}}
+	info.Functions = []parser.Function{
+		{Name: "Create", Directives: []parser.Directive{keyed}},
+		{Name: "Update"},
+		{Name: "Get"},
+	}
+	require.NoError(t, ValidateIdempotency(info))
+	for i, expected := range []struct {
+		ttl   time.Duration
+		keyed bool
+	}{{time.Hour, true}, {2 * time.Hour, true}, {2 * time.Hour, false}} {
+		ttl, isKeyed, err := GetIdempotencyKey(info, info.Functions[i])
+		require.NoError(t, err)
+		require.Equal(t, expected.ttl, ttl)
+		require.Equal(t, expected.keyed, isKeyed)
+	}
+	require.True(t, IsIdempotent(info, info.Functions[1]))
+
+	info.Service.Type = "jsonrpc"
+	require.EqualError(t, ValidateIdempotency(info), "idempotency: keys are accepted only by http and stdhttp service types")
+
+	info.Service.Idempotency.Functions = []string{"Delete"}
+	require.EqualError(t, ValidateIdempotency(info), "idempotency: unknown function Delete")
+
+	delete(info.Functions[0].Directives[0].Args, "key")
+	require.EqualError(t, ValidateIdempotency(info), "Create: //tie:idempotent ttl requires key")
+}
@@ -0,0 +1,231 @@
+package template
+
+import (
+	"fmt"
+
+	"github.com/angrypie/tie/parser"
+	"github.com/angrypie/tie/template/modutils"
+	. "github.com/dave/jennifer/jen"
+)
+
+//Dependency is built-in value injected into receiver constructor argument
+//instead of being transferred over the wire.
+type Dependency struct {
+	//Name is argument name and DepsMap key.
+	Name string
+	//Type is full argument type (e.g. *net/http.Request).
+	Type string
+	//ByType dependency is injected regardless of argument name.
+	ByType bool
+	//Request dependency is available only for receivers created per request.
+	Request bool
+}
+
+//Built-in dependencies, each module supports subset of them (see DepsMap).
+var (
+	DepGetEnv         = Dependency{Name: "getEnv", Type: "func(string) string"}
+	DepLogger         = Dependency{Name: "logger", Type: "*log.Logger", ByType: true}
+	DepContext        = Dependency{Name: "ctx", Type: "context.Context", ByType: true, Request: true}
+	DepGetHeader      = Dependency{Name: "getHeader", Type: "func(string) string", Request: true}
+	DepGetCookie      = Dependency{Name: "getCookie", Type: "func(string) string", Request: true}
+	DepPrincipal      = Dependency{Name: "principal", Type: "string", Request: true}
+	DepRequestID      = Dependency{Name: "requestID", Type: "string", Request: true}
+	DepClientIP       = Dependency{Name: "clientIP", Type: "string", Request: true}
+	DepRequest        = Dependency{Name: "request", Type: "*net/http.Request", ByType: true, Request: true}
+	DepResponseWriter = Dependency{Name: "responseWriter", Type: "net/http.ResponseWriter", ByType: true, Request: true}
+)
+
+//Dependencies is list of all built-in dependencies.
+var Dependencies = []Dependency{
+	DepGetEnv, DepLogger, DepContext, DepGetHeader, DepGetCookie,
+	DepPrincipal, DepRequestID, DepClientIP, DepRequest, DepResponseWriter,
+}
+
+//GetDependency returns built-in dependency that matches argument type and name.
+func GetDependency(field parser.Field) (dep Dependency, ok bool) {
+	typeString := field.TypeString()
+	for _, dep := range Dependencies {
+		if dep.Type == typeString && (dep.ByType || dep.Name == field.Name()) {
+			return dep, true
+		}
+	}
+	return
+}
+
+//DefaultDeps returns dependencies supported by every module.
+func DefaultDeps() DepsMap {
+	return DepsMap{
+		DepGetEnv.Name: Id(GetEnvHelper),
+		DepLogger.Name: Qual("log", "Default").Call(),
+	}
+}
+
+//injectDependency returns code of dependency matching argument. Ok is true
+//if argument is built-in dependency (code is nil if module does not support it).
+func injectDependency(field parser.Field, deps DepsMap) (code *Statement, ok bool) {
+	dep, ok := GetDependency(field)
+	if !ok {
+		return nil, false
+	}
+	if code, supported := deps[dep.Name]; supported {
+		return code, true
+	}
+	return Nil(), true
+}
+
+//ValidateDeps returns error if receiver constructors require dependencies
+//that are not supported by module or not available for top level receivers.
+//Only receivers of functions served by module are checked (all if serves is nil).
+func ValidateDeps(info *PackageInfo, module string, deps DepsMap, serves func(parser.Function) bool) error {
+	used := make(map[string]bool)
+	var use func(receiver parser.Field)
+	use = func(receiver parser.Field) {
+		c, ok := info.GetConstructor(receiver)
+		if !ok || used[constructorKey(receiver)] {
+			return
+		}
+		used[constructorKey(receiver)] = true
+		for _, arg := range c.Function.Arguments {
+			use(arg)
+		}
+	}
+	ForEachFunction(info, true, func(fn parser.Function) {
+		if HasReceiver(fn) && (serves == nil || serves(fn)) {
+			use(fn.Receiver)
+		}
+	})
+
+	constructors, _ := NewDepsGraph(info).Order()
+	for _, c := range constructors {
+		topLevel := HasTopLevelReceiver(c.Function, info)
+		if !topLevel && !used[constructorKey(c.Receiver)] {
+			continue
+		}
+		for _, arg := range c.Function.Arguments {
+			dep, ok := GetDependency(arg)
+			if !ok {
+				continue
+			}
+			if topLevel && dep.Request {
+				return fmt.Errorf("%s: %s (%s) is available only for receivers created per request",
+					c.Function.Name, arg.Name(), dep.Type)
+			}
+			if _, ok := deps[dep.Name]; !ok && !topLevel {
+				return fmt.Errorf("%s: %s (%s) is not supported by %s module",
+					c.Function.Name, arg.Name(), dep.Type, module)
+			}
+		}
+	}
+	return nil
+}
+
+//NewDepsValidator creates module validator that checks dependencies (see ValidateDeps).
+func NewDepsValidator(module string, deps DepsMap, serves func(parser.Function) bool) modutils.ValidateFunc {
+	return func(p *parser.Parser) error {
+		return ValidateDeps(NewPackageInfoFromParser(p), module, deps, serves)
+	}
+}
+
+//Helpers that extract request dependencies from *http.Request (see AddRequestHelpers).
+const (
+	GetHeaderHelper     = "getHeaderHelper"
+	GetCookieHelper     = "getCookieHelper"
+	ClientIPHelper      = "clientIPHelper"
+	PrincipalHelper     = "principalHelper"
+	WithPrincipalHelper = "withPrincipalHelper"
+	WithRequestIDHelper = "withRequestIDHelper"
+)
+
+//RequestIDHeader is header that holds request ID.
+const RequestIDHeader = "X-Request-Id"
+
+//DefaultPrincipal is principal of request authenticated with service key.
+const DefaultPrincipal = "default"
+
+const principalKey = "principalKey"
+
+//RequestDeps returns dependencies that can be extracted from request r and response writer w.
+func RequestDeps(w, r Code) DepsMap {
+	deps := DefaultDeps()
+	deps[DepContext.Name] = Add(r).Dot("Context").Call()
+	deps[DepGetHeader.Name] = Id(GetHeaderHelper).Call(r)
+	deps[DepGetCookie.Name] = Id(GetCookieHelper).Call(r)
+	deps[DepPrincipal.Name] = Id(PrincipalHelper).Call(Add(r).Dot("Context").Call())
+	deps[DepRequestID.Name] = Add(r).Dot("Header").Dot("Get").Call(Lit(RequestIDHeader))
+	deps[DepClientIP.Name] = Id(ClientIPHelper).Call(r)
+	deps[DepRequest.Name] = Add(r)
+	deps[DepResponseWriter.Name] = Add(w)
+	return deps
+}
+
+//AddRequestHelpers creates helpers used by RequestDeps.
+func AddRequestHelpers(f *File) {
+	request := Id("r").Op("*").Qual("net/http", "Request")
+	getter := Func().Params(String()).String()
+
+	f.Func().Id(GetHeaderHelper).Params(request).Add(getter).Block(
+		Return(Func().Params(Id("name").String()).String().Block(
+			Return(Id("r").Dot("Header").Dot("Get").Call(Id("name"))),
+		)),
+	)
+
+	f.Func().Id(GetCookieHelper).Params(request).Add(getter).Block(
+		Return(Func().Params(Id("name").String()).String().Block(
+			List(Id("cookie"), Err()).Op(":=").Id("r").Dot("Cookie").Call(Id("name")),
+			If(Err().Op("!=").Nil()).Block(Return(Lit(""))),
+			Return(Id("cookie").Dot("Value")),
+		)),
+	)
+
+	//Client IP is taken from proxy headers if present.
+	f.Func().Id(ClientIPHelper).Params(request).String().Block(
+		If(
+			Id("forwarded").Op(":=").Id("r").Dot("Header").Dot("Get").Call(Lit("X-Forwarded-For")),
+			Id("forwarded").Op("!=").Lit(""),
+		).Block(
+			Return(Qual("strings", "TrimSpace").Call(
+				Qual("strings", "Split").Call(Id("forwarded"), Lit(",")).Index(Lit(0)),
+			)),
+		),
+		If(
+			Id("ip").Op(":=").Id("r").Dot("Header").Dot("Get").Call(Lit("X-Real-Ip")),
+			Id("ip").Op("!=").Lit(""),
+		).Block(Return(Id("ip"))),
+		List(Id("host"), Id("_"), Err()).Op(":=").Qual("net", "SplitHostPort").Call(Id("r").Dot("RemoteAddr")),
+		If(Err().Op("!=").Nil()).Block(Return(Id("r").Dot("RemoteAddr"))),
+		Return(Id("host")),
+	)
+
+	AddPrincipalHelpers(f)
+
+	f.Func().Id(WithPrincipalHelper).
+		Params(request, Id("principal").String()).Op("*").Qual("net/http", "Request").Block(
+		Return(Id("r").Dot("WithContext").Call(Qual("context", "WithValue").Call(
+			Id("r").Dot("Context").Call(), Id(principalKey).Values(), Id("principal"),
+		))),
+	)
+
+	//Request ID is generated if client does not send it, response has the same ID.
+	f.Func().Id(WithRequestIDHelper).
+		Params(Id("w").Qual("net/http", "ResponseWriter"), request).Block(
+		Id("id").Op(":=").Id("r").Dot("Header").Dot("Get").Call(Lit(RequestIDHeader)),
+		If(Id("id").Op("==").Lit("")).Block(
+			Id("buf").Op(":=").Make(Index().Byte(), Lit(16)),
+			Qual("crypto/rand", "Read").Call(Id("buf")),
+			Id("id").Op("=").Qual("encoding/hex", "EncodeToString").Call(Id("buf")),
+			Id("r").Dot("Header").Dot("Set").Call(Lit(RequestIDHeader), Id("id")),
+		),
+		Id("w").Dot("Header").Call().Dot("Set").Call(Lit(RequestIDHeader), Id("id")),
+	)
+}
+
+//AddPrincipalHelpers creates principalHelper that returns authenticated principal of context,
+//it is created by AddRequestHelpers for HTTP modules.
+func AddPrincipalHelpers(f *File) {
+	f.Type().Id(principalKey).Struct()
+
+	f.Func().Id(PrincipalHelper).Params(Id("ctx").Qual("context", "Context")).String().Block(
+		List(Id("principal"), Id("_")).Op(":=").Id("ctx").Dot("Value").Call(Id(principalKey).Values()).Assert(String()),
+		Return(Id("principal")),
+	)
+}
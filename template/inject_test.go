@@ -0,0 +1,69 @@
+package template
+
+import (
+	"go/types"
+	"testing"
+
+	"github.com/angrypie/tie/parser"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetDependency(t *testing.T) {
+	pkg := types.NewPackage("example.com/deps", "deps")
+	http := types.NewPackage("net/http", "http")
+	request := types.NewNamed(types.NewTypeName(0, http, "Request", nil), types.NewStruct(nil, nil), nil)
+	getter := types.NewSignature(nil,
+		types.NewTuple(types.NewVar(0, nil, "", types.Typ[types.String])),
+		types.NewTuple(types.NewVar(0, nil, "", types.Typ[types.String])), false)
+	field := func(name string, typ types.Type) parser.Field {
+		return parser.NewField(types.NewVar(0, pkg, name, typ))
+	}
+
+	dep, ok := GetDependency(field("req", types.NewPointer(request)))
+	require.True(t, ok)
+	require.Equal(t, DepRequest, dep)
+
+	dep, ok = GetDependency(field("getCookie", getter))
+	require.True(t, ok)
+	require.Equal(t, DepGetCookie, dep)
+
+	//String dependencies are matched by name
+	_, ok = GetDependency(field("requestID", types.Typ[types.String]))
+	require.True(t, ok)
+	_, ok = GetDependency(field("name", types.Typ[types.String]))
+	require.False(t, ok)
+	_, ok = GetDependency(field("requestID", types.Typ[types.Int]))
+	require.False(t, ok)
+}
+
+func TestValidateDeps(t *testing.T) {
+	info := newTestInfo(map[string][]string{
+		"User": {"API"},
+		"API":  nil,
+	})
+	pkg := types.NewPackage("example.com/deps", "deps")
+	addArg := func(receiver, name string, typ types.Type) {
+		for key, c := range info.Constructors {
+			if c.Receiver.TypeName() == receiver {
+				c.Function.Arguments = append(c.Function.Arguments, parser.NewField(types.NewVar(0, pkg, name, typ)))
+				info.Constructors[key] = c
+			}
+		}
+	}
+
+	//Only receivers of served functions are checked
+	for _, c := range info.Constructors {
+		if c.Receiver.TypeName() == "User" {
+			info.Functions = append(info.Functions, parser.Function{Name: "Hello", Receiver: c.Receiver})
+		}
+	}
+
+	addArg("User", "clientIP", types.Typ[types.String])
+	require.NoError(t, ValidateDeps(info, "test", DepsMap{DepClientIP.Name: nil}, nil))
+	require.EqualError(t, ValidateDeps(info, "test", DefaultDeps(), nil),
+		"NewUser: clientIP (string) is not supported by test module")
+
+	addArg("API", "principal", types.Typ[types.String])
+	require.EqualError(t, ValidateDeps(info, "test", DepsMap{DepPrincipal.Name: nil}, nil),
+		"NewAPI: principal (string) is available only for receivers created per request")
+}
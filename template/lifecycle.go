@@ -0,0 +1,230 @@
+package template
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/angrypie/tie/parser"
+	"github.com/angrypie/tie/template/modutils"
+	"github.com/angrypie/tie/types"
+	. "github.com/dave/jennifer/jen"
+)
+
+//LifecycleModule is name of package shared by all transports of service, it keeps
+//receiver instances, sessions and state and coordinates start and shutdown.
+const LifecycleModule = "lifecycle"
+
+//Exported identifiers of lifecycle package used by modules.
+const (
+	//RunHelper creates receivers once, starts all servers and exits when they are stopped.
+	RunHelper = "Run"
+	//ReceiverHelper returns shared top level receiver, it is created by first caller.
+	ReceiverHelper = "Receiver"
+	//ReadyHelper marks server as ready, service is ready when all servers are ready.
+	ReadyHelper = "Ready"
+)
+
+//upgradedModules lists modules that serve upgraded copy of service package.
+var upgradedModules = map[string]string{
+	"":      "micromod", //default transport
+	"micro": "micromod",
+	"dapr":  "daprmod",
+}
+
+//Transports returns transport types of service (e.g. "http micro").
+func Transports(service *types.Service) (transports []string) {
+	for _, t := range strings.Split(service.Type, " ") {
+		if t = strings.TrimSpace(t); t != "" {
+			transports = append(transports, t)
+		}
+	}
+	if len(transports) == 0 {
+		transports = []string{""}
+	}
+	return
+}
+
+//ValidateTransports returns error if transports can't share one set of receivers
+//or listen on the same port.
+func ValidateTransports(info *PackageInfo) error {
+	transports := Transports(info.Service)
+	seen, ports := make(map[string]bool), make(map[string]string)
+	var upgraded []string
+	for _, t := range transports {
+		if seen[t] {
+			return fmt.Errorf("type: transport %q is used twice", t)
+		}
+		seen[t] = true
+		if _, ok := upgradedModules[t]; ok {
+			upgraded = append(upgraded, t)
+		}
+		port := TransportPort(info.Service, t)
+		if other, ok := ports[port]; ok && port != "" {
+			return fmt.Errorf("ports: %s and %s use port %s", other, t, port)
+		}
+		ports[port] = t
+	}
+	if len(upgraded) > 1 {
+		return fmt.Errorf("type: %s can't be used in one service", strings.Join(upgraded, " and "))
+	}
+	for t := range info.Service.Ports {
+		if !seen[t] {
+			return fmt.Errorf("ports: unknown transport %q", t)
+		}
+	}
+	if seen["ws"] && !hasStreamArgument(info) {
+		return fmt.Errorf("type: ws serves only bidirectional stream functions, package has none")
+	}
+	return nil
+}
+
+//hasStreamArgument returns true if one of functions is bidirectional stream (it is served by ws).
+func hasStreamArgument(info *PackageInfo) (ok bool) {
+	ForEachFunction(info, true, func(fn parser.Function) {
+		if _, isStream := GetStreamArgument(fn); isStream {
+			ok = true
+		}
+	})
+	return
+}
+
+//TransportPort returns configured port of transport, service port is used by first transport.
+func TransportPort(service *types.Service, transport string) string {
+	if port, ok := service.Ports[transport]; ok {
+		return port
+	}
+	if Transports(service)[0] == transport {
+		return service.Port
+	}
+	return ""
+}
+
+//hasTransport returns true if service is served by transport.
+func hasTransport(service *types.Service, transport string) bool {
+	for _, t := range Transports(service) {
+		if t == transport {
+			return true
+		}
+	}
+	return false
+}
+
+//ClientPort returns port of first of transports that is served by service (client of
+//several transports that use the same protocol), service port is used otherwise.
+func ClientPort(service *types.Service, transports ...string) string {
+	for _, transport := range transports {
+		if hasTransport(service, transport) {
+			return TransportPort(service, transport)
+		}
+	}
+	return service.Port
+}
+
+//upgradedServicePath returns path of upgraded service package if one of transports
+//upgrades it, all transports use the same package to share receivers.
+func upgradedServicePath(info PackageInfo) string {
+	if info.Service == nil {
+		return ""
+	}
+	for _, t := range Transports(info.Service) {
+		if module, ok := upgradedModules[t]; ok {
+			return path.Join(info.ModulePath, "tie_modules", module, "upgraded")
+		}
+	}
+	return ""
+}
+
+//LifecyclePath returns import path of lifecycle package.
+func LifecyclePath(info *PackageInfo) string {
+	return path.Join(info.ModulePath, "tie_modules", LifecycleModule)
+}
+
+//Lifecycle returns identifier of lifecycle package.
+func Lifecycle(info *PackageInfo, name string) *Statement {
+	return Qual(LifecyclePath(info), name)
+}
+
+//makeSharedReceiver creates top level receiver in lifecycle registry (it is created once
+//for all transports) and assigns it to recId.
+func makeSharedReceiver(info *PackageInfo, receiver parser.Field, g *Group, create func(g *Group)) {
+	recId := GetReceiverVarName(receiver.TypeName())
+	sharedId := ID("shared", recId)
+	g.List(Id(sharedId), Err()).Op(":=").Add(Lifecycle(info, ReceiverHelper)).Call(
+		Lit(receiver.TypeName()),
+		Func().Params().Params(Id("receiver").Interface(), Err().Error()).BlockFunc(func(g *Group) {
+			create(g)
+			g.Return(Id(recId), Nil())
+		}),
+	)
+	AddIfErrorGuard(g, nil, "err", nil)
+	g.Id(recId).Op(":=").Id(sharedId).Assert(Op("*").Qual(info.GetServicePath(), TrimPrefix(receiver.TypeName())))
+}
+
+//GetLifecyclePackage creates lifecycle package: signal handling, InitService, state store,
+//sessions, health checks and shutdown of all servers.
+func GetLifecyclePackage(info *PackageInfo) *Package {
+	f := NewFilePathName(LifecyclePath(info), LifecycleModule)
+	serveFn := Func().Params().Error()
+
+	f.Comment("Run initializes service and starts servers concurrently, if any server fails or")
+	f.Comment("stops, other servers are stopped and process exits when shutdown is finished.")
+	f.Func().Id(RunHelper).Params(Id("servers").Op("...").Add(serveFn)).BlockFunc(func(g *Group) {
+		GracefulShutdown(info, g, f)
+		makeTLSInit(info, g)
+		MakeInitService(info, g)
+		makeStateInit(info, g)
+		makeIdempotencyInit(info, g)
+		g.Qual("sync/atomic", "StoreInt32").Call(Op("&").Id(readyPending), Int32().Call(Len(Id("servers"))))
+
+		g.Id("errs").Op(":=").Make(Chan().Error(), Len(Id("servers")))
+		g.For(List(Id("_"), Id("serve")).Op(":=").Range().Id("servers")).Block(
+			Go().Func().Params(Id("serve").Add(serveFn)).Block(
+				Id("errs").Op("<-").Id("serve").Call(),
+			).Call(Id("serve")),
+		)
+		//Receivers created before failure are stopped
+		g.If(Err().Op(":=").Op("<-").Id("errs"), Err().Op("!=").Nil()).Block(
+			createErrLog("failed to start service"),
+			Id(ShutdownHelper).Call(),
+			Qual("os", "Exit").Call(Lit(1)),
+		)
+		g.Comment("Server returns after it is stopped, process exits when shutdown is finished")
+		g.Qual("os", "Exit").Call(Id(ShutdownHelper).Call())
+	})
+
+	f.Type().Id("receiverEntry").Struct(Id("value").Interface(), Err().Error())
+	f.Var().Defs(
+		Id("receiversMu").Qual("sync", "Mutex"),
+		Id("receivers").Op("=").Make(Map(String()).Id("receiverEntry")),
+	)
+	f.Comment("Receiver returns receiver of kind, it is created by first caller and shared by all servers.")
+	f.Func().Id(ReceiverHelper).Params(
+		Id("kind").String(), Id("create").Func().Params().Params(Interface(), Error()),
+	).Params(Interface(), Error()).Block(
+		Id("receiversMu").Dot("Lock").Call(),
+		Defer().Id("receiversMu").Dot("Unlock").Call(),
+		List(Id("entry"), Id("ok")).Op(":=").Id("receivers").Index(Id("kind")),
+		If(Op("!").Id("ok")).Block(
+			List(Id("entry").Dot("value"), Id("entry").Dot("err")).Op("=").Id("create").Call(),
+			Id("receivers").Index(Id("kind")).Op("=").Id("entry"),
+		),
+		Return(Id("entry").Dot("value"), Id("entry").Dot("err")),
+	)
+
+	AddSessionHelpers(info, f)
+	AddStateHelpers(info, f)
+	AddIdempotencyStoreHelpers(info, f)
+	AddHealthHelpers(info, f)
+	AddTLSHelpers(info, f)
+
+	return modutils.NewPackage(LifecycleModule, "lifecycle.go", f.GoString())
+}
+
+//NewLifecycleModule creates module of lifecycle package.
+func NewLifecycleModule(p *parser.Parser) Module {
+	generator := func(p *parser.Parser) *Package {
+		return GetLifecyclePackage(NewPackageInfoFromParser(p))
+	}
+	return modutils.NewStandartModule(LifecycleModule, generator, p, nil)
+}
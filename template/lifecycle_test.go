@@ -0,0 +1,38 @@
+package template
+
+import (
+	"testing"
+
+	"github.com/angrypie/tie/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateTransports(t *testing.T) {
+	info := &PackageInfo{ModulePath: "example.com/svc", Service: &types.Service{Type: "stdhttp jsonrpc", Port: "8080"}}
+	require.NoError(t, ValidateTransports(info))
+	require.Equal(t, "", TransportPort(info.Service, "jsonrpc"))
+
+	info.Service.Ports = map[string]string{"jsonrpc": "8080"}
+	require.EqualError(t, ValidateTransports(info), "ports: stdhttp and jsonrpc use port 8080")
+
+	info.Service.Ports = map[string]string{"jsonrpc": "8081"}
+	require.NoError(t, ValidateTransports(info))
+	require.Equal(t, "8080", TransportPort(info.Service, "stdhttp"))
+	require.Equal(t, "8081", ClientPort(info.Service, "jsonrpc"))
+	require.Equal(t, "example.com/svc", info.GetServicePath())
+
+	info.Service.Type = "http micro"
+	require.EqualError(t, ValidateTransports(info), `ports: unknown transport "jsonrpc"`)
+	info.Service.Ports = nil
+	require.NoError(t, ValidateTransports(info))
+	require.Equal(t, "example.com/svc/tie_modules/micromod/upgraded", info.GetServicePath())
+
+	info.Service.Type = "micro dapr"
+	require.EqualError(t, ValidateTransports(info), "type: micro and dapr can't be used in one service")
+
+	info.Service.Type = "ws ws"
+	require.EqualError(t, ValidateTransports(info), `type: transport "ws" is used twice`)
+
+	info.Service.Type = "http ws"
+	require.EqualError(t, ValidateTransports(info), "type: ws serves only bidirectional stream functions, package has none")
+}
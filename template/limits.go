@@ -0,0 +1,388 @@
+package template
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/angrypie/tie/parser"
+	"github.com/angrypie/tie/types"
+	. "github.com/dave/jennifer/jen"
+)
+
+//LimitDirective sets limit of method or of all methods of receiver (on constructor),
+//tie.yaml limits of function override it: //tie:limit rate=5/m burst=1 concurrency=2.
+const LimitDirective = "limit"
+
+//LimitHelper checks limits of request route, it returns function that releases
+//concurrency slot or false if request is rejected with 429.
+const LimitHelper = "limitHelper"
+
+//Client retries request rejected with 429 maxRetries times if server asks to wait
+//less than maxRetryDelay.
+const (
+	maxRetries    = 3
+	maxRetryDelay = 10 * time.Second
+)
+
+//DefaultBodyLimit is size of request body that is read by servers which don't use echo
+//if http.body_limit is not set.
+const DefaultBodyLimit = 4 << 20
+
+var bodyLimitRegexp = regexp.MustCompile(`^(\d+)([KMGTP]?)B?$`)
+
+//BodyLimit returns maximum size of request body in bytes set by http.body_limit
+//(e.g. 512K, 4M), ok is false if it is not set.
+func BodyLimit(info *PackageInfo) (limit int64, ok bool, err error) {
+	if info.Service.HTTP == nil || info.Service.HTTP.BodyLimit == "" {
+		return DefaultBodyLimit, false, nil
+	}
+	size := info.Service.HTTP.BodyLimit
+	match := bodyLimitRegexp.FindStringSubmatch(size)
+	if match == nil {
+		return 0, false, fmt.Errorf("invalid size %q (e.g. 512K, 4M)", size)
+	}
+	limit, _ = strconv.ParseInt(match[1], 10, 64)
+	for i := strings.Index("KMGTP", match[2]); match[2] != "" && i >= 0; i-- {
+		limit *= 1024
+	}
+	return limit, true, nil
+}
+
+//Limit is resolved limit of function.
+type Limit struct {
+	//Rate is number of requests per second, zero if rate is not limited.
+	Rate float64
+	//Burst is number of requests allowed at once.
+	Burst int
+	//Concurrency is maximum number of requests served at once, zero if not limited.
+	Concurrency int
+}
+
+//IsLimited returns true if limit restricts requests.
+func (limit Limit) IsLimited() bool {
+	return limit.Rate != 0 || limit.Concurrency != 0
+}
+
+//parseRate parses rate in form count/unit (s, m or h), count without unit is per second.
+func parseRate(rate string) (perSecond float64, count int, err error) {
+	value, unit := rate, time.Second
+	if i := strings.Index(rate, "/"); i != -1 {
+		value = rate[:i]
+		switch rate[i+1:] {
+		case "s":
+		case "m":
+			unit = time.Minute
+		case "h":
+			unit = time.Hour
+		default:
+			return 0, 0, fmt.Errorf("invalid rate %q (e.g. 10/s, 100/m, 1000/h)", rate)
+		}
+	}
+	if count, err = strconv.Atoi(value); err != nil || count < 0 {
+		return 0, 0, fmt.Errorf("invalid rate %q (e.g. 10/s, 100/m, 1000/h)", rate)
+	}
+	return float64(count) / unit.Seconds(), count, nil
+}
+
+//mergeLimit overrides limit with fields that are set in config.
+func mergeLimit(limit Limit, config types.Limit) (Limit, error) {
+	if config.Rate != "" {
+		rate, count, err := parseRate(config.Rate)
+		if err != nil {
+			return limit, err
+		}
+		limit.Rate, limit.Burst = rate, count
+	}
+	if config.Burst < 0 || config.Concurrency < 0 {
+		return limit, fmt.Errorf("burst and concurrency can't be negative")
+	}
+	if config.Burst != 0 {
+		limit.Burst = config.Burst
+	}
+	if config.Concurrency != 0 {
+		limit.Concurrency = config.Concurrency
+	}
+	if limit.Rate != 0 && limit.Burst == 0 {
+		limit.Burst = 1
+	}
+	return limit, nil
+}
+
+//limitDirective returns limit directive of method or of its receiver constructor.
+func limitDirective(info *PackageInfo, fn parser.Function) (directive parser.Directive, ok bool) {
+	if directive, ok = fn.GetDirective(LimitDirective); ok || !HasReceiver(fn) {
+		return
+	}
+	if c, isReceiver := info.GetConstructor(fn.Receiver); isReceiver {
+		return c.Function.GetDirective(LimitDirective)
+	}
+	return
+}
+
+//directiveLimit converts directive arguments to limit configuration.
+func directiveLimit(directive parser.Directive) (config types.Limit, err error) {
+	for arg, value := range directive.Args {
+		var n int
+		if arg != "rate" {
+			if n, err = strconv.Atoi(value); err != nil {
+				return config, fmt.Errorf("%s must be number", arg)
+			}
+		}
+		switch arg {
+		case "rate":
+			config.Rate = value
+		case "burst":
+			config.Burst = n
+		case "concurrency":
+			config.Concurrency = n
+		default:
+			return config, fmt.Errorf("//tie:limit accepts rate, burst and concurrency")
+		}
+	}
+	return
+}
+
+//GetLimit returns limit of function: service default limit, directive and tie.yaml limit
+//of function override each other in this order.
+func GetLimit(info *PackageInfo, fn parser.Function) (limit Limit, err error) {
+	limits := info.Service.Limits
+	if limits == nil {
+		limits = &types.Limits{}
+	}
+	if limit, err = mergeLimit(limit, limits.Limit); err != nil {
+		return
+	}
+	if directive, ok := limitDirective(info, fn); ok {
+		config, err := directiveLimit(directive)
+		if err != nil {
+			return limit, err
+		}
+		if limit, err = mergeLimit(limit, config); err != nil {
+			return limit, err
+		}
+	}
+	return mergeLimit(limit, limits.Functions[functionName(fn)])
+}
+
+//IsLimited returns true if requests of any function are limited.
+func IsLimited(info *PackageInfo) bool {
+	limited := false
+	ForEachFunction(info, true, func(fn parser.Function) {
+		limit, _ := GetLimit(info, fn)
+		limited = limited || limit.IsLimited()
+	})
+	return limited
+}
+
+//ValidateLimits returns error if limits are malformed or refer to unknown functions.
+func ValidateLimits(info *PackageInfo) (err error) {
+	if _, _, err = BodyLimit(info); err != nil {
+		return fmt.Errorf("http.body_limit: %w", err)
+	}
+	names := make(map[string]bool)
+	ForEachFunction(info, true, func(fn parser.Function) {
+		names[functionName(fn)] = true
+		if _, e := GetLimit(info, fn); e != nil && err == nil {
+			err = fmt.Errorf("%s: limit: %w", functionName(fn), e)
+		}
+	})
+	limits := info.Service.Limits
+	if err != nil || limits == nil {
+		return
+	}
+	for name := range limits.Functions {
+		if !names[name] {
+			return fmt.Errorf("limits: unknown function %s", name)
+		}
+	}
+	switch key := limits.Key; {
+	case key == "", key == "ip", strings.HasPrefix(key, "header:") && len(key) > len("header:"):
+	case key == "principal":
+		if !IsAuth(info) {
+			return fmt.Errorf("limits: principal key requires authentication")
+		}
+	default:
+		return fmt.Errorf("limits: key must be ip, principal or header:Name")
+	}
+	return nil
+}
+
+//limitKey returns code of client key of rate limit, client IP is used if key is empty.
+func limitKey(info *PackageInfo, g *Group) {
+	key := ""
+	if info.Service.Limits != nil {
+		key = info.Service.Limits.Key
+	}
+	switch {
+	case key == "principal":
+		g.Id("key").Op(":=").Id(PrincipalHelper).Call(Id("r").Dot("Context").Call())
+	case strings.HasPrefix(key, "header:"):
+		g.Id("key").Op(":=").Id("r").Dot("Header").Dot("Get").Call(Lit(strings.TrimPrefix(key, "header:")))
+	default:
+		g.Id("key").Op(":=").Id(ClientIPHelper).Call(Id("r"))
+		return
+	}
+	g.If(Id("key").Op("==").Lit("")).Block(Id("key").Op("=").Id(ClientIPHelper).Call(Id("r")))
+}
+
+//AddLimitHelpers creates limitHelper of HTTP modules (route returns path of function).
+//Rate is limited by token bucket of each client and route, requests over limits are
+//rejected with 429 and Retry-After header.
+func AddLimitHelpers(info *PackageInfo, f *File, route func(parser.Function) string) {
+	if !IsLimited(info) {
+		return
+	}
+	routes := Dict{}
+	ForEachFunction(info, true, func(fn parser.Function) {
+		limit, _ := GetLimit(info, fn)
+		if !limit.IsLimited() {
+			return
+		}
+		values := Dict{}
+		if limit.Rate != 0 {
+			values[Id("rate")] = Lit(limit.Rate)
+			values[Id("burst")] = Lit(float64(limit.Burst))
+		}
+		if limit.Concurrency != 0 {
+			values[Id("slots")] = Make(Chan().Struct(), Lit(limit.Concurrency))
+		}
+		routes[Lit(route(fn))] = Values(values)
+	})
+
+	f.Type().Id("routeLimit").Struct(
+		List(Id("rate"), Id("burst")).Float64(),
+		Id("slots").Chan().Struct(),
+	)
+	f.Var().Id("routeLimits").Op("=").Map(String()).Op("*").Id("routeLimit").Values(routes)
+	f.Type().Id("limitBucket").Struct(
+		Id("tokens").Float64(),
+		Id("last").Qual("time", "Time"),
+		Id("limit").Op("*").Id("routeLimit"),
+	)
+	f.Var().Id("limitBuckets").Op("=").Struct(
+		Qual("sync", "Mutex"),
+		Id("buckets").Map(String()).Op("*").Id("limitBucket"),
+	).Values(Dict{Id("buckets"): Make(Map(String()).Op("*").Id("limitBucket"))})
+
+	//limitTakeHelper takes token from bucket of client, it returns time to wait for token if bucket is empty.
+	//Full buckets are removed when there are too many clients.
+	f.Func().Id("limitTakeHelper").Params(Id("key").String(), Id("limit").Op("*").Id("routeLimit")).Qual("time", "Duration").Block(
+		Id("limitBuckets").Dot("Lock").Call(),
+		Defer().Id("limitBuckets").Dot("Unlock").Call(),
+		Id("now").Op(":=").Qual("time", "Now").Call(),
+		Id("refill").Op(":=").Func().Params(Id("bucket").Op("*").Id("limitBucket")).Float64().Block(
+			Id("elapsed").Op(":=").Id("now").Dot("Sub").Call(Id("bucket").Dot("last")).Dot("Seconds").Call(),
+			Return(Qual("math", "Min").Call(
+				Id("bucket").Dot("limit").Dot("burst"),
+				Id("bucket").Dot("tokens").Op("+").Id("elapsed").Op("*").Id("bucket").Dot("limit").Dot("rate"),
+			)),
+		),
+		List(Id("bucket"), Id("ok")).Op(":=").Id("limitBuckets").Dot("buckets").Index(Id("key")),
+		If(Op("!").Id("ok")).Block(
+			If(Len(Id("limitBuckets").Dot("buckets")).Op(">=").Lit(10000)).Block(
+				For(List(Id("key"), Id("bucket")).Op(":=").Range().Id("limitBuckets").Dot("buckets")).Block(
+					If(Id("refill").Call(Id("bucket")).Op("==").Id("bucket").Dot("limit").Dot("burst")).Block(
+						Delete(Id("limitBuckets").Dot("buckets"), Id("key")),
+					),
+				),
+			),
+			Id("bucket").Op("=").Op("&").Id("limitBucket").Values(Dict{
+				Id("tokens"): Id("limit").Dot("burst"), Id("last"): Id("now"), Id("limit"): Id("limit"),
+			}),
+			Id("limitBuckets").Dot("buckets").Index(Id("key")).Op("=").Id("bucket"),
+		),
+		List(Id("bucket").Dot("tokens"), Id("bucket").Dot("last")).Op("=").List(Id("refill").Call(Id("bucket")), Id("now")),
+		If(Id("bucket").Dot("tokens").Op(">=").Lit(1)).Block(
+			Id("bucket").Dot("tokens").Op("--"),
+			Return(Lit(0)),
+		),
+		Return(Qual("time", "Duration").Call(
+			Parens(Lit(1).Op("-").Id("bucket").Dot("tokens")).Op("/").Id("limit").Dot("rate").
+				Op("*").Float64().Call(Qual("time", "Second")),
+		)),
+	)
+
+	f.Func().Id("limitRejectHelper").Params(
+		Id("w").Qual("net/http", "ResponseWriter"), Id("wait").Qual("time", "Duration"),
+	).Block(
+		Id("seconds").Op(":=").Int().Call(Qual("math", "Ceil").Call(Id("wait").Dot("Seconds").Call())),
+		Id("w").Dot("Header").Call().Dot("Set").Call(Lit("Retry-After"), Qual("strconv", "Itoa").Call(Id("seconds"))),
+		Id("w").Dot("Header").Call().Dot("Set").Call(Lit("Content-Type"), Lit("application/json")),
+		Id("w").Dot("WriteHeader").Call(Qual("net/http", "StatusTooManyRequests")),
+		Qual("encoding/json", "NewEncoder").Call(Id("w")).Dot("Encode").Call(
+			Map(String()).String().Values(Dict{Lit("err"): Lit("Too Many Requests")}),
+		),
+	)
+
+	//Concurrency limit is checked after rate limit, request waits for slot no more than second.
+	f.Func().Id(LimitHelper).Params(
+		Id("w").Qual("net/http", "ResponseWriter"), Id("r").Op("*").Qual("net/http", "Request"),
+	).Params(Id("release").Func().Params(), Id("ok").Bool()).BlockFunc(func(g *Group) {
+		g.List(Id("limit"), Id("found")).Op(":=").Id("routeLimits").Index(Id("r").Dot("URL").Dot("Path"))
+		g.If(Op("!").Id("found")).Block(Return(Func().Params().Block(), True()))
+		g.If(Id("limit").Dot("rate").Op("!=").Lit(0)).BlockFunc(func(g *Group) {
+			limitKey(info, g)
+			g.If(
+				Id("wait").Op(":=").Id("limitTakeHelper").Call(Id("r").Dot("URL").Dot("Path").Op("+").Lit(" ").Op("+").Id("key"), Id("limit")),
+				Id("wait").Op(">").Lit(0),
+			).Block(
+				Id("limitRejectHelper").Call(Id("w"), Id("wait")),
+				Return(Nil(), False()),
+			)
+		})
+		g.If(Id("limit").Dot("slots").Op("==").Nil()).Block(Return(Func().Params().Block(), True()))
+		g.Select().Block(
+			Case(Id("limit").Dot("slots").Op("<-").Struct().Values()).Block(
+				Return(Func().Params().Block(Op("<-").Id("limit").Dot("slots")), True()),
+			),
+			Case(Op("<-").Qual("time", "After").Call(Qual("time", "Second"))).Block(
+				Id("limitRejectHelper").Call(Id("w"), Qual("time", "Second")),
+				Return(Nil(), False()),
+			),
+		)
+	})
+}
+
+//addRetryTransport creates transport of clients that retries requests rejected with 429 after
+//delay from Retry-After header (exponential backoff with jitter if header is missing).
+func addRetryTransport(f *File) {
+	f.Type().Id("retryTransport").Struct(Id("next").Qual("net/http", "RoundTripper"))
+	f.Func().Params(Id("t").Op("*").Id("retryTransport")).Id("RoundTrip").Params(
+		Id("req").Op("*").Qual("net/http", "Request"),
+	).Params(Op("*").Qual("net/http", "Response"), Error()).Block(
+		For(Id("attempt").Op(":=").Lit(0), Empty(), Id("attempt").Op("++")).Block(
+			List(Id("resp"), Err()).Op(":=").Id("t").Dot("next").Dot("RoundTrip").Call(Id("req")),
+			Id("replayable").Op(":=").Id("req").Dot("Body").Op("==").Nil().Op("||").
+				Id("req").Dot("Body").Op("==").Qual("net/http", "NoBody").Op("||").Id("req").Dot("GetBody").Op("!=").Nil(),
+			If(
+				Err().Op("!=").Nil().Op("||").Id("resp").Dot("StatusCode").Op("!=").Qual("net/http", "StatusTooManyRequests").
+					Op("||").Id("attempt").Op("==").Lit(maxRetries).Op("||").Op("!").Id("replayable"),
+			).Block(Return(Id("resp"), Err())),
+			Id("delay").Op(":=").Qual("time", "Duration").Call(Lit(100).Op("<<").Id("attempt")).Op("*").Qual("time", "Millisecond"),
+			If(
+				List(Id("seconds"), Err()).Op(":=").Qual("strconv", "Atoi").Call(Id("resp").Dot("Header").Dot("Get").Call(Lit("Retry-After"))),
+				Err().Op("==").Nil(),
+			).Block(
+				Id("delay").Op("=").Qual("time", "Duration").Call(Id("seconds")).Op("*").Qual("time", "Second"),
+			),
+			If(Id("delay").Op(">").Lit(int(maxRetryDelay.Seconds())).Op("*").Qual("time", "Second")).Block(Return(Id("resp"), Nil())),
+			Id("delay").Op("+=").Qual("time", "Duration").Call(Qual("math/rand", "Int63n").Call(Int64().Call(Id("delay").Op("/").Lit(5)).Op("+").Lit(1))),
+			Id("resp").Dot("Body").Dot("Close").Call(),
+			Select().Block(
+				Case(Op("<-").Id("req").Dot("Context").Call().Dot("Done").Call()).Block(
+					Return(Nil(), Id("req").Dot("Context").Call().Dot("Err").Call()),
+				),
+				Case(Op("<-").Qual("time", "After").Call(Id("delay"))).Block(),
+			),
+			If(Id("req").Dot("GetBody").Op("!=").Nil()).Block(
+				List(Id("body"), Err()).Op(":=").Id("req").Dot("GetBody").Call(),
+				If(Err().Op("!=").Nil()).Block(Return(Nil(), Err())),
+				Id("req").Op("=").Id("req").Dot("Clone").Call(Id("req").Dot("Context").Call()),
+				Id("req").Dot("Body").Op("=").Id("body"),
+			),
+		),
+	)
+}
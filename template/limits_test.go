@@ -0,0 +1,56 @@
+package template
+
+import (
+	"testing"
+
+	"github.com/angrypie/tie/parser"
+	"github.com/angrypie/tie/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetLimit(t *testing.T) {
+	limit := parser.Directive{Name: LimitDirective, Args: map[string]string{"rate": "6/m", "concurrency": "2"}}
+	info := &PackageInfo{Service: &types.Service{Limits: &types.Limits{
+		Limit:     types.Limit{Rate: "10"},
+		Functions: map[string]types.Limit{"Reset": {Burst: 1}},
+	}}}
+	info.Functions = []parser.Function{
+		{Name: "Hello"},
+		{Name: "Reset", Directives: []parser.Directive{limit}},
+	}
+	require.NoError(t, ValidateLimits(info))
+	hello, err := GetLimit(info, info.Functions[0])
+	require.NoError(t, err)
+	require.Equal(t, Limit{Rate: 10, Burst: 10}, hello)
+	reset, err := GetLimit(info, info.Functions[1])
+	require.NoError(t, err)
+	require.Equal(t, Limit{Rate: 0.1, Burst: 1, Concurrency: 2}, reset)
+
+	info.Service.Limits.Functions["Unknown"] = types.Limit{}
+	require.EqualError(t, ValidateLimits(info), "limits: unknown function Unknown")
+
+	info.Service.Limits = &types.Limits{Key: "principal"}
+	require.EqualError(t, ValidateLimits(info), "limits: principal key requires authentication")
+
+	info.Functions[1].Directives[0].Args["rate"] = "1/d"
+	require.EqualError(t, ValidateLimits(info), `Reset: limit: invalid rate "1/d" (e.g. 10/s, 100/m, 1000/h)`)
+}
+
+func TestBodyLimit(t *testing.T) {
+	info := &PackageInfo{Service: &types.Service{}}
+	limit, ok, err := BodyLimit(info)
+	require.NoError(t, err)
+	require.False(t, ok)
+	require.Equal(t, int64(DefaultBodyLimit), limit)
+
+	for size, expected := range map[string]int64{"100": 100, "512K": 512 << 10, "4MB": 4 << 20, "1G": 1 << 30} {
+		info.Service.HTTP = &types.HTTP{BodyLimit: size}
+		limit, ok, err = BodyLimit(info)
+		require.NoError(t, err)
+		require.True(t, ok)
+		require.Equal(t, expected, limit, size)
+	}
+
+	info.Service.HTTP.BodyLimit = "4 MB"
+	require.EqualError(t, ValidateLimits(info), `http.body_limit: invalid size "4 MB" (e.g. 512K, 4M)`)
+}
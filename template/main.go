@@ -15,13 +15,14 @@ type Module = modutils.Module
 func GetMainPackage(packagePath string, modules []string) *Package {
 	f := NewFile("main")
 
-	f.Func().Id("main").Params().BlockFunc(func(g *Group) {
-		for _, module := range modules {
-			importPath := path.Join(packagePath, "tie_modules", module)
-			g.Qual(importPath, "Main").Call()
-		}
-		makeWaitGuard(g)
-	})
+	//Servers of all modules share one lifecycle (receivers, state and shutdown)
+	f.Func().Id("main").Params().Block(
+		Qual(path.Join(packagePath, "tie_modules", LifecycleModule), RunHelper).CallFunc(func(g *Group) {
+			for _, module := range modules {
+				g.Qual(path.Join(packagePath, "tie_modules", module), ServeHelper)
+			}
+		}),
+	)
 
 	return modutils.NewPackage("main", "main.go", f.GoString())
 }
@@ -33,8 +34,13 @@ func NewMainModule(p *parser.Parser, deps []Module) Module {
 	}
 
 	generator := func(p *parser.Parser) *Package {
-		return GetMainPackage(p.Package.Name, modules)
+		pkg := GetMainPackage(p.Package.Name, modules)
+		pkg.Files = append(pkg.Files, modutils.File{
+			Name: APIDescriptionFile, Content: GetAPIDescription(NewPackageInfoFromParser(p)),
+		})
+		return pkg
 	}
+	deps = append(deps, NewLifecycleModule(p))
 	return modutils.NewStandartModule("tie_modules", generator, p, deps)
 }
 
@@ -44,14 +50,23 @@ type PackageInfo struct {
 	PackageName   string
 	IsInitService bool
 	IsStopService bool
-	Service       *types.Service
+	//IsHealth is true if package has Health() error function used in readiness check.
+	IsHealth bool
+	Service  *types.Service
 	//ServicePath should refer to modified original package.
 	servicePath string
 	ModulePath  string
+	//generateErr is first error of code generation.
+	generateErr error
 }
 
+//GetServicePath returns path of service package, transports of service use upgraded
+//package if one of them upgrades it.
 func (info PackageInfo) GetServicePath() string {
 	if info.servicePath == "" {
+		if upgraded := upgradedServicePath(info); upgraded != "" {
+			return upgraded
+		}
 		return info.ModulePath
 	}
 	return info.servicePath
@@ -61,6 +76,25 @@ func (info *PackageInfo) SetServicePath(path string) {
 	info.servicePath = path
 }
 
+//failGenerate keeps error of code generation, generated code is not valid.
+func (info *PackageInfo) failGenerate(err error) {
+	if info.generateErr == nil {
+		info.generateErr = err
+	}
+}
+
+//GenerateError returns first error of code generation (e.g. *CycleError).
+func (info *PackageInfo) GenerateError() error {
+	return info.generateErr
+}
+
+//NewPackage creates package of generated module with error of code generation.
+func NewPackage(info *PackageInfo, name, fileName, content string) *Package {
+	pkg := modutils.NewPackage(name, fileName, content)
+	pkg.Err = info.GenerateError()
+	return pkg
+}
+
 //TODO check receiver taht does not have constructors
 func (info PackageInfo) IsReceiverType(field types.Field) bool {
 	_, ok := info.GetConstructor(field)
@@ -68,8 +102,7 @@ func (info PackageInfo) IsReceiverType(field types.Field) bool {
 }
 
 func (info PackageInfo) GetConstructor(field types.Field) (constructor Constructor, ok bool) {
-	_, path, local := field.TypeParts()
-	constructor, ok = info.Constructors[path+"."+local]
+	constructor, ok = info.Constructors[constructorKey(field)]
 	return
 }
 
@@ -77,8 +110,7 @@ func (info PackageInfo) GetConstructor(field types.Field) (constructor Construct
 func (info PackageInfo) GetFunction(receiver types.Field, functionName string) (function parser.Function, ok bool) {
 	receiverType := receiver.TypeName()
 	for _, fn := range info.Functions {
-		//If receiver type have Stop method add it to special stoppableServices list
-		if HasReceiver(fn) && fn.Receiver.TypeName() == receiverType && fn.Name == "Stop" {
+		if HasReceiver(fn) && fn.Receiver.TypeName() == receiverType && fn.Name == functionName {
 			return fn, true
 		}
 	}
@@ -90,7 +122,7 @@ func NewPackageInfoFromParser(p *parser.Parser) *PackageInfo {
 
 	var fns []parser.Function
 	for _, fn := range functions {
-		if name := fn.Name; name == "InitService" || name == "StopService" {
+		if name := fn.Name; name == "InitService" || name == "StopService" || isHealthHook(fn) {
 			continue
 		}
 		fns = append(fns, fn)
@@ -111,13 +143,16 @@ func NewPackageInfoFromParser(p *parser.Parser) *PackageInfo {
 		if fn.Name == "StopService" {
 			info.IsStopService = true
 		}
+		if isHealthHook(fn) {
+			info.IsHealth = true
+		}
 
 		receiver, ok := isConventionalConstructor(fn)
 		if ok {
-			_, path, local := receiver.TypeParts()
-			info.Constructors[path+"."+local] = *NewTypeConstructor(fn, receiver)
+			info.Constructors[constructorKey(receiver)] = *NewTypeConstructor(fn, receiver)
 		}
 	}
+	info.Functions = append(info.Functions, createSessionFunctions(&info)...)
 
 	return &info
 }
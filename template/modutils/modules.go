@@ -16,6 +16,8 @@ type File struct {
 type Package struct {
 	Name  string
 	Files []File
+	//Err is error of code generation, package is not written.
+	Err error
 }
 
 func NewPackage(name, fileName, fileContent string) *Package {
@@ -44,15 +46,24 @@ func TraverseModules(module Module, path []string, cb func(p Module, path []stri
 	return
 }
 
+//Validator is implemented by modules that check package before code generation.
+type Validator interface {
+	Validate() error
+}
+
 type StandartModule struct {
 	name     string
 	Parser   *parser.Parser
 	deps     []Module
 	generate Generator
+	validate ValidateFunc
 }
 
 type Generator = func(*parser.Parser) *Package
 
+//ValidateFunc returns error if package can't be generated by module.
+type ValidateFunc = func(*parser.Parser) error
+
 func NewStandartModule(name string, gen Generator, p *parser.Parser, deps []Module) *StandartModule {
 	return &StandartModule{
 		name:     name,
@@ -76,3 +87,16 @@ func (module StandartModule) Generate() (pkg *Package) {
 	}
 	return module.generate(module.Parser)
 }
+
+//WithValidator sets function that checks package before code generation.
+func (module *StandartModule) WithValidator(validate ValidateFunc) *StandartModule {
+	module.validate = validate
+	return module
+}
+
+func (module StandartModule) Validate() error {
+	if module.validate == nil {
+		return nil
+	}
+	return module.validate(module.Parser)
+}
@@ -0,0 +1,99 @@
+package template
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/angrypie/tie/parser"
+	"github.com/angrypie/tie/types"
+)
+
+//Naming strategies of fields of generated types (see types.JSON).
+const (
+	NamingLower = "lower"
+	NamingCamel = "camel"
+	NamingSnake = "snake"
+	NamingAsIs  = "as-is"
+)
+
+//GetNaming returns naming strategy of service (lower by default).
+func GetNaming(info *PackageInfo) string {
+	if info.Service.JSON == nil || info.Service.JSON.Naming == "" {
+		return NamingLower
+	}
+	return info.Service.JSON.Naming
+}
+
+//JSONName returns name of argument, result or constructor argument in encoded request,
+//response and receiver objects. It is used by server, client and schema generators.
+func JSONName(info *PackageInfo, name string) string {
+	switch GetNaming(info) {
+	case NamingCamel:
+		return toCamelCase(name)
+	case NamingSnake:
+		return ToSnakeCase(name)
+	case NamingAsIs:
+		return name
+	}
+	return strings.ToLower(name)
+}
+
+//toCamelCase lowers first word of name (e.g. UserName to userName, HTTPServer to httpServer).
+func toCamelCase(name string) string {
+	runes := []rune(name)
+	upper := 0
+	for upper < len(runes) && unicode.IsUpper(runes[upper]) {
+		upper++
+	}
+	//Last capital of acronym starts next word
+	if upper > 1 && upper < len(runes) {
+		upper--
+	}
+	for i := 0; i < upper; i++ {
+		runes[i] = unicode.ToLower(runes[i])
+	}
+	return string(runes)
+}
+
+//ValidateNaming returns error if naming strategy is unknown or if fields of generated type
+//have the same name (they would be ignored by encoding/json).
+func ValidateNaming(info *PackageInfo) (err error) {
+	switch GetNaming(info) {
+	case NamingLower, NamingCamel, NamingSnake, NamingAsIs:
+	default:
+		return fmt.Errorf("json: unknown naming %s (lower, camel, snake or as-is)", GetNaming(info))
+	}
+	unique := func(name string, fields []types.Field) error {
+		names := make(map[string]string)
+		for _, field := range fields {
+			if f, ok := field.(parser.Field); ok && !isWireField(f) {
+				continue
+			}
+			key := JSONName(info, field.Name())
+			if other, ok := names[key]; ok {
+				return fmt.Errorf("%s: %s and %s are both encoded as %s", name, other, field.Name(), key)
+			}
+			names[key] = field.Name()
+		}
+		return nil
+	}
+	ForEachFunction(info, true, func(fn parser.Function) {
+		if err != nil {
+			return
+		}
+		if err = unique(functionName(fn), CreateCombinedHandlerArgs(fn, info)); err != nil {
+			return
+		}
+		err = unique(functionName(fn), fieldsFromParser(fn.Results.List()))
+	})
+	if err != nil {
+		return
+	}
+	for _, c := range info.Constructors {
+		if err = unique(c.Function.Name, fieldsFromParser(filterHelperArgs(c.Function.Arguments, info))); err != nil {
+			return
+		}
+	}
+	return
+}
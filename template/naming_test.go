@@ -0,0 +1,49 @@
+package template
+
+import (
+	"go/types"
+	"testing"
+
+	"github.com/angrypie/tie/parser"
+	tieTypes "github.com/angrypie/tie/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJSONName(t *testing.T) {
+	info := &PackageInfo{Service: &tieTypes.Service{}}
+	names := []string{"firstName", "UserID", "HTTPServer", "ID"}
+	for naming, expected := range map[string][]string{
+		"":          {"firstname", "userid", "httpserver", "id"},
+		NamingCamel: {"firstName", "userID", "httpServer", "id"},
+		NamingSnake: {"first_name", "user_id", "httpserver", "id"},
+		NamingAsIs:  {"firstName", "UserID", "HTTPServer", "ID"},
+	} {
+		info.Service.JSON = &tieTypes.JSON{Naming: naming}
+		require.NoError(t, ValidateNaming(info))
+		for i, name := range names {
+			require.Equal(t, expected[i], JSONName(info, name), naming)
+		}
+	}
+
+	str := types.Typ[types.String]
+	results, err := parser.NewResultFields(
+		parser.NewField(types.NewVar(0, nil, "id", str)),
+		parser.NewField(types.NewVar(0, nil, "err", types.Universe.Lookup("error").Type())),
+	)
+	require.NoError(t, err)
+	info.Functions = []parser.Function{{
+		Name: "Create",
+		Arguments: []parser.Field{
+			parser.NewField(types.NewVar(0, nil, "userId", str)),
+			parser.NewField(types.NewVar(0, nil, "userID", str)),
+		},
+		Results: results,
+	}}
+	info.Service.JSON = nil
+	require.EqualError(t, ValidateNaming(info), "Create: userId and userID are both encoded as userid")
+	info.Service.JSON = &tieTypes.JSON{Naming: NamingCamel}
+	require.NoError(t, ValidateNaming(info))
+
+	info.Service.JSON.Naming = "kebab"
+	require.EqualError(t, ValidateNaming(info), "json: unknown naming kebab (lower, camel, snake or as-is)")
+}
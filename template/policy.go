@@ -0,0 +1,326 @@
+package template
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/angrypie/tie/parser"
+	"github.com/angrypie/tie/types"
+	. "github.com/dave/jennifer/jen"
+)
+
+//IdempotentDirective marks method or all methods of receiver (on constructor) that can
+//be retried by clients: //tie:idempotent, with key argument servers also replay response
+//for duplicate idempotency keys: //tie:idempotent key ttl=24h.
+const IdempotentDirective = "idempotent"
+
+//RetryableHelper marks error of transport, clients retry only such errors and they
+//are counted by circuit breaker.
+const RetryableHelper = "retryableHelper"
+
+const callPolicyHelper = "callPolicyHelper"
+
+//Defaults of client policy.
+const (
+	defaultRetries         = 2
+	defaultBackoff         = 100 * time.Millisecond
+	defaultMaxBackoff      = 5 * time.Second
+	defaultBreakerFailures = 5
+	defaultBreakerCooldown = 10 * time.Second
+	defaultMaxEventSize    = 1 << 20
+	defaultConsumeTimeout  = time.Minute
+)
+
+//ClientPolicy is resolved policy of function calls.
+type ClientPolicy struct {
+	Timeout, Backoff, MaxBackoff time.Duration
+	//Retries is number of retries, zero if function is not idempotent.
+	Retries int
+}
+
+//clientConfig returns client configuration of service.
+func clientConfig(info *PackageInfo) types.Client {
+	if info.Service.Client == nil {
+		return types.Client{}
+	}
+	return *info.Service.Client
+}
+
+//mergePolicy overrides policy with fields that are set in config.
+func mergePolicy(policy ClientPolicy, config types.ClientPolicy) (ClientPolicy, bool, error) {
+	durations := []struct {
+		name   string
+		value  string
+		target *time.Duration
+	}{
+		{"timeout", config.Timeout, &policy.Timeout},
+		{"backoff", config.Backoff, &policy.Backoff},
+		{"max_backoff", config.MaxBackoff, &policy.MaxBackoff},
+	}
+	for _, d := range durations {
+		if d.value == "" {
+			continue
+		}
+		value, err := time.ParseDuration(d.value)
+		if err != nil || value <= 0 {
+			return policy, false, fmt.Errorf("%s must be positive duration (e.g. 5s)", d.name)
+		}
+		*d.target = value
+	}
+	if config.Retries != nil {
+		if *config.Retries < 0 {
+			return policy, false, fmt.Errorf("retries can't be negative")
+		}
+		policy.Retries = *config.Retries
+	}
+	return policy, config.Idempotent, nil
+}
+
+//IsIdempotent returns true if function or its receiver has idempotent directive or function
+//accepts idempotency key.
+func IsIdempotent(info *PackageInfo, fn parser.Function) bool {
+	_, ok := idempotentDirective(info, fn)
+	return ok || IsKeyed(info, fn)
+}
+
+//GetClientPolicy returns policy of function calls: default policy of service is overridden
+//by policy of function, retries are allowed only for idempotent functions.
+func GetClientPolicy(info *PackageInfo, fn parser.Function) (policy ClientPolicy, err error) {
+	config := clientConfig(info)
+	policy = ClientPolicy{Retries: defaultRetries, Backoff: defaultBackoff, MaxBackoff: defaultMaxBackoff}
+	policy, idempotent, err := mergePolicy(policy, config.ClientPolicy)
+	if err != nil {
+		return
+	}
+	policy, idempotentFn, err := mergePolicy(policy, config.Functions[functionName(fn)])
+	if err != nil {
+		return
+	}
+	if !idempotent && !idempotentFn && !IsIdempotent(info, fn) {
+		policy.Retries = 0
+	}
+	return
+}
+
+//breakerLimits returns number of failures that opens circuit and cooldown, ok is false
+//if circuit breaker is not configured.
+func breakerLimits(info *PackageInfo) (failures int, cooldown time.Duration, ok bool, err error) {
+	breaker := clientConfig(info).Breaker
+	if breaker == nil {
+		return
+	}
+	failures, cooldown, ok = defaultBreakerFailures, defaultBreakerCooldown, true
+	if breaker.Failures < 0 {
+		return 0, 0, false, fmt.Errorf("client.breaker: failures can't be negative")
+	}
+	if breaker.Failures != 0 {
+		failures = breaker.Failures
+	}
+	if breaker.Cooldown != "" {
+		if cooldown, err = time.ParseDuration(breaker.Cooldown); err != nil || cooldown <= 0 {
+			return 0, 0, false, fmt.Errorf("client.breaker: cooldown must be positive duration (e.g. 10s)")
+		}
+	}
+	return
+}
+
+//StreamLimits returns maximum size of event and time client waits for consumer to
+//receive event of stream (see types.Stream).
+func StreamLimits(info *PackageInfo) (maxEventSize int, consumeTimeout time.Duration, err error) {
+	maxEventSize, consumeTimeout = defaultMaxEventSize, defaultConsumeTimeout
+	stream := clientConfig(info).Stream
+	if stream == nil {
+		return
+	}
+	if stream.MaxEventSize < 0 {
+		return 0, 0, fmt.Errorf("client.stream: max_event_size can't be negative")
+	}
+	if stream.MaxEventSize != 0 {
+		maxEventSize = stream.MaxEventSize
+	}
+	if stream.ConsumeTimeout != "" {
+		if consumeTimeout, err = time.ParseDuration(stream.ConsumeTimeout); err != nil || consumeTimeout <= 0 {
+			return 0, 0, fmt.Errorf("client.stream: consume_timeout must be positive duration (e.g. 1m)")
+		}
+	}
+	return
+}
+
+//ValidateClientPolicy returns error if client configuration is malformed or refers to
+//unknown functions.
+func ValidateClientPolicy(info *PackageInfo) (err error) {
+	if _, _, _, err = breakerLimits(info); err != nil {
+		return
+	}
+	if _, _, err = StreamLimits(info); err != nil {
+		return
+	}
+	names := make(map[string]bool)
+	ForEachFunction(info, true, func(fn parser.Function) {
+		names[functionName(fn)] = true
+		if _, e := GetClientPolicy(info, fn); e != nil && err == nil {
+			err = fmt.Errorf("%s: client: %w", functionName(fn), e)
+		}
+	})
+	if err != nil {
+		return
+	}
+	for name := range clientConfig(info).Functions {
+		if !names[name] {
+			return fmt.Errorf("client: unknown function %s", name)
+		}
+	}
+	return nil
+}
+
+//isStreamFunction returns true if function has stream argument or result, calls of such
+//functions are not limited by client policy.
+func isStreamFunction(fn parser.Function) bool {
+	_, isResult := GetStreamResult(fn)
+	_, isArgument := GetStreamArgument(fn)
+	return isResult || isArgument
+}
+
+//clientPolicyCode returns code of policy of function, ok is false if calls are not
+//restricted by policy.
+func clientPolicyCode(info *PackageInfo, fn parser.Function) (code *Statement, ok bool) {
+	if isStreamFunction(fn) {
+		return
+	}
+	policy, _ := GetClientPolicy(info, fn)
+	_, _, breaker, _ := breakerLimits(info)
+	if policy.Timeout == 0 && policy.Retries == 0 && !breaker {
+		return
+	}
+	duration := func(d time.Duration) *Statement {
+		return Lit(int(d.Milliseconds())).Op("*").Qual("time", "Millisecond")
+	}
+	values := Dict{}
+	if policy.Timeout != 0 {
+		values[Id("timeout")] = duration(policy.Timeout)
+	}
+	if policy.Retries != 0 {
+		values[Id("retries")] = Lit(policy.Retries)
+		values[Id("backoff")] = duration(policy.Backoff)
+		values[Id("maxBackoff")] = duration(policy.MaxBackoff)
+	}
+	return Id("clientPolicy").Values(values), true
+}
+
+//usesClientPolicy returns true if calls of any function are restricted by policy.
+func usesClientPolicy(info *PackageInfo) bool {
+	uses := false
+	ForEachFunction(info, true, func(fn parser.Function) {
+		_, ok := clientPolicyCode(info, fn)
+		uses = uses || ok
+	})
+	return uses
+}
+
+//clientContext returns context argument of function or background context.
+func clientContext(fn parser.Function, request string) *Statement {
+	for _, arg := range fn.Arguments {
+		if IsContextField(arg) {
+			return Id(request).Dot(strings.Title(arg.Name()))
+		}
+	}
+	return Qual("context", "Background").Call()
+}
+
+//AddClientPolicyHelpers creates retryableHelper and helper that calls function with policy:
+//each attempt has timeout, failures of transport are retried with exponential backoff
+//and jitter, circuit breaker of service fails calls while it is open.
+func AddClientPolicyHelpers(info *PackageInfo, f *File) {
+	f.Type().Id("retryableError").Struct(Error())
+	f.Func().Params(Id("e").Id("retryableError")).Id("Unwrap").Params().Error().Block(Return(Id("e").Dot("error")))
+	f.Func().Id(RetryableHelper).Params(Err().Error()).Error().Block(
+		If(Err().Op("==").Nil()).Block(Return(Nil())),
+		Return(Id("retryableError").Values(Err())),
+	)
+	if !usesClientPolicy(info) {
+		return
+	}
+	failures, cooldown, breaker, _ := breakerLimits(info)
+
+	f.Type().Id("clientPolicy").Struct(
+		List(Id("timeout"), Id("backoff"), Id("maxBackoff")).Qual("time", "Duration"),
+		Id("retries").Int(),
+	)
+	if breaker {
+		f.Comment("ErrCircuitOpen is returned without calling service while circuit breaker is open.")
+		f.Var().Id("ErrCircuitOpen").Op("=").Qual("errors", "New").
+			Call(Lit(fmt.Sprintf("circuit breaker of %s is open", info.Service.Alias)))
+		f.Var().Id("breaker").Struct(
+			Qual("sync", "Mutex"),
+			Id("failures").Int(),
+			Id("openUntil").Qual("time", "Time"),
+			Id("probing").Bool(),
+		)
+		//Open circuit allows one probe call after cooldown (half-open state).
+		f.Func().Id("breakerAllowHelper").Params().Bool().Block(
+			Id("breaker").Dot("Lock").Call(),
+			Defer().Id("breaker").Dot("Unlock").Call(),
+			If(Id("breaker").Dot("failures").Op("<").Lit(failures)).Block(Return(True())),
+			If(
+				Qual("time", "Now").Call().Dot("Before").Call(Id("breaker").Dot("openUntil")).
+					Op("||").Id("breaker").Dot("probing"),
+			).Block(Return(False())),
+			Id("breaker").Dot("probing").Op("=").True(),
+			Return(True()),
+		)
+		f.Func().Id("breakerDoneHelper").Params(Id("failed").Bool()).Block(
+			Id("breaker").Dot("Lock").Call(),
+			Defer().Id("breaker").Dot("Unlock").Call(),
+			Id("breaker").Dot("probing").Op("=").False(),
+			If(Op("!").Id("failed")).Block(
+				Id("breaker").Dot("failures").Op("=").Lit(0),
+				Return(),
+			),
+			Id("breaker").Dot("failures").Op("++"),
+			If(Id("breaker").Dot("failures").Op(">=").Lit(failures)).Block(
+				Id("breaker").Dot("openUntil").Op("=").Qual("time", "Now").Call().Dot("Add").
+					Call(Lit(int(cooldown.Milliseconds())).Op("*").Qual("time", "Millisecond")),
+			),
+		)
+	}
+
+	f.Func().Id(callPolicyHelper).Params(
+		Id("parent").Qual("context", "Context"), Id("policy").Id("clientPolicy"),
+		Id("call").Func().Params(Qual("context", "Context")).Error(),
+	).Params(Err().Error()).BlockFunc(func(g *Group) {
+		g.For(Id("attempt").Op(":=").Lit(0), Empty(), Id("attempt").Op("++")).BlockFunc(func(g *Group) {
+			if breaker {
+				g.If(Op("!").Id("breakerAllowHelper").Call()).Block(Return(Id("ErrCircuitOpen")))
+			}
+			g.List(Id("ctx"), Id("cancel")).Op(":=").Qual("context", "WithCancel").Call(Id("parent"))
+			g.If(Id("policy").Dot("timeout").Op("!=").Lit(0)).Block(
+				Id("cancel").Call(),
+				List(Id("ctx"), Id("cancel")).Op("=").Qual("context", "WithTimeout").Call(Id("parent"), Id("policy").Dot("timeout")),
+			)
+			g.Err().Op("=").Id("call").Call(Id("ctx"))
+			g.Id("cancel").Call()
+			g.Var().Id("retryable").Id("retryableError")
+			g.Id("failed").Op(":=").Qual("errors", "As").Call(Err(), Op("&").Id("retryable"))
+			if breaker {
+				g.Id("breakerDoneHelper").Call(Id("failed"))
+			}
+			g.If(
+				Op("!").Id("failed").Op("||").Id("attempt").Op(">=").Id("policy").Dot("retries").
+					Op("||").Id("parent").Dot("Err").Call().Op("!=").Nil(),
+			).Block(Return(Err()))
+			g.Comment("Exponential backoff with jitter (half of delay is random)")
+			g.Id("delay").Op(":=").Id("policy").Dot("backoff").Op("<<").Id("attempt")
+			g.If(Id("delay").Op(">").Id("policy").Dot("maxBackoff").Op("||").Id("delay").Op("<=").Lit(0)).Block(
+				Id("delay").Op("=").Id("policy").Dot("maxBackoff"),
+			)
+			g.Id("delay").Op("=").Id("delay").Op("/").Lit(2).Op("+").Qual("time", "Duration").Call(
+				Qual("math/rand", "Int63n").Call(Int64().Call(Id("delay").Op("/").Lit(2)).Op("+").Lit(1)),
+			)
+			g.Select().Block(
+				Case(Op("<-").Id("parent").Dot("Done").Call()).Block(Return(Err())),
+				Case(Op("<-").Qual("time", "After").Call(Id("delay"))),
+			)
+		})
+	})
+}
@@ -0,0 +1,49 @@
+package template
+
+import (
+	"testing"
+	"time"
+
+	"github.com/angrypie/tie/parser"
+	"github.com/angrypie/tie/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetClientPolicy(t *testing.T) {
+	retries := 4
+	idempotent := parser.Directive{Name: IdempotentDirective, Args: map[string]string{}}
+	info := &PackageInfo{Service: &types.Service{Client: &types.Client{
+		ClientPolicy: types.ClientPolicy{Timeout: "2s"},
+		Functions:    map[string]types.ClientPolicy{"Get": {Timeout: "500ms", Retries: &retries}},
+	}}}
+	info.Functions = []parser.Function{
+		{Name: "Create"},
+		{Name: "Get", Directives: []parser.Directive{idempotent}},
+	}
+	require.NoError(t, ValidateClientPolicy(info))
+	create, err := GetClientPolicy(info, info.Functions[0])
+	require.NoError(t, err)
+	require.Equal(t, ClientPolicy{Timeout: 2 * time.Second, Backoff: defaultBackoff, MaxBackoff: defaultMaxBackoff}, create)
+	get, err := GetClientPolicy(info, info.Functions[1])
+	require.NoError(t, err)
+	require.Equal(t, ClientPolicy{
+		Timeout: 500 * time.Millisecond, Retries: 4, Backoff: defaultBackoff, MaxBackoff: defaultMaxBackoff,
+	}, get)
+
+	info.Service.Client.Functions["Delete"] = types.ClientPolicy{}
+	require.EqualError(t, ValidateClientPolicy(info), "client: unknown function Delete")
+
+	info.Service.Client = &types.Client{ClientPolicy: types.ClientPolicy{Backoff: "-1s"}}
+	require.EqualError(t, ValidateClientPolicy(info), "Create: client: backoff must be positive duration (e.g. 5s)")
+
+	info.Service.Client = &types.Client{Breaker: &types.Breaker{Cooldown: "soon"}}
+	require.EqualError(t, ValidateClientPolicy(info), "client.breaker: cooldown must be positive duration (e.g. 10s)")
+
+	info.Service.Client = &types.Client{Stream: &types.Stream{MaxEventSize: 4096}}
+	size, timeout, err := StreamLimits(info)
+	require.NoError(t, err)
+	require.Equal(t, 4096, size)
+	require.Equal(t, defaultConsumeTimeout, timeout)
+	info.Service.Client.Stream.ConsumeTimeout = "0s"
+	require.EqualError(t, ValidateClientPolicy(info), "client.stream: consume_timeout must be positive duration (e.g. 1m)")
+}
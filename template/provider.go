@@ -0,0 +1,105 @@
+package template
+
+import (
+	"go/ast"
+
+	"github.com/angrypie/tie/parser"
+	"github.com/angrypie/tie/types"
+	. "github.com/dave/jennifer/jen"
+)
+
+//getProviderGetters returns getters if field is interface that can be implemented
+//by generated provider: exported interface of getters with serializable results.
+func getProviderGetters(field parser.Field) (getters []parser.Field, ok bool) {
+	_, _, local := field.TypeParts()
+	if !ast.IsExported(local) {
+		return nil, false
+	}
+	getters, ok = field.Getters()
+	if !ok {
+		return nil, false
+	}
+	for _, getter := range getters {
+		if isFuncType(getter.TypeName()) || getter.IsChan() {
+			return nil, false
+		}
+	}
+	return getters, true
+}
+
+//IsProvided returns true if field is getter interface implemented by generated provider.
+func IsProvided(field parser.Field) bool {
+	_, ok := getProviderGetters(field)
+	return ok
+}
+
+//providerType returns name of generated provider type for interface field.
+func providerType(field types.Field) string {
+	_, _, local := field.TypeParts()
+	return "provider" + local
+}
+
+//providerConstructor returns name of function that creates provider from interface implementation.
+func providerConstructor(field types.Field) string {
+	return "newProvider" + TrimPrefix(field.TypeName())
+}
+
+//providerValue returns name of provider field that holds getter value.
+func providerValue(getter parser.Field) string {
+	return "Value" + getter.Name()
+}
+
+//CreateProviders creates provider types for getter interfaces used as constructor
+//arguments. Provider holds getter values, so it can be populated from configuration
+//or transferred over the wire.
+func CreateProviders(info *PackageInfo, f *File) {
+	constructors, _ := NewDepsGraph(info).Order()
+	done := make(map[string]bool)
+	for _, c := range constructors {
+		for _, arg := range c.Function.Arguments {
+			getters, ok := getProviderGetters(arg)
+			if !ok || done[constructorKey(arg)] {
+				continue
+			}
+			done[constructorKey(arg)] = true
+			createProvider(arg, getters, info, f)
+		}
+	}
+}
+
+func createProvider(field parser.Field, getters []parser.Field, info *PackageInfo, f *File) {
+	name := providerType(field)
+	f.Type().Id(name).StructFunc(func(g *Group) {
+		for _, getter := range getters {
+			g.Id(providerValue(getter)).Add(createTypeFromField(getter, info)).
+				Tag(map[string]string{"json": ToSnakeCase(getter.Name())})
+		}
+	})
+
+	for _, getter := range getters {
+		f.Func().Params(Id("p").Op("*").Id(name)).Id(getter.Name()).Params().
+			Add(createTypeFromField(getter, info)).Block(
+			Return(Id("p").Dot(providerValue(getter))),
+		)
+	}
+
+	//Provider constructor copies values from other implementation (e.g. on client side)
+	f.Func().Id(providerConstructor(field)).
+		Params(Id("source").Add(createTypeFromField(field, info))).
+		Params(Id("p").Id(name)).BlockFunc(func(g *Group) {
+		g.If(Id("source").Op("==").Nil()).Block(Return())
+		for _, getter := range getters {
+			g.Id("p").Dot(providerValue(getter)).Op("=").Id("source").Dot(getter.Name()).Call()
+		}
+		g.Return()
+	})
+}
+
+//providerSchema describes provider type of getter interface.
+func providerSchema(getters []parser.Field) parser.Schema {
+	properties := make(map[string]parser.Schema)
+	for _, getter := range getters {
+		properties[ToSnakeCase(getter.Name())] = getter.Schema()
+	}
+	return parser.ObjectSchema(properties, nil)
+}
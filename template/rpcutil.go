@@ -8,16 +8,15 @@ import (
 //StartRPCServerCb is used to insert specific code to server init template.
 type StartRPCServerCb = func(g *Group, resource, instance string)
 
+//ServeHelper is exported function of module that starts server, it returns when server
+//is stopped (see lifecycle Run).
+const ServeHelper = "Serve"
+
 //MakeStartRPCServer creates server initialization method.
-func MakeStartRPCServer(info *PackageInfo, cb StartRPCServerCb, main *Group, f *File) {
-	main.Comment("MakeStartRPCServer (local)").Line()
+func MakeStartRPCServer(info *PackageInfo, cb StartRPCServerCb, f *File) {
 	f.Comment("MakeStartRPCServer (file)").Line()
 
-	//TODO handle thi error
-	main.Err().Op(":=").Id("startServer").Call()
-	main.If(Err().Op("!=").Nil()).Block(Panic(Err()))
-
-	f.Func().Id("startServer").Params().Params(Err().Error()).BlockFunc(func(g *Group) {
+	f.Func().Id(ServeHelper).Params().Params(Err().Error()).BlockFunc(func(g *Group) {
 		receiversCreated := MakeReceiversForHandlers(info, g)
 
 		resourceName := GetResourceName(info)
@@ -51,10 +50,31 @@ func GetRpcHandlerArgsList(request, response string) *Statement {
 	)
 }
 
+//RpcDeps returns dependencies supported by DefaultRpcHandler, principal is authenticated
+//by AuthRPCCall.
+func RpcDeps() DepsMap {
+	deps := DefaultDeps()
+	deps[DepContext.Name] = Id("ctx")
+	deps[DepPrincipal.Name] = Id(PrincipalHelper).Call(Id("ctx"))
+	deps[CallAuthorization] = Id("ctx")
+	return deps
+}
+
+//AuthHeaderHelper is module helper that returns credentials of RPC call from its metadata
+//(func(context.Context) http.Header), it is required if service is authenticated.
+const AuthHeaderHelper = "authHeaderHelper"
+
+//AuthRPCCall authenticates RPC call, ctx of handler is replaced by context with principal.
+func AuthRPCCall(info *PackageInfo, g *Group) {
+	if IsAuth(info) {
+		g.Id("ctx").Op("=").Id(AuthContextHelper).Call(Id("ctx"), Id(AuthHeaderHelper).Call(Id("ctx")))
+	}
+}
+
 func DefaultRpcHandler(info *PackageInfo, f *File, fn parser.Function) {
 	body := func(g *Group, resourceInstance string) {
-		deps := DepsMap{"getEnv": Id(GetEnvHelper)}
-		MakeOriginalCall(info, fn, g, deps, ifErrorReturnErrRPC(), resourceInstance)
+		AuthRPCCall(info, g)
+		MakeOriginalCall(info, fn, g, RpcDeps(), ifErrorReturnErrRPC(), resourceInstance)
 		g.Return(Nil())
 	}
 
@@ -89,24 +109,24 @@ func TemplateRpcServer(info *PackageInfo, f *File, config TemplateServerConfig)
 		config.GenHandler = DefaultRpcHandler
 	}
 
-	f.Func().Id("Main").Params().BlockFunc(func(main *Group) {
-		GracefulShutdown(info, main, f)
-		MakeInitService(info, main)
-		MakeStartRPCServer(info, config.GenResourceScope, main, f)
-	})
+	MakeStartRPCServer(info, config.GenResourceScope, f)
 
 	ForEachFunction(info, true, func(fn parser.Function) {
 		config.GenHandler(info, f, fn)
 	})
-	CreateReqRespTypes(info, f)
+	CreateReqRespTypes(info, f, false)
+	AddValidationHelpers(info, f)
 	AddGetEnvHelper(f)
+	AddConfigHelpers(f)
 }
 
 //TemplateServer creates template module for RPC client.
 func TemplateClient(info *PackageInfo, f *File, body ClientMethodBody) {
-	CreateReqRespTypes(info, f)
+	CreateReqRespTypes(info, f, true)
 	CreateTypeAliases(info, f)
 	clientMethods(info, body, f)
+	AddClientPolicyHelpers(info, f)
+	AddClientIdempotencyHelpers(info, f)
 }
 
 //clientMethods creates client method for each service function.
@@ -122,11 +142,14 @@ type ClientMethodBody = func(ids ClientMethodIds, g *Group)
 
 //ClientMethodIds contains identifiers that available in client method template.
 type ClientMethodIds struct {
-	Request  string //Request variable identifier
-	Response string //Response valiable identifier
-	Method   string //RPC Method string
-	Resource string //RPC Resource string
-	Err      string //Error variable identifer
+	Request  string          //Request variable identifier
+	Response string          //Response valiable identifier
+	Method   string          //RPC Method string
+	Resource string          //RPC Resource string
+	Err      string          //Error variable identifer
+	Function parser.Function //Original function
+	ShardKey *Statement      //Routing key of receiver (empty string if receiver is not sharded)
+	Context  *Statement      //Context of call (attempt context if call has policy)
 }
 
 //ClientMethod creates client method for given function.
@@ -157,14 +180,34 @@ func ClientMethod(fn parser.Function, info *PackageInfo, body ClientMethodBody,
 
 		errId := getResultsErrName(fn.Results)
 
-		//Add user body
-		body(ClientMethodIds{
+		ids := ClientMethodIds{
 			Method:   rpcMethodName,
 			Resource: resourceName,
 			Err:      errId,
 			Request:  request,
 			Response: response,
-		}, g)
+			Function: fn,
+			ShardKey: shardKeyCode(fn, info),
+			Context:  clientContext(fn, request),
+		}
+		//Key of call is sent by each attempt
+		if IsKeyed(info, fn) {
+			ids.Context = Id(WithIdempotencyKeyHelper).Call(ids.Context)
+		}
+		//Add user body, it is called for each attempt if call has policy
+		if policy, ok := clientPolicyCode(info, fn); ok {
+			parent := ids.Context
+			ids.Context = Id("ctx")
+			g.Id(errId).Op("=").Id(callPolicyHelper).Call(parent, policy, Func().
+				Params(Id("ctx").Qual("context", "Context")).Params(Id(errId).Error()).
+				BlockFunc(func(g *Group) {
+					body(ids, g)
+					g.Return()
+				}),
+			)
+		} else {
+			body(ids, g)
+		}
 
 		AddIfErrorGuard(g, nil, errId, nil)
 
@@ -0,0 +1,76 @@
+package template
+
+import (
+	"github.com/angrypie/tie/parser"
+	"github.com/angrypie/tie/types"
+)
+
+//RequestSchema returns JSON Schema of function request object (arguments transferred over the wire).
+func RequestSchema(fn parser.Function, info *PackageInfo) parser.Schema {
+	properties := make(map[string]parser.Schema)
+	var required []string
+	rules, _ := GetArgumentRules(fn)
+	for _, arg := range CreateCombinedHandlerArgs(fn, info) {
+		name := JSONName(info, arg.Name())
+		if field, ok := arg.(parser.Field); ok {
+			if !isWireField(field) {
+				continue
+			}
+			properties[name] = field.Schema()
+			isRequired := parser.ApplyRules(properties[name], rules[field.Name()], field.Type)
+			if isRequired || !field.IsOptional() {
+				required = append(required, name)
+			}
+			continue
+		}
+		//Receiver is initialized from its constructor arguments
+		properties[name] = receiverSchema(fn.Receiver, info)
+		required = append(required, name)
+	}
+	return parser.ObjectSchema(properties, required)
+}
+
+//ResponseSchema returns JSON Schema of function response object.
+func ResponseSchema(fn parser.Function, info *PackageInfo) parser.Schema {
+	properties := make(map[string]parser.Schema)
+	var required []string
+	for _, field := range fn.Results.List() {
+		if !isWireField(field) {
+			continue
+		}
+		name := JSONName(info, field.Name())
+		properties[name] = field.Schema()
+		required = append(required, name)
+	}
+	return parser.ObjectSchema(properties, required)
+}
+
+//receiverSchema describes client receiver type (see ClientReceiverType).
+func receiverSchema(receiver types.Field, info *PackageInfo) parser.Schema {
+	properties := make(map[string]parser.Schema)
+	var required []string
+	if cons, ok := info.GetConstructor(receiver); ok {
+		for _, arg := range filterHelperArgs(cons.Function.Arguments, info) {
+			name := JSONName(info, arg.Name())
+			if _, ok := info.GetConstructor(arg); ok {
+				properties[name] = receiverSchema(arg, info)
+			} else if getters, ok := getProviderGetters(arg); ok {
+				properties[name] = providerSchema(getters)
+			} else if isWireField(arg) {
+				properties[name] = arg.Schema()
+			}
+			required = append(required, name)
+		}
+	}
+	if IsSession(receiver, info) {
+		name := ToSnakeCase(SessionField)
+		properties[name] = parser.Schema{"type": "string", "description": "session handle"}
+		required = append(required, name)
+	}
+	return parser.ObjectSchema(properties, required)
+}
+
+//isWireField returns false for fields that are not transferred over the wire.
+func isWireField(field parser.Field) bool {
+	return field.TypeName() != "error" && !IsContextField(field) && !field.IsChan()
+}
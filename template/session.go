@@ -0,0 +1,348 @@
+package template
+
+import (
+	"fmt"
+	gotypes "go/types"
+	"time"
+
+	"github.com/angrypie/tie/parser"
+	"github.com/angrypie/tie/types"
+	. "github.com/dave/jennifer/jen"
+)
+
+//Methods that are generated for each session receiver (see types.Session).
+const (
+	OpenSessionMethod  = "OpenSession"
+	CloseSessionMethod = "CloseSession"
+)
+
+//SessionField is client receiver field that holds session handle.
+const SessionField = "TieSession"
+
+const defaultSessionTTL = 30 * time.Minute
+const defaultSessionMax = 10000
+
+//GetSession returns session configuration if receiver is kept on server side between calls.
+func GetSession(receiver types.Field, info *PackageInfo) (session types.Session, ok bool) {
+	if info.Service == nil {
+		return
+	}
+	for _, session := range info.Service.Sessions {
+		if session.Receiver == TrimPrefix(receiver.TypeName()) {
+			return session, true
+		}
+	}
+	return
+}
+
+//IsSession returns true if receiver is kept on server side between calls.
+func IsSession(receiver types.Field, info *PackageInfo) bool {
+	_, ok := GetSession(receiver, info)
+	return ok
+}
+
+//isSessionConstructor returns true if fn is constructor of session receiver.
+func isSessionConstructor(fn parser.Function, info *PackageInfo) bool {
+	if info.Service == nil || len(info.Service.Sessions) == 0 {
+		return false
+	}
+	receiver, ok := isConventionalConstructor(fn)
+	return ok && IsSession(receiver, info)
+}
+
+//isSessionMethod returns true if fn is generated session method with given name.
+func isSessionMethod(fn parser.Function, name string, info *PackageInfo) bool {
+	return fn.Name == name && HasReceiver(fn) && IsSession(fn.Receiver, info)
+}
+
+func sessionLimits(session types.Session) (ttl time.Duration, max int, err error) {
+	ttl, max = defaultSessionTTL, defaultSessionMax
+	if session.TTL != "" {
+		if ttl, err = time.ParseDuration(session.TTL); err != nil {
+			return
+		}
+	}
+	if session.Max > 0 {
+		max = session.Max
+	}
+	return
+}
+
+//createSessionFunctions creates OpenSession and CloseSession methods for session receivers,
+//they are served and called by modules as any other method.
+func createSessionFunctions(info *PackageInfo) (fns []parser.Function) {
+	errField := parser.NewField(gotypes.NewVar(0, nil, "err", gotypes.Universe.Lookup("error").Type()))
+	sessionField := parser.NewField(gotypes.NewVar(0, nil, "session", gotypes.Typ[gotypes.String]))
+	openResults, _ := parser.NewResultFields(sessionField, errField)
+	closeResults, _ := parser.NewResultFields(errField)
+
+	constructors, _ := NewDepsGraph(info).Order()
+	for _, c := range constructors {
+		if !IsSession(c.Receiver, info) {
+			continue
+		}
+		//Use receiver of existing method to keep request field name
+		receiver := c.Receiver
+		for _, fn := range info.Functions {
+			if HasReceiver(fn) && fn.Receiver.TypeName() == receiver.TypeName() {
+				receiver = fn.Receiver
+				break
+			}
+		}
+		name := receiver.TypeName()
+		fns = append(fns, parser.Function{
+			Name: OpenSessionMethod, Receiver: receiver, Results: openResults, Package: c.Function.Package,
+			Doc: fmt.Sprintf("OpenSession creates %s and returns session handle.", name),
+		}, parser.Function{
+			Name: CloseSessionMethod, Receiver: receiver, Results: closeResults, Package: c.Function.Package,
+			Doc: fmt.Sprintf("CloseSession removes %s session.", name),
+		})
+	}
+	return
+}
+
+//ValidateSessions returns error if session configuration refers to unknown receivers.
+func ValidateSessions(info *PackageInfo) error {
+	for _, session := range info.Service.Sessions {
+		found := false
+		for _, c := range info.Constructors {
+			found = found || c.Receiver.TypeName() == session.Receiver
+		}
+		if !found {
+			return fmt.Errorf("sessions: receiver %s does not have constructor", session.Receiver)
+		}
+		if _, _, err := sessionLimits(session); err != nil {
+			return fmt.Errorf("sessions: receiver %s: %w", session.Receiver, err)
+		}
+		methods := make(map[string]int)
+		for _, fn := range info.Functions {
+			if HasReceiver(fn) && fn.Receiver.TypeName() == session.Receiver {
+				methods[fn.Name]++
+			}
+		}
+		for _, name := range []string{OpenSessionMethod, CloseSessionMethod} {
+			if methods[name] > 1 {
+				return fmt.Errorf("sessions: receiver %s already has %s method", session.Receiver, name)
+			}
+		}
+	}
+	return nil
+}
+
+//Session helpers are exported by lifecycle package, sessions are shared by all transports.
+const sessionOpenHelper = "SessionOpen"
+const sessionPutHelper = "SessionPut"
+const sessionGetHelper = "SessionGet"
+const sessionCloseHelper = "SessionClose"
+const sessionStopHelper = "sessionStopHelper"
+const sessionStopFunc = "sessionStopFunc"
+const sessionShutdownHelper = "sessionShutdownHelper"
+const sessionEntry = "sessionEntry"
+
+//sessionLimitsCode returns code of session TTL and limit of sessions.
+func sessionLimitsCode(receiver types.Field, info *PackageInfo) (ttl, max Code) {
+	session, _ := GetSession(receiver, info)
+	d, m, _ := sessionLimits(session)
+	return Lit(int(d.Seconds())).Op("*").Qual("time", "Second"), Lit(m)
+}
+
+//makeSessionCall creates call of generated session method.
+func makeSessionCall(info *PackageInfo, fn parser.Function, g *Group, recId, receiverPath string) {
+	kind := Lit(fn.Receiver.TypeName())
+	handle := Id(receiverPath).Dot(SessionField)
+	if fn.Name == CloseSessionMethod {
+		g.ListFunc(CreateArgsListFunc(fn.Results.List(), "response")).Op("=").
+			Add(Lifecycle(info, sessionCloseHelper)).Call(kind, handle)
+		return
+	}
+	ttl, max := sessionLimitsCode(fn.Receiver, info)
+	g.ListFunc(CreateArgsListFunc(fn.Results.List(), "response")).Op("=").
+		Add(Lifecycle(info, sessionOpenHelper)).Call(kind, Id(recId), ttl, max)
+}
+
+//makeSessionInstance gets receiver instance from session store by handle from request.
+//Persisted receiver that is not in session store is restored from state store, session
+//is looked up again after restore lock is taken (it could be restored by concurrent call).
+func makeSessionInstance(
+	info *PackageInfo, constructor Constructor, g *Group,
+	deps DepsMap, errGuard IfErrorGuard,
+	resourceInstance, recId, receiverPath string, stack []string,
+) (err error) {
+	receiver := constructor.Receiver
+	g.Id(recId).Op(":=").New(Qual(info.GetServicePath(), receiver.TypeName()))
+	get := Lifecycle(info, sessionGetHelper).Call(
+		Lit(receiver.TypeName()), Id(receiverPath).Dot(SessionField), Op("&").Id(recId),
+	)
+	if !IsPersisted(receiver, info) {
+		errGuard(g, Err().Op("=").Add(get))
+		return nil
+	}
+	//Restore is locked by state key, concurrent calls of the same session restore it once
+	g.If(Err().Op(":=").Add(get), Err().Op("!=").Nil()).BlockFunc(func(g *Group) {
+		key := sessionStateKey(receiver, Id(receiverPath).Dot(SessionField))
+		g.Id("unlockRestore").Op(":=").Add(Lifecycle(info, stateLockHelper)).Call(key)
+		g.Defer().Id("unlockRestore").Call()
+		g.If(Err().Op(":=").Add(get), Err().Op("!=").Nil()).BlockFunc(func(g *Group) {
+			err = makeSessionRestore(info, constructor, g, deps, errGuard, resourceInstance, recId, receiverPath, stack)
+		})
+		g.Id("unlockRestore").Call()
+	})
+	return err
+}
+
+//AddSessionHelpers creates in-memory session store. Sessions expire after TTL
+//of inactivity, least recently used session is evicted if limit is reached.
+//Sessions of each kind are kept in list ordered by last use, so expired and evicted
+//sessions are found at the back of list. Receivers of removed sessions are stopped
+//if they have Stop method (with hook deadline), all sessions are stopped on shutdown.
+func AddSessionHelpers(info *PackageInfo, f *File) {
+	if len(info.Service.Sessions) == 0 {
+		return
+	}
+	f.Type().Id(sessionEntry).Struct(
+		List(Id("kind"), Id("id")).String(),
+		Id("value").Interface(),
+		Id("ttl").Qual("time", "Duration"),
+		Id("expires").Qual("time", "Time"),
+		Id("element").Op("*").Qual("container/list", "Element"),
+	)
+	f.Var().Defs(
+		Id("sessionsMu").Qual("sync", "Mutex"),
+		Id("sessions").Op("=").Make(Map(String()).Op("*").Id(sessionEntry)),
+		Id("sessionsByUse").Op("=").Make(Map(String()).Op("*").Qual("container/list", "List")),
+	)
+
+	//sessionStopFunc returns Stop method of session receiver (nil if receiver is not stoppable).
+	f.Func().Id(sessionStopFunc).Params(Id("value").Interface()).Func().Params(Qual("context", "Context")).Error().Block(
+		Switch(Id("s").Op(":=").Id("value").Assert(Type())).Block(
+			Case(Interface(Id("Stop").Params(Qual("context", "Context")).Error())).Block(Return(Id("s").Dot("Stop"))),
+			Case(Interface(Id("Stop").Params().Error())).Block(
+				Return(Func().Params(Qual("context", "Context")).Error().Block(Return(Id("s").Dot("Stop").Call()))),
+			),
+		),
+		Return(Nil()),
+	)
+
+	//sessionStopHelper removes session from store, it is called with sessionsMu locked.
+	f.Func().Id(sessionStopHelper).Params(Id("entry").Op("*").Id(sessionEntry)).BlockFunc(func(g *Group) {
+		g.Delete(Id("sessions"), Id("entry").Dot("id"))
+		g.Id("sessionsByUse").Index(Id("entry").Dot("kind")).Dot("Remove").Call(Id("entry").Dot("element"))
+		g.If(
+			Id("stop").Op(":=").Id(sessionStopFunc).Call(Id("entry").Dot("value")),
+			Id("stop").Op("!=").Nil(),
+		).Block(Go().Func().Params().Block(
+			If(
+				Err().Op(":=").Id(stopHookHelper).Call(Qual("context", "Background").Call(), Id("stop")),
+				Err().Op("!=").Nil(),
+			).Block(
+				Qual("log", "Println").Call(Lit("ERR failed to stop"), Id("entry").Dot("kind"), Lit("session"), Err()),
+			),
+		).Call())
+		//Removed session can't be restored from state store
+		if info.Service.State != nil {
+			g.Id(stateDeleteHelper).Call(
+				Lit("session/").Op("+").Id("entry").Dot("kind").Op("+").Lit("/").Op("+").Id("entry").Dot("id"),
+			)
+		}
+	})
+
+	//sessionShutdownHelper stops all sessions on shutdown (persisted state is kept).
+	f.Func().Id(sessionShutdownHelper).Params(Id("ctx").Qual("context", "Context")).Params(Id("ok").Bool()).Block(
+		Id("sessionsMu").Dot("Lock").Call(),
+		Defer().Id("sessionsMu").Dot("Unlock").Call(),
+		Id("ok").Op("=").True(),
+		For(List(Id("_"), Id("entry")).Op(":=").Range().Id("sessions")).Block(
+			Id("stop").Op(":=").Id(sessionStopFunc).Call(Id("entry").Dot("value")),
+			If(Id("stop").Op("==").Nil()).Block(Continue()),
+			If(
+				Err().Op(":=").Id(stopHookHelper).Call(Id("ctx"), Id("stop")),
+				Err().Op("!=").Nil(),
+			).Block(
+				Qual("log", "Println").Call(Lit("ERR failed to stop"), Id("entry").Dot("kind"), Lit("session"), Err()),
+				Id("ok").Op("=").False(),
+			),
+		),
+		Return(),
+	)
+
+	notFound := Qual("fmt", "Errorf").Call(Lit("%s session not found or expired"), Id("kind"))
+
+	f.Func().Id(sessionOpenHelper).Params(
+		Id("kind").String(), Id("value").Interface(), Id("ttl").Qual("time", "Duration"), Id("max").Int(),
+	).Params(String(), Error()).Block(
+		Id("buf").Op(":=").Make(Index().Byte(), Lit(16)),
+		If(
+			List(Id("_"), Err()).Op(":=").Qual("crypto/rand", "Read").Call(Id("buf")),
+			Err().Op("!=").Nil(),
+		).Block(Return(Lit(""), Err())),
+		Id("id").Op(":=").Qual("encoding/hex", "EncodeToString").Call(Id("buf")),
+		Id(sessionPutHelper).Call(Id("kind"), Id("id"), Id("value"), Id("ttl"), Id("max")),
+		Return(Id("id"), Nil()),
+	)
+
+	//sessionPutHelper adds session, expired and least recently used sessions of kind are removed.
+	f.Func().Id(sessionPutHelper).Params(
+		List(Id("kind"), Id("id")).String(), Id("value").Interface(),
+		Id("ttl").Qual("time", "Duration"), Id("max").Int(),
+	).Block(
+		Id("now").Op(":=").Qual("time", "Now").Call(),
+		Id("sessionsMu").Dot("Lock").Call(),
+		Defer().Id("sessionsMu").Dot("Unlock").Call(),
+		List(Id("byUse"), Id("ok")).Op(":=").Id("sessionsByUse").Index(Id("kind")),
+		If(Op("!").Id("ok")).Block(
+			Id("byUse").Op("=").Qual("container/list", "New").Call(),
+			Id("sessionsByUse").Index(Id("kind")).Op("=").Id("byUse"),
+		),
+		If(List(Id("entry"), Id("ok")).Op(":=").Id("sessions").Index(Id("id")), Id("ok")).Block(
+			Id("byUse").Dot("Remove").Call(Id("entry").Dot("element")),
+		),
+		Comment("Remove expired sessions and least recently used ones above limit"),
+		For(Id("byUse").Dot("Len").Call().Op(">").Lit(0)).Block(
+			Id("entry").Op(":=").Id("byUse").Dot("Back").Call().Dot("Value").Assert(Op("*").Id(sessionEntry)),
+			If(
+				Op("!").Id("now").Dot("After").Call(Id("entry").Dot("expires")).
+					Op("&&").Id("byUse").Dot("Len").Call().Op("<").Id("max"),
+			).Block(Break()),
+			Id(sessionStopHelper).Call(Id("entry")),
+		),
+		Id("entry").Op(":=").Op("&").Id(sessionEntry).Values(Dict{
+			Id("kind"):    Id("kind"),
+			Id("id"):      Id("id"),
+			Id("value"):   Id("value"),
+			Id("ttl"):     Id("ttl"),
+			Id("expires"): Id("now").Dot("Add").Call(Id("ttl")),
+		}),
+		Id("entry").Dot("element").Op("=").Id("byUse").Dot("PushFront").Call(Id("entry")),
+		Id("sessions").Index(Id("id")).Op("=").Id("entry"),
+	)
+
+	//sessionGetHelper sets target to session receiver and prolongs session.
+	f.Func().Id(sessionGetHelper).Params(
+		List(Id("kind"), Id("id")).String(), Id("target").Interface(),
+	).Error().Block(
+		Id("sessionsMu").Dot("Lock").Call(),
+		Defer().Id("sessionsMu").Dot("Unlock").Call(),
+		List(Id("entry"), Id("ok")).Op(":=").Id("sessions").Index(Id("id")),
+		If(Op("!").Id("ok").Op("||").Id("entry").Dot("kind").Op("!=").Id("kind")).Block(Return(notFound)),
+		Id("now").Op(":=").Qual("time", "Now").Call(),
+		If(Id("now").Dot("After").Call(Id("entry").Dot("expires"))).Block(
+			Id(sessionStopHelper).Call(Id("entry")),
+			Return(notFound),
+		),
+		Id("entry").Dot("expires").Op("=").Id("now").Dot("Add").Call(Id("entry").Dot("ttl")),
+		Id("sessionsByUse").Index(Id("kind")).Dot("MoveToFront").Call(Id("entry").Dot("element")),
+		Qual("reflect", "ValueOf").Call(Id("target")).Dot("Elem").Call().Dot("Set").Call(
+			Qual("reflect", "ValueOf").Call(Id("entry").Dot("value")),
+		),
+		Return(Nil()),
+	)
+
+	f.Func().Id(sessionCloseHelper).Params(List(Id("kind"), Id("id")).String()).Error().Block(
+		Id("sessionsMu").Dot("Lock").Call(),
+		Defer().Id("sessionsMu").Dot("Unlock").Call(),
+		List(Id("entry"), Id("ok")).Op(":=").Id("sessions").Index(Id("id")),
+		If(Op("!").Id("ok").Op("||").Id("entry").Dot("kind").Op("!=").Id("kind")).Block(Return(notFound)),
+		Id(sessionStopHelper).Call(Id("entry")),
+		Return(Nil()),
+	)
+}
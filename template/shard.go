@@ -0,0 +1,143 @@
+package template
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/angrypie/tie/parser"
+	"github.com/angrypie/tie/types"
+	. "github.com/dave/jennifer/jen"
+)
+
+//ShardDirective marks constructor of receiver which requests are routed
+//to service instance by consistent hash of key argument (//tie:shard key=name).
+const ShardDirective = "shard"
+
+//shardReplicas is number of points of each instance on hash ring.
+const shardReplicas = 64
+
+//GetShardKey returns constructor argument that is routing key of receiver.
+func GetShardKey(receiver types.Field, info *PackageInfo) (key parser.Field, ok bool) {
+	c, ok := info.GetConstructor(receiver)
+	if !ok {
+		return
+	}
+	directive, ok := c.Function.GetDirective(ShardDirective)
+	if !ok {
+		return
+	}
+	for _, arg := range c.Function.Arguments {
+		if arg.Name() == directive.Args["key"] {
+			return arg, true
+		}
+	}
+	return key, false
+}
+
+//ValidateShards returns error if shard directive can't be used to route receiver requests.
+func ValidateShards(info *PackageInfo) error {
+	for _, c := range info.Constructors {
+		directive, ok := c.Function.GetDirective(ShardDirective)
+		if !ok {
+			continue
+		}
+		name := c.Function.Name
+		if HasTopLevelReceiver(c.Function, info) {
+			return fmt.Errorf("%s: top level receiver exists on each instance and can't be sharded", name)
+		}
+		key, ok := GetShardKey(c.Receiver, info)
+		if !ok {
+			return fmt.Errorf("%s: shard key %q is not constructor argument", name, directive.Args["key"])
+		}
+		_, isReceiver := info.GetConstructor(key)
+		_, isDep := GetDependency(key)
+		if isReceiver || isDep || IsProvided(key) || !isWireField(key) || isFuncType(key.TypeName()) {
+			return fmt.Errorf("%s: shard key %s must be value sent by client", name, key.Name())
+		}
+	}
+	return nil
+}
+
+//shardKeyCode returns client code of receiver routing key (empty string if receiver is not sharded).
+func shardKeyCode(fn parser.Function, info *PackageInfo) *Statement {
+	if !HasReceiver(fn) {
+		return Lit("")
+	}
+	key, ok := GetShardKey(fn.Receiver, info)
+	if !ok {
+		return Lit("")
+	}
+	return Qual("fmt", "Sprint").Call(Id("resource").Dot(strings.Title(key.Name())))
+}
+
+//ClientAddressHelper returns address of service instance for routing key.
+const ClientAddressHelper = "clientAddressHelper"
+
+const shardAddressHelper = "shardAddressHelper"
+
+//AddClientAddressHelper creates helper that returns service address for routing key.
+//Comma separated list of instances is read from env (or service instances), requests
+//without key are spread randomly. Ring is rebuilt when list of instances changes.
+func AddClientAddressHelper(info *PackageInfo, f *File, env, defaultAddress string) {
+	if len(info.Service.Instances) != 0 {
+		defaultAddress = strings.Join(info.Service.Instances, ",")
+	}
+
+	//Service address can be overridden with environment variable
+	f.Func().Id(ClientAddressHelper).Params(Id("key").String()).String().Block(
+		Id("addresses").Op(":=").Lit(defaultAddress),
+		If(
+			Id("address").Op(":=").Qual("os", "Getenv").Call(Lit(env)),
+			Id("address").Op("!=").Lit(""),
+		).Block(Id("addresses").Op("=").Id("address")),
+		Return(Id(shardAddressHelper).Call(Id("addresses"), Id("key"))),
+	)
+
+	f.Var().Defs(
+		Id("shardMu").Qual("sync", "Mutex"),
+		Id("shardRing").Struct(
+			Id("addresses").String(),
+			Id("instances").Index().String(),
+			Id("hashes").Index().Uint32(),
+			Id("owners").Map(Uint32()).String(),
+		),
+	)
+
+	hash := func(s Code) *Statement {
+		return Qual("hash/crc32", "ChecksumIEEE").Call(Index().Byte().Parens(s))
+	}
+	f.Func().Id(shardAddressHelper).Params(List(Id("addresses"), Id("key")).String()).String().Block(
+		If(Op("!").Qual("strings", "Contains").Call(Id("addresses"), Lit(","))).Block(Return(Id("addresses"))),
+		Id("shardMu").Dot("Lock").Call(),
+		Defer().Id("shardMu").Dot("Unlock").Call(),
+		Id("ring").Op(":=").Op("&").Id("shardRing"),
+		If(Id("ring").Dot("addresses").Op("!=").Id("addresses")).Block(
+			List(Id("ring").Dot("addresses"), Id("ring").Dot("instances"), Id("ring").Dot("hashes")).Op("=").
+				List(Id("addresses"), Nil(), Nil()),
+			Id("ring").Dot("owners").Op("=").Make(Map(Uint32()).String()),
+			For(List(Id("_"), Id("address")).Op(":=").Range().Qual("strings", "Split").Call(Id("addresses"), Lit(","))).Block(
+				If(Id("address").Op("=").Qual("strings", "TrimSpace").Call(Id("address")), Id("address").Op("==").Lit("")).
+					Block(Continue()),
+				Id("ring").Dot("instances").Op("=").Append(Id("ring").Dot("instances"), Id("address")),
+				For(Id("i").Op(":=").Lit(0), Id("i").Op("<").Lit(shardReplicas), Id("i").Op("++")).Block(
+					Id("h").Op(":=").Add(hash(Id("address").Op("+").Lit("#").Op("+").Qual("strconv", "Itoa").Call(Id("i")))),
+					Id("ring").Dot("hashes").Op("=").Append(Id("ring").Dot("hashes"), Id("h")),
+					Id("ring").Dot("owners").Index(Id("h")).Op("=").Id("address"),
+				),
+			),
+			Qual("sort", "Slice").Call(Id("ring").Dot("hashes"), Func().Params(List(Id("i"), Id("j")).Int()).Bool().Block(
+				Return(Id("ring").Dot("hashes").Index(Id("i")).Op("<").Id("ring").Dot("hashes").Index(Id("j"))),
+			)),
+		),
+		If(Len(Id("ring").Dot("instances")).Op("==").Lit(0)).Block(Return(Lit(""))),
+		If(Id("key").Op("==").Lit("")).Block(
+			Return(Id("ring").Dot("instances").Index(Qual("math/rand", "Intn").Call(Len(Id("ring").Dot("instances"))))),
+		),
+		Id("h").Op(":=").Add(hash(Id("key"))),
+		Id("i").Op(":=").Qual("sort", "Search").Call(Len(Id("ring").Dot("hashes")), Func().Params(Id("i").Int()).Bool().Block(
+			Return(Id("ring").Dot("hashes").Index(Id("i")).Op(">=").Id("h")),
+		)),
+		If(Id("i").Op("==").Len(Id("ring").Dot("hashes"))).Block(Id("i").Op("=").Lit(0)),
+		Return(Id("ring").Dot("owners").Index(Id("ring").Dot("hashes").Index(Id("i")))),
+	)
+}
@@ -0,0 +1,40 @@
+package template
+
+import (
+	"testing"
+
+	"github.com/angrypie/tie/parser"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateShards(t *testing.T) {
+	info := newTestInfo(map[string][]string{
+		"User": {"API"},
+		"API":  nil,
+	})
+	setDirective := func(receiver string, args map[string]string) {
+		for key, c := range info.Constructors {
+			if c.Receiver.TypeName() == receiver {
+				c.Function.Directives = nil
+				if args != nil {
+					c.Function.Directives = []parser.Directive{{Name: ShardDirective, Args: args}}
+				}
+				info.Constructors[key] = c
+			}
+		}
+	}
+
+	setDirective("User", map[string]string{"key": "label"})
+	require.NoError(t, ValidateShards(info))
+
+	setDirective("User", map[string]string{"key": "depAPI"})
+	require.EqualError(t, ValidateShards(info), "NewUser: shard key depAPI must be value sent by client")
+
+	setDirective("User", map[string]string{"key": "name"})
+	require.EqualError(t, ValidateShards(info), `NewUser: shard key "name" is not constructor argument`)
+
+	setDirective("User", nil)
+	setDirective("API", map[string]string{"key": "label"})
+	require.EqualError(t, ValidateShards(info),
+		"NewAPI: top level receiver exists on each instance and can't be sharded")
+}
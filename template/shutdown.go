@@ -0,0 +1,250 @@
+package template
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/angrypie/tie/parser"
+	"github.com/angrypie/tie/types"
+	. "github.com/dave/jennifer/jen"
+)
+
+const defaultShutdownTimeout = 30 * time.Second
+const defaultHookTimeout = 10 * time.Second
+
+//AddServerHookHelper registers function that stops server (stops accepting requests and
+//waits for in-flight ones), modules call it when server is started.
+const AddServerHookHelper = "AddServerHook"
+
+//ShutdownHelper stops servers and receivers once and returns process exit code.
+const ShutdownHelper = "Shutdown"
+
+const serverHooksVar = "serverHooks"
+const stopHookType = "stopHook"
+const stopHooksVar = "stopHooks"
+const addStopHookHelper = "AddStopHook"
+const stopHookHelper = "stopHookHelper"
+
+func shutdownTimeouts(shutdown types.Shutdown) (total, hook time.Duration, err error) {
+	total, hook = defaultShutdownTimeout, defaultHookTimeout
+	if shutdown.Timeout != "" {
+		if total, err = time.ParseDuration(shutdown.Timeout); err != nil {
+			return
+		}
+	}
+	if shutdown.HookTimeout != "" {
+		hook, err = time.ParseDuration(shutdown.HookTimeout)
+	}
+	return
+}
+
+//getStopMethod returns Stop method of receiver, ok is false if receiver is not stoppable.
+func getStopMethod(receiver parser.Field, info *PackageInfo) (fn parser.Function, ok bool) {
+	return info.GetFunction(receiver, "Stop")
+}
+
+//isValidStop returns true for Stop() error and Stop(context.Context) error methods.
+func isValidStop(fn parser.Function) bool {
+	args := len(fn.Arguments)
+	return len(fn.Results.List()) == 1 && fn.Results.Last.TypeName() == "error" &&
+		(args == 0 || args == 1 && IsContextField(fn.Arguments[0]))
+}
+
+//ValidateShutdown returns error if shutdown deadlines are invalid or receiver has Stop method
+//with unsupported signature.
+func ValidateShutdown(info *PackageInfo) error {
+	if _, _, err := shutdownTimeouts(info.Service.Shutdown); err != nil {
+		return fmt.Errorf("shutdown: %w", err)
+	}
+	for _, fn := range info.Functions {
+		if HasReceiver(fn) && fn.Name == "Stop" && !isValidStop(fn) {
+			return fmt.Errorf("%s.Stop: must be Stop() error or Stop(context.Context) error", fn.Receiver.TypeName())
+		}
+	}
+	return nil
+}
+
+//makeStopHook registers Stop method of receiver created at start.
+func makeStopHook(info *PackageInfo, receiver parser.Field, g *Group, recId string) {
+	fn, ok := getStopMethod(receiver, info)
+	if !ok {
+		return
+	}
+	g.Add(Lifecycle(info, addStopHookHelper)).Call(
+		Lit(TrimPrefix(receiver.TypeName())), stopFunc(fn, Id(recId).Dot("Stop")),
+	)
+}
+
+//MakeAddServerHook registers hook that stops server during shutdown.
+func MakeAddServerHook(info *PackageInfo, g *Group, hook Code) {
+	g.Add(Lifecycle(info, AddServerHookHelper)).Call(hook)
+}
+
+//stopFunc adapts stop function to func(context.Context) error.
+func stopFunc(fn parser.Function, stop *Statement) Code {
+	if len(fn.Arguments) != 0 {
+		return stop
+	}
+	return Func().Params(Qual("context", "Context")).Error().Block(Return(stop.Call()))
+}
+
+//MakeListenAndServe starts net/http server with address and handler (health endpoints
+//are added), server is stopped with other servers during shutdown. Server uses TLS if
+//it is configured. Server is marked as ready when it listens for requests.
+func MakeListenAndServe(info *PackageInfo, g *Group, handler Code) {
+	g.Id("httpServer").Op(":=").Op("&").Qual("net/http", "Server").Values(Dict{
+		Id("Handler"): Lifecycle(info, HealthHandlerHelper).Call(handler),
+	})
+	listen := Id("httpServer").Dot("Serve").Call(Id("listener"))
+	if IsTLS(info) {
+		stmt := List(Id("httpServer").Dot("TLSConfig"), Err()).Op("=").Add(Lifecycle(info, TLSConfigHelper)).Call()
+		AddIfErrorGuard(g, stmt, "err", Err())
+		listen = Id("httpServer").Dot("ServeTLS").Call(Id("listener"), Lit(""), Lit(""))
+	}
+	g.List(Id("listener"), Err()).Op(":=").Qual("net", "Listen").Call(Lit("tcp"), Id("address"))
+	AddIfErrorGuard(g, nil, "err", Err())
+	MakeAddServerHook(info, g, Lifecycle(info, ShutdownHTTPHelper).Call(Id("httpServer")))
+	MakeReady(info, g)
+	g.If(
+		Err().Op("=").Add(listen),
+		Err().Op("==").Qual("net/http", "ErrServerClosed"),
+	).Block(Err().Op("=").Nil())
+}
+
+//ShutdownHTTPHelper creates server hook of *http.Server.
+const ShutdownHTTPHelper = "ShutdownHTTP"
+
+//addShutdownHTTPHelper creates server hook that closes connections (e.g. event streams)
+//which are still open when shutdown deadline is exceeded.
+func addShutdownHTTPHelper(f *File) {
+	f.Func().Id(ShutdownHTTPHelper).Params(Id("server").Op("*").Qual("net/http", "Server")).
+		Func().Params(Qual("context", "Context")).Error().Block(
+		Return(Func().Params(Id("ctx").Qual("context", "Context")).Error().Block(
+			If(
+				Err().Op(":=").Id("server").Dot("Shutdown").Call(Id("ctx")),
+				Err().Op("!=").Nil(),
+			).Block(
+				Id("server").Dot("Close").Call(),
+				Return(Err()),
+			),
+			Return(Nil()),
+		)),
+	)
+}
+
+//GracefulShutdown stops service on SIGTERM or SIGINT (second signal terminates process
+//immediately). Servers of all transports are stopped concurrently first, then receivers
+//are stopped in reverse order of creation and StopService is called. Process exits with
+//non-zero code if any step fails or deadline is exceeded.
+func GracefulShutdown(info *PackageInfo, g *Group, f *File) {
+	total, hook, _ := shutdownTimeouts(info.Service.Shutdown)
+	duration := func(d time.Duration) *Statement {
+		return Lit(int(d.Milliseconds())).Op("*").Qual("time", "Millisecond")
+	}
+	stopFn := Func().Params(Qual("context", "Context")).Error()
+
+	functionName := "gracefulShutDown"
+	g.Id(functionName).Call()
+	if info.IsStopService {
+		g.Id(stopHooksVar).Op("=").Append(Id(stopHooksVar), Id(stopHookType).Values(
+			Lit("StopService"), stopFunc(parser.Function{}, Qual(info.GetServicePath(), "StopService")),
+		))
+	}
+
+	f.Type().Id(stopHookType).Struct(Id("name").String(), Id("stop").Add(stopFn))
+
+	f.Var().Defs(
+		Id("hooksMu").Qual("sync", "Mutex"),
+		Id(serverHooksVar).Index().Add(stopFn),
+		Id(stopHooksVar).Index().Id(stopHookType),
+		Id("shutdownOnce").Qual("sync", "Once"),
+		Id("shutdownCode").Int(),
+	)
+
+	lock := func() []Code {
+		return []Code{Id("hooksMu").Dot("Lock").Call(), Defer().Id("hooksMu").Dot("Unlock").Call()}
+	}
+	f.Comment("AddServerHook registers function that stops server.")
+	f.Func().Id(AddServerHookHelper).Params(Id("stop").Add(stopFn)).Block(append(lock(),
+		Id(serverHooksVar).Op("=").Append(Id(serverHooksVar), Id("stop")),
+	)...)
+	f.Comment("AddStopHook registers function that stops receiver, receivers are stopped after servers.")
+	f.Func().Id(addStopHookHelper).Params(Id("name").String(), Id("stop").Add(stopFn)).Block(append(lock(),
+		Id(stopHooksVar).Op("=").Append(Id(stopHooksVar), Id(stopHookType).Values(Id("name"), Id("stop"))),
+	)...)
+
+	f.Func().Id(functionName).Params().Block(
+		Id("sigChan").Op(":=").Make(Chan().Qual("os", "Signal"), Lit(2)),
+		Qual("os/signal", "Notify").Call(Id("sigChan"), Qual("syscall", "SIGTERM"), Qual("syscall", "SIGINT")),
+
+		Go().Func().Params().Block(
+			Op("<-").Id("sigChan"),
+			Go().Func().Params().Block(
+				Op("<-").Id("sigChan"),
+				Qual("log", "Println").Call(Lit("ERR shutdown interrupted")),
+				Qual("os", "Exit").Call(Lit(1)),
+			).Call(),
+			Qual("os", "Exit").Call(Id(ShutdownHelper).Call()),
+		).Call(),
+	)
+
+	f.Func().Id(ShutdownHelper).Params().Int().Block(
+		Id("shutdownOnce").Dot("Do").Call(Func().Params().BlockFunc(func(g *Group) {
+			g.List(Id("ctx"), Id("cancel")).Op(":=").Qual("context", "WithTimeout").
+				Call(Qual("context", "Background").Call(), duration(total))
+			g.Defer().Id("cancel").Call()
+			makeSetReady(g, false)
+			g.Id("hooksMu").Dot("Lock").Call()
+			g.Defer().Id("hooksMu").Dot("Unlock").Call()
+			g.Comment("Servers stop accepting requests and wait for in-flight ones")
+			g.Var().Defs(Id("wg").Qual("sync", "WaitGroup"), Id("failed").Int32())
+			g.For(List(Id("_"), Id("stop")).Op(":=").Range().Id(serverHooksVar)).Block(
+				Id("wg").Dot("Add").Call(Lit(1)),
+				Go().Func().Params(Id("stop").Add(stopFn)).Block(
+					Defer().Id("wg").Dot("Done").Call(),
+					If(
+						Err().Op(":=").Id("stop").Call(Id("ctx")),
+						Err().Op("!=").Nil(),
+					).Block(
+						Qual("log", "Println").Call(Lit("ERR failed to stop server"), Err()),
+						Qual("sync/atomic", "StoreInt32").Call(Op("&").Id("failed"), Lit(1)),
+					),
+				).Call(Id("stop")),
+			)
+			g.Id("wg").Dot("Wait").Call()
+			g.If(Id("failed").Op("!=").Lit(0)).Block(Id("shutdownCode").Op("=").Lit(1))
+			if len(info.Service.Sessions) != 0 {
+				g.If(Op("!").Id(sessionShutdownHelper).Call(Id("ctx"))).Block(Id("shutdownCode").Op("=").Lit(1))
+			}
+			g.For(
+				Id("i").Op(":=").Len(Id(stopHooksVar)).Op("-").Lit(1),
+				Id("i").Op(">=").Lit(0),
+				Id("i").Op("--"),
+			).Block(
+				Id("hook").Op(":=").Id(stopHooksVar).Index(Id("i")),
+				If(
+					Err().Op(":=").Id(stopHookHelper).Call(Id("ctx"), Id("hook").Dot("stop")),
+					Err().Op("!=").Nil(),
+				).Block(
+					Qual("log", "Println").Call(Lit("ERR failed to stop"), Id("hook").Dot("name"), Err()),
+					Id("shutdownCode").Op("=").Lit(1),
+				),
+			)
+		})),
+		Return(Id("shutdownCode")),
+	)
+
+	//stopHookHelper calls stop with hook deadline, hook is abandoned if deadline is exceeded.
+	f.Func().Id(stopHookHelper).Params(Id("ctx").Qual("context", "Context"), Id("stop").Add(stopFn)).Error().Block(
+		List(Id("ctx"), Id("cancel")).Op(":=").Qual("context", "WithTimeout").Call(Id("ctx"), duration(hook)),
+		Defer().Id("cancel").Call(),
+		Id("done").Op(":=").Make(Chan().Error(), Lit(1)),
+		Go().Func().Params().Block(Id("done").Op("<-").Id("stop").Call(Id("ctx"))).Call(),
+		Select().Block(
+			Case(Err().Op(":=").Op("<-").Id("done")).Block(Return(Err())),
+			Case(Op("<-").Id("ctx").Dot("Done").Call()).Block(Return(Id("ctx").Dot("Err").Call())),
+		),
+	)
+
+	addShutdownHTTPHelper(f)
+}
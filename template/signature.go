@@ -0,0 +1,46 @@
+package template
+
+import (
+	"fmt"
+
+	"github.com/angrypie/tie/parser"
+)
+
+//ValidateSignatures returns error if arguments or results of functions and arguments of
+//receiver constructors can't be transferred over the wire (see parser.Type.CheckWire).
+func ValidateSignatures(info *PackageInfo) (err error) {
+	check := func(name string, fields []parser.Field) error {
+		for _, field := range fields {
+			if field.TypeName() == "error" || IsContextField(field) {
+				continue
+			}
+			if e := field.CheckWire(); e != nil {
+				return fmt.Errorf("%s: %s: %w", name, field.Name(), e)
+			}
+		}
+		return nil
+	}
+	ForEachFunction(info, true, func(fn parser.Function) {
+		if err == nil {
+			err = check(functionName(fn), fn.Arguments)
+		}
+		if err == nil {
+			err = check(functionName(fn), fn.Results.List())
+		}
+	})
+	if err != nil {
+		return
+	}
+	for _, c := range info.Constructors {
+		var wire []parser.Field
+		for _, arg := range filterHelperArgs(c.Function.Arguments, info) {
+			if _, ok := info.GetConstructor(arg); !ok && !IsProvided(arg) {
+				wire = append(wire, arg)
+			}
+		}
+		if err = check(c.Function.Name, wire); err != nil {
+			return
+		}
+	}
+	return
+}
@@ -0,0 +1,38 @@
+package template
+
+import (
+	"go/types"
+	"testing"
+
+	"github.com/angrypie/tie/parser"
+	tieTypes "github.com/angrypie/tie/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateSignatures(t *testing.T) {
+	str := types.Typ[types.String]
+	results, err := parser.NewResultFields(
+		parser.NewField(types.NewVar(0, nil, "err", types.Universe.Lookup("error").Type())),
+	)
+	require.NoError(t, err)
+	function := func(arg types.Type) parser.Function {
+		return parser.Function{
+			Name:      "Create",
+			Arguments: []parser.Field{parser.NewField(types.NewVar(0, nil, "opts", arg))},
+			Results:   results,
+		}
+	}
+	info := &PackageInfo{Service: &tieTypes.Service{}}
+
+	info.Functions = []parser.Function{function(types.NewSlice(str))}
+	require.NoError(t, ValidateSignatures(info))
+
+	anonymous := types.NewStruct([]*types.Var{types.NewField(0, nil, "A", str, false)}, nil)
+	info.Functions = []parser.Function{function(types.NewMap(str, types.NewPointer(anonymous)))}
+	require.EqualError(t, ValidateSignatures(info),
+		"Create: opts: anonymous struct type is not supported (declare named type)")
+
+	callback := types.NewSignatureType(nil, nil, nil, nil, nil, false)
+	info.Functions = []parser.Function{function(callback)}
+	require.EqualError(t, ValidateSignatures(info), "Create: opts: func type can't be transferred over the wire")
+}
@@ -0,0 +1,344 @@
+package template
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/angrypie/tie/parser"
+	"github.com/angrypie/tie/types"
+	. "github.com/dave/jennifer/jen"
+)
+
+//StateStores lists supported state store types, dapr store is generated by dapr module.
+var StateStores = []string{"memory", "file", "dapr"}
+
+//IsPersisted returns true if exported fields of receiver are kept in state store.
+func IsPersisted(receiver types.Field, info *PackageInfo) bool {
+	if info.Service == nil || info.Service.State == nil {
+		return false
+	}
+	for _, name := range info.Service.State.Receivers {
+		if name == TrimPrefix(receiver.TypeName()) {
+			return true
+		}
+	}
+	return false
+}
+
+//isMutatingMethod returns true if method may change receiver (has pointer receiver).
+func isMutatingMethod(fn parser.Function) bool {
+	prefix, _, _ := fn.Receiver.TypeParts()
+	return strings.HasPrefix(prefix, "*")
+}
+
+//receiverStateKey returns state store key of top level receiver.
+func receiverStateKey(receiver types.Field) string {
+	return "receiver/" + TrimPrefix(receiver.TypeName())
+}
+
+//sessionStateKey returns code of state store key of session receiver.
+func sessionStateKey(receiver types.Field, handle Code) *Statement {
+	return Lit("session/" + TrimPrefix(receiver.TypeName()) + "/").Op("+").Add(handle)
+}
+
+//ValidateState returns error if state configuration refers to unknown store or receivers
+//which state can't be kept (receivers created for each request).
+func ValidateState(info *PackageInfo) error {
+	state := info.Service.State
+	if state == nil {
+		return nil
+	}
+	known := false
+	for _, store := range StateStores {
+		known = known || state.Store == "" || state.Store == store
+	}
+	if !known {
+		return fmt.Errorf("state: unknown store %s", state.Store)
+	}
+	if state.Store == "dapr" && !hasTransport(info.Service, "dapr") {
+		return fmt.Errorf("state: dapr store requires dapr service type")
+	}
+	receivers := make(map[string]parser.Field)
+	MakeForEachReceiver(info, func(receiver parser.Field, constructor OptionalConstructor) {
+		receivers[TrimPrefix(receiver.TypeName())] = receiver
+	})
+	for _, name := range state.Receivers {
+		receiver, ok := receivers[name]
+		if !ok {
+			return fmt.Errorf("state: unknown receiver %s", name)
+		}
+		c, ok := info.GetConstructor(receiver)
+		if ok && !HasTopLevelReceiver(c.Function, info) && !IsSession(receiver, info) {
+			return fmt.Errorf("state: receiver %s is created for each request, only top level and session receivers can be persisted", name)
+		}
+	}
+	return nil
+}
+
+//StateStoreType is interface of state store in lifecycle package.
+const StateStoreType = "StateStore"
+
+//StateStoresVar is map of state store constructors by store type in lifecycle package,
+//modules can register additional stores in init function.
+const StateStoresVar = "StateStores"
+
+const stateInitHelper = "stateInitHelper"
+const stateRestoreHelper = "StateRestore"
+const stateSaveHelper = "StateSave"
+const stateDeleteHelper = "stateDeleteHelper"
+const stateLockHelper = "StateLock"
+const sessionLoadHelper = "SessionLoad"
+
+//makeStateInit initializes state store before receivers are created, process exits
+//if store can't be initialized.
+func makeStateInit(info *PackageInfo, g *Group) {
+	state := info.Service.State
+	if state == nil {
+		return
+	}
+	g.If(
+		Err().Op(":=").Id(stateInitHelper).Call(Lit(state.Store), Lit(state.Path)),
+		Err().Op("!=").Nil(),
+	).Block(
+		createErrLog("failed to start service"),
+		Id(ShutdownHelper).Call(),
+		Qual("os", "Exit").Call(Lit(1)),
+	)
+}
+
+//makeStateRestore restores state of top level receiver after it is created.
+func makeStateRestore(info *PackageInfo, receiver parser.Field, g *Group, recId string) {
+	if !IsPersisted(receiver, info) {
+		return
+	}
+	AddIfErrorGuard(g, List(Id("_"), Err()).Op("=").
+		Add(Lifecycle(info, stateRestoreHelper)).Call(Lit(receiverStateKey(receiver)), Id(recId)), "err", nil)
+}
+
+//makeStateLock locks state key until state is saved, mutating calls of persisted receiver
+//are serialized so saved state is taken after each call and saves are not reordered.
+//It returns function that adds unlock after state is saved (lock is also released
+//if handler returns earlier).
+func makeStateLock(info *PackageInfo, g *Group, key Code) (unlock func(g *Group)) {
+	g.Id("unlockState").Op(":=").Add(Lifecycle(info, stateLockHelper)).Call(key)
+	g.Defer().Id("unlockState").Call()
+	return func(g *Group) {
+		g.Id("unlockState").Call()
+	}
+}
+
+//makeSessionSave saves session receiver state with constructor arguments (to recreate receiver).
+func makeSessionSave(
+	info *PackageInfo, receiver types.Field, g *Group,
+	errGuard IfErrorGuard, recId, receiverPath string,
+) {
+	handle := Id(receiverPath).Dot(SessionField)
+	errGuard(g, Err().Op("=").Add(Lifecycle(info, stateSaveHelper)).Call(
+		sessionStateKey(receiver, handle),
+		Map(String()).Interface().Values(Dict{Lit("args"): Id(receiverPath), Lit("state"): Id(recId)}),
+	))
+}
+
+//makeSessionRestore creates receiver from session saved in state store.
+func makeSessionRestore(
+	info *PackageInfo, constructor Constructor, g *Group,
+	deps DepsMap, errGuard IfErrorGuard,
+	resourceInstance, recId, receiverPath string, stack []string,
+) error {
+	receiver := constructor.Receiver
+	handle := Id(receiverPath).Dot(SessionField)
+	dataId, restoredId := ID("state", recId), ID("restored", recId)
+
+	g.Var().Id(dataId).Index().Byte()
+	errGuard(g, List(Id(dataId), Err()).Op("=").Add(Lifecycle(info, sessionLoadHelper)).Call(
+		Lit(receiver.TypeName()), sessionStateKey(receiver, handle), Op("&").Id(receiverPath),
+	))
+	err := makeReceiverInstance(info, constructor, g, deps, errGuard, resourceInstance, restoredId, receiverPath, stack)
+	if err != nil {
+		return err
+	}
+	errGuard(g, Err().Op("=").Qual("encoding/json", "Unmarshal").Call(Id(dataId), Id(restoredId)))
+	ttl, max := sessionLimitsCode(receiver, info)
+	g.Add(Lifecycle(info, sessionPutHelper)).Call(Lit(receiver.TypeName()), handle, Id(restoredId), ttl, max)
+	g.Id(recId).Op("=").Id(restoredId)
+	return nil
+}
+
+//AddStateHelpers creates state stores and helpers that save and restore receivers state.
+//State is saved only if it was changed since last save or restore.
+func AddStateHelpers(info *PackageInfo, f *File) {
+	if info.Service.State == nil {
+		return
+	}
+	key := Id("key").String()
+	data := Id("data").Index().Byte()
+
+	f.Comment("stateStore keeps receivers state by key.")
+	f.Type().Id(StateStoreType).Interface(
+		Id("Load").Params(key).Params(data, Id("ok").Bool(), Err().Error()),
+		Id("Save").Params(key, data).Error(),
+		Id("Delete").Params(key).Error(),
+	)
+
+	f.Var().Defs(
+		Id(StateStoresVar).Op("=").Map(String()).Func().Params(String()).Params(Id(StateStoreType), Error()).
+			Values(Dict{
+				Lit("memory"): Id("newMemoryStateStore"),
+				Lit("file"):   Id("newFileStateStore"),
+			}),
+		Id("state").Id(StateStoreType),
+		Id("stateMu").Qual("sync", "Mutex"),
+		Id("stateLast").Op("=").Make(Map(String()).String()),
+		Id("stateLocksMu").Qual("sync", "Mutex"),
+		Id("stateLocks").Op("=").Make(Map(String()).Op("*").Id("stateLock")),
+	)
+
+	//stateLock is removed when nobody holds or waits for it.
+	f.Type().Id("stateLock").Struct(
+		Id("mu").Qual("sync", "Mutex"),
+		Id("refs").Int(),
+	)
+	f.Comment(stateLockHelper + " locks state key until unlock is called (it can be called several times).")
+	f.Comment("Mutating calls of persisted receiver hold lock until their state is saved.")
+	f.Func().Id(stateLockHelper).Params(key).Params(Id("unlock").Func().Params()).Block(
+		Id("stateLocksMu").Dot("Lock").Call(),
+		List(Id("lock"), Id("ok")).Op(":=").Id("stateLocks").Index(Id("key")),
+		If(Op("!").Id("ok")).Block(
+			Id("lock").Op("=").New(Id("stateLock")),
+			Id("stateLocks").Index(Id("key")).Op("=").Id("lock"),
+		),
+		Id("lock").Dot("refs").Op("++"),
+		Id("stateLocksMu").Dot("Unlock").Call(),
+		Id("lock").Dot("mu").Dot("Lock").Call(),
+		Var().Id("once").Qual("sync", "Once"),
+		Return(Func().Params().Block(Id("once").Dot("Do").Call(Func().Params().Block(
+			Id("lock").Dot("mu").Dot("Unlock").Call(),
+			Id("stateLocksMu").Dot("Lock").Call(),
+			Id("lock").Dot("refs").Op("--"),
+			If(Id("lock").Dot("refs").Op("==").Lit(0)).Block(Delete(Id("stateLocks"), Id("key"))),
+			Id("stateLocksMu").Dot("Unlock").Call(),
+		)))),
+	)
+
+	//Memory store keeps state until process exits (useful for tests).
+	f.Type().Id("memoryStateStore").Struct(
+		Id("mu").Qual("sync", "Mutex"),
+		Id("data").Map(String()).Index().Byte(),
+	)
+	f.Func().Id("newMemoryStateStore").Params(String()).Params(Id(StateStoreType), Error()).Block(
+		Return(Op("&").Id("memoryStateStore").Values(Dict{Id("data"): Make(Map(String()).Index().Byte())}), Nil()),
+	)
+	memory := Id("s").Op("*").Id("memoryStateStore")
+	lock := func() []Code {
+		return []Code{Id("s").Dot("mu").Dot("Lock").Call(), Defer().Id("s").Dot("mu").Dot("Unlock").Call()}
+	}
+	f.Func().Params(memory).Id("Load").Params(key).Params(Index().Byte(), Bool(), Error()).Block(append(lock(),
+		List(Id("data"), Id("ok")).Op(":=").Id("s").Dot("data").Index(Id("key")),
+		Return(Id("data"), Id("ok"), Nil()),
+	)...)
+	f.Func().Params(memory).Id("Save").Params(key, data).Error().Block(append(lock(),
+		Id("s").Dot("data").Index(Id("key")).Op("=").Id("data"),
+		Return(Nil()),
+	)...)
+	f.Func().Params(memory).Id("Delete").Params(key).Error().Block(append(lock(),
+		Delete(Id("s").Dot("data"), Id("key")),
+		Return(Nil()),
+	)...)
+
+	//File store keeps each key in separate file, files are replaced atomically.
+	f.Type().Id("fileStateStore").Struct(Id("dir").String())
+	f.Func().Id("newFileStateStore").Params(Id("dir").String()).Params(Id(StateStoreType), Error()).Block(
+		If(Id("dir").Op("==").Lit("")).Block(Id("dir").Op("=").Lit("tie_state")),
+		Return(Op("&").Id("fileStateStore").Values(Id("dir")), Qual("os", "MkdirAll").Call(Id("dir"), Lit(0755))),
+	)
+	file := Id("s").Op("*").Id("fileStateStore")
+	f.Func().Params(file).Id("path").Params(key).String().Block(
+		Return(Qual("path/filepath", "Join").Call(
+			Id("s").Dot("dir"), Qual("net/url", "PathEscape").Call(Id("key")).Op("+").Lit(".json"),
+		)),
+	)
+	f.Func().Params(file).Id("Load").Params(key).Params(Index().Byte(), Bool(), Error()).Block(
+		List(Id("data"), Err()).Op(":=").Qual("io/ioutil", "ReadFile").Call(Id("s").Dot("path").Call(Id("key"))),
+		If(Qual("os", "IsNotExist").Call(Err())).Block(Return(Nil(), False(), Nil())),
+		Return(Id("data"), Err().Op("==").Nil(), Err()),
+	)
+	f.Func().Params(file).Id("Save").Params(key, data).Error().Block(
+		Id("tmp").Op(":=").Id("s").Dot("path").Call(Id("key")).Op("+").Lit(".tmp"),
+		If(
+			Err().Op(":=").Qual("io/ioutil", "WriteFile").Call(Id("tmp"), Id("data"), Lit(0644)),
+			Err().Op("!=").Nil(),
+		).Block(Return(Err())),
+		Return(Qual("os", "Rename").Call(Id("tmp"), Id("s").Dot("path").Call(Id("key")))),
+	)
+	f.Func().Params(file).Id("Delete").Params(key).Error().Block(
+		Err().Op(":=").Qual("os", "Remove").Call(Id("s").Dot("path").Call(Id("key"))),
+		If(Qual("os", "IsNotExist").Call(Err())).Block(Return(Nil())),
+		Return(Err()),
+	)
+
+	//Store type and path can be changed by environment variables.
+	f.Func().Id(stateInitHelper).Params(List(Id("store"), Id("path")).String()).Error().Block(
+		If(Id("s").Op(":=").Qual("os", "Getenv").Call(Lit("TIE_STATE_STORE")), Id("s").Op("!=").Lit("")).Block(
+			Id("store").Op("=").Id("s"),
+		),
+		If(Id("p").Op(":=").Qual("os", "Getenv").Call(Lit("TIE_STATE_PATH")), Id("p").Op("!=").Lit("")).Block(
+			Id("path").Op("=").Id("p"),
+		),
+		If(Id("store").Op("==").Lit("")).Block(Id("store").Op("=").Lit("memory")),
+		List(Id("create"), Id("ok")).Op(":=").Id(StateStoresVar).Index(Id("store")),
+		If(Op("!").Id("ok")).Block(
+			Return(Qual("fmt", "Errorf").Call(Lit("unknown state store %s"), Id("store"))),
+		),
+		Var().Err().Error(),
+		List(Id("state"), Err()).Op("=").Id("create").Call(Id("path")),
+		Return(Err()),
+	)
+
+	f.Func().Id(stateRestoreHelper).Params(key, Id("value").Interface()).Params(Bool(), Error()).Block(
+		List(Id("data"), Id("ok"), Err()).Op(":=").Id("state").Dot("Load").Call(Id("key")),
+		If(Err().Op("!=").Nil().Op("||").Op("!").Id("ok")).Block(Return(Id("ok"), Err())),
+		Id("stateMu").Dot("Lock").Call(),
+		Id("stateLast").Index(Id("key")).Op("=").String().Call(Id("data")),
+		Id("stateMu").Dot("Unlock").Call(),
+		Return(True(), Qual("encoding/json", "Unmarshal").Call(Id("data"), Id("value"))),
+	)
+
+	f.Func().Id(stateSaveHelper).Params(key, Id("value").Interface()).Error().Block(
+		List(Id("data"), Err()).Op(":=").Qual("encoding/json", "Marshal").Call(Id("value")),
+		If(Err().Op("!=").Nil()).Block(Return(Err())),
+		Id("stateMu").Dot("Lock").Call(),
+		Defer().Id("stateMu").Dot("Unlock").Call(),
+		If(Id("stateLast").Index(Id("key")).Op("==").String().Call(Id("data"))).Block(Return(Nil())),
+		If(
+			Err().Op("=").Id("state").Dot("Save").Call(Id("key"), Id("data")),
+			Err().Op("!=").Nil(),
+		).Block(Return(Err())),
+		Id("stateLast").Index(Id("key")).Op("=").String().Call(Id("data")),
+		Return(Nil()),
+	)
+
+	f.Func().Id(stateDeleteHelper).Params(key).Error().Block(
+		Id("stateMu").Dot("Lock").Call(),
+		Defer().Id("stateMu").Dot("Unlock").Call(),
+		Delete(Id("stateLast"), Id("key")),
+		Return(Id("state").Dot("Delete").Call(Id("key"))),
+	)
+
+	if len(info.Service.Sessions) == 0 {
+		return
+	}
+	//sessionLoadHelper decodes saved constructor arguments to args and returns saved state.
+	f.Func().Id(sessionLoadHelper).Params(List(Id("kind"), Id("key")).String(), Id("args").Interface()).
+		Params(Index().Byte(), Error()).Block(
+		Var().Id("record").Struct(
+			Id("Args").Qual("encoding/json", "RawMessage").Tag(map[string]string{"json": "args"}),
+			Id("State").Qual("encoding/json", "RawMessage").Tag(map[string]string{"json": "state"}),
+		),
+		List(Id("ok"), Err()).Op(":=").Id(stateRestoreHelper).Call(Id("key"), Op("&").Id("record")),
+		If(Err().Op("!=").Nil()).Block(Return(Nil(), Err())),
+		If(Op("!").Id("ok")).Block(
+			Return(Nil(), Qual("fmt", "Errorf").Call(Lit("%s session not found or expired"), Id("kind"))),
+		),
+		Return(Id("record").Dot("State"), Qual("encoding/json", "Unmarshal").Call(Id("record").Dot("Args"), Id("args"))),
+	)
+}
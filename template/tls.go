@@ -0,0 +1,185 @@
+package template
+
+import (
+	"fmt"
+
+	"github.com/angrypie/tie/types"
+	. "github.com/dave/jennifer/jen"
+)
+
+//TLSConfigHelper returns TLS configuration of servers (lifecycle package).
+const TLSConfigHelper = "TLSConfig"
+
+//ClientTLSHelper returns TLS configuration of client, HTTPClientHelper returns
+//http.Client that uses it and retries requests rejected with 429 (see addRetryTransport).
+const (
+	ClientTLSHelper  = "clientTLSHelper"
+	HTTPClientHelper = "httpClientHelper"
+)
+
+const tlsPathHelper = "tlsPathHelper"
+const certPoolHelper = "certPoolHelper"
+
+//Environment variables that override paths of TLS files.
+const (
+	tlsCertEnv = "TIE_TLS_CERT"
+	tlsKeyEnv  = "TIE_TLS_KEY"
+	tlsCAEnv   = "TIE_TLS_CA"
+)
+
+//IsTLS returns true if servers of service use TLS.
+func IsTLS(info *PackageInfo) bool {
+	return info.Service.TLS != nil
+}
+
+//ValidateTLS returns error if TLS configuration is incomplete.
+func ValidateTLS(info *PackageInfo) error {
+	config := info.Service.TLS
+	switch {
+	case config == nil:
+		return nil
+	case config.Cert == "" || config.Key == "":
+		return fmt.Errorf("tls: cert and key are required")
+	case config.ClientAuth && config.CA == "":
+		return fmt.Errorf("tls: client_auth requires ca")
+	}
+	return nil
+}
+
+//ClientScheme returns scheme of service address (https or wss if service uses TLS).
+func ClientScheme(info *PackageInfo, scheme string) string {
+	if IsTLS(info) {
+		return scheme + "s"
+	}
+	return scheme
+}
+
+//addTLSFileHelpers creates helpers that resolve path of TLS file and load CA certificates.
+func addTLSFileHelpers(f *File) {
+	f.Func().Id(tlsPathHelper).Params(List(Id("env"), Id("path")).String()).String().Block(
+		If(Id("value").Op(":=").Qual("os", "Getenv").Call(Id("env")), Id("value").Op("!=").Lit("")).Block(
+			Return(Id("value")),
+		),
+		Return(Id("path")),
+	)
+	f.Func().Id(certPoolHelper).Params(Id("path").String()).Params(Op("*").Qual("crypto/x509", "CertPool"), Error()).Block(
+		List(Id("data"), Err()).Op(":=").Qual("io/ioutil", "ReadFile").Call(Id("path")),
+		If(Err().Op("!=").Nil()).Block(Return(Nil(), Err())),
+		Id("pool").Op(":=").Qual("crypto/x509", "NewCertPool").Call(),
+		If(Op("!").Id("pool").Dot("AppendCertsFromPEM").Call(Id("data"))).Block(
+			Return(Nil(), Qual("fmt", "Errorf").Call(Lit("no certificates in %s"), Id("path"))),
+		),
+		Return(Id("pool"), Nil()),
+	)
+}
+
+//tlsPaths returns code of certificate, key and CA paths (environment variables override them).
+func tlsPaths(config types.TLS) (cert, key, ca *Statement) {
+	return Id(tlsPathHelper).Call(Lit(tlsCertEnv), Lit(config.Cert)),
+		Id(tlsPathHelper).Call(Lit(tlsKeyEnv), Lit(config.Key)),
+		Id(tlsPathHelper).Call(Lit(tlsCAEnv), Lit(config.CA))
+}
+
+//AddTLSHelpers creates TLSConfig helper of servers. Clients of certificate authority are
+//verified if CA is set, client certificate is required if client_auth is set (mutual TLS).
+func AddTLSHelpers(info *PackageInfo, f *File) {
+	if !IsTLS(info) {
+		return
+	}
+	config := *info.Service.TLS
+	addTLSFileHelpers(f)
+	cert, key, ca := tlsPaths(config)
+
+	clientAuth := "VerifyClientCertIfGiven"
+	if config.ClientAuth {
+		clientAuth = "RequireAndVerifyClientCert"
+	}
+	f.Comment("TLSConfig returns TLS configuration of servers.")
+	f.Func().Id(TLSConfigHelper).Params().Params(Op("*").Qual("crypto/tls", "Config"), Error()).Block(
+		List(Id("certificate"), Err()).Op(":=").Qual("crypto/tls", "LoadX509KeyPair").Call(cert, key),
+		If(Err().Op("!=").Nil()).Block(Return(Nil(), Err())),
+		Id("config").Op(":=").Op("&").Qual("crypto/tls", "Config").Values(Dict{
+			Id("Certificates"): Index().Qual("crypto/tls", "Certificate").Values(Id("certificate")),
+			Id("MinVersion"):   Qual("crypto/tls", "VersionTLS12"),
+		}),
+		If(Id("ca").Op(":=").Add(ca), Id("ca").Op("!=").Lit("")).Block(
+			If(
+				List(Id("config").Dot("ClientCAs"), Err()).Op("=").Id(certPoolHelper).Call(Id("ca")),
+				Err().Op("!=").Nil(),
+			).Block(Return(Nil(), Err())),
+			Id("config").Dot("ClientAuth").Op("=").Qual("crypto/tls", clientAuth),
+		),
+		Return(Id("config"), Nil()),
+	)
+}
+
+//makeTLSInit makes service certificate client certificate of process, clients of other
+//services present it unless TIE_TLS_CERT and TIE_TLS_KEY are set.
+func makeTLSInit(info *PackageInfo, g *Group) {
+	if !IsTLS(info) {
+		return
+	}
+	config := info.Service.TLS
+	g.If(Qual("os", "Getenv").Call(Lit(tlsCertEnv)).Op("==").Lit("")).Block(
+		Qual("os", "Setenv").Call(Lit(tlsCertEnv), Lit(config.Cert)),
+		Qual("os", "Setenv").Call(Lit(tlsKeyEnv), Lit(config.Key)),
+	)
+}
+
+//AddClientTLSHelpers creates helpers of client configuration. Server certificate is verified
+//with CA of service, client presents certificate of process (see makeTLSInit) or of service.
+func AddClientTLSHelpers(info *PackageInfo, f *File) {
+	addRetryTransport(f)
+	if !IsTLS(info) {
+		f.Var().Id("httpClient").Op("=").Op("&").Qual("net/http", "Client").Values(Dict{
+			Id("Transport"): Op("&").Id("retryTransport").Values(Qual("net/http", "DefaultTransport")),
+		})
+		f.Func().Id(ClientTLSHelper).Params().Params(Op("*").Qual("crypto/tls", "Config"), Error()).Block(
+			Return(Nil(), Nil()),
+		)
+		f.Func().Id(HTTPClientHelper).Params().Params(Op("*").Qual("net/http", "Client"), Error()).Block(
+			Return(Id("httpClient"), Nil()),
+		)
+		return
+	}
+	addTLSFileHelpers(f)
+	cert, key, ca := tlsPaths(*info.Service.TLS)
+
+	f.Var().Id("clientTLS").Struct(
+		Qual("sync", "Once"),
+		Id("config").Op("*").Qual("crypto/tls", "Config"),
+		Id("client").Op("*").Qual("net/http", "Client"),
+		Err().Error(),
+	)
+	f.Func().Id("loadClientTLS").Params().Params(Op("*").Qual("crypto/tls", "Config"), Error()).Block(
+		Id("config").Op(":=").Op("&").Qual("crypto/tls", "Config").Values(Dict{
+			Id("MinVersion"): Qual("crypto/tls", "VersionTLS12"),
+		}),
+		Var().Err().Error(),
+		If(Id("ca").Op(":=").Add(ca), Id("ca").Op("!=").Lit("")).Block(
+			If(
+				List(Id("config").Dot("RootCAs"), Err()).Op("=").Id(certPoolHelper).Call(Id("ca")),
+				Err().Op("!=").Nil(),
+			).Block(Return(Nil(), Err())),
+		),
+		List(Id("certificate"), Err()).Op(":=").Qual("crypto/tls", "LoadX509KeyPair").Call(cert, key),
+		If(Err().Op("!=").Nil()).Block(Return(Nil(), Err())),
+		Id("config").Dot("Certificates").Op("=").Index().Qual("crypto/tls", "Certificate").Values(Id("certificate")),
+		Return(Id("config"), Nil()),
+	)
+	f.Func().Id(ClientTLSHelper).Params().Params(Op("*").Qual("crypto/tls", "Config"), Error()).Block(
+		Id("clientTLS").Dot("Do").Call(Func().Params().Block(
+			List(Id("clientTLS").Dot("config"), Id("clientTLS").Dot("err")).Op("=").Id("loadClientTLS").Call(),
+			Id("transport").Op(":=").Qual("net/http", "DefaultTransport").Assert(Op("*").Qual("net/http", "Transport")).Dot("Clone").Call(),
+			Id("transport").Dot("TLSClientConfig").Op("=").Id("clientTLS").Dot("config"),
+			Id("clientTLS").Dot("client").Op("=").Op("&").Qual("net/http", "Client").Values(Dict{
+				Id("Transport"): Op("&").Id("retryTransport").Values(Id("transport")),
+			}),
+		)),
+		Return(Id("clientTLS").Dot("config"), Id("clientTLS").Dot("err")),
+	)
+	f.Func().Id(HTTPClientHelper).Params().Params(Op("*").Qual("net/http", "Client"), Error()).Block(
+		If(List(Id("_"), Err()).Op(":=").Id(ClientTLSHelper).Call(), Err().Op("!=").Nil()).Block(Return(Nil(), Err())),
+		Return(Id("clientTLS").Dot("client"), Nil()),
+	)
+}
@@ -46,10 +46,18 @@ func CreateArgsListFunc(args []parser.Field, params ...string) func(*Group) {
 //CreateSignatureFromArgs creates signature from Fields (see CreateArgListFunc).
 func CreateSignatureFromArgs(args []parser.Field, info *PackageInfo, params ...string) func(*Group) {
 	return CreateArgsList(args, func(arg *Statement, field parser.Field) *Statement {
-		return Id(field.Name()).Add(createTypeFromField(field, info))
+		return Id(field.Name()).Add(createParamTypeFromField(field, info))
 	}, params...)
 }
 
+//SpreadVariadic passes slice to variadic parameter (e.g. request.Tags...).
+func SpreadVariadic(arg *Statement, field parser.Field) *Statement {
+	if field.IsVariadic() {
+		return arg.Op("...")
+	}
+	return arg
+}
+
 //CreateArgsList creates list from parser.Field array.
 //Transform function is used to modify each element list.
 //Optional param 1 is used to specify prefix for each element.
@@ -102,12 +110,14 @@ func CreateTypeAliases(info *PackageInfo, f *File) {
 	})
 }
 
-//CreateReqRespTypes creates request response types for each method.
-func CreateReqRespTypes(info *PackageInfo, f *File) {
+//CreateReqRespTypes creates request response types for each method,
+//client is true if types are created for client module.
+func CreateReqRespTypes(info *PackageInfo, f *File, client bool) {
 	f.Comment("Request/Response types")
+	CreateProviders(info, f)
 	cb := func(receiver parser.Field, constructor OptionalConstructor) {
 		//TODO do not generate this on server side
-		t, c := ClientReceiverType(receiver, constructor, info)
+		t, c := ClientReceiverType(receiver, constructor, info, client)
 		f.Add(t).Line().Add(c).Line()
 	}
 	MakeForEachReceiver(info, cb)
@@ -131,8 +141,9 @@ func TypeDeclFormFields(name string, args []types.Field, info *PackageInfo) Code
 		for _, arg := range args {
 			name := arg.Name()
 			field := Id(strings.Title(name)).Add(createTypeFromField(arg, info))
-			jsonTag := strings.ToLower(name)
-			if arg.TypeName() == "error" {
+			jsonTag := JSONName(info, name)
+			//Errors, contexts and channels are not transferred over the wire
+			if arg.TypeName() == "error" || IsContextField(arg) || isChanField(arg) {
 				jsonTag = "-"
 			}
 			//TODO query tag is for echo, inject tag generation instead
@@ -146,9 +157,10 @@ func TypeDeclFormFields(name string, args []types.Field, info *PackageInfo) Code
 //Type contains only fields from constructor arguments. Contructor match
 //original one by signature but only initializes recevier fieds.
 //Example: type Foo{...}; NewFoo(x int) -> type Foo { x int }; NewFoo(x int)
-func ClientReceiverType(receiver parser.Field, constructor OptionalConstructor, info *PackageInfo) (
+func ClientReceiverType(receiver parser.Field, constructor OptionalConstructor, info *PackageInfo, client bool) (
 	typeDecl, constructorDecl Code) {
 	receiverType := receiver.TypeName()
+	isSession := IsSession(receiver, info)
 
 	constructor(func(c Constructor) {
 		fn := c.Function
@@ -156,9 +168,15 @@ func ClientReceiverType(receiver parser.Field, constructor OptionalConstructor,
 
 		typeDecl = Type().Id(receiverType).StructFunc(func(g *Group) {
 			for _, arg := range filterHelperArgs(args, info) {
-				//TODO add json tag to client type which is used also for nested receiver dep init
 				field := Id(strings.Title(arg.Name())).Add(createTypeFromField(arg, info))
-				g.Add(field)
+				//Getter interface is transferred as provider with getter values
+				if IsProvided(arg) {
+					field = Id(strings.Title(arg.Name())).Id(providerType(arg))
+				}
+				g.Add(field.Tag(map[string]string{"json": JSONName(info, arg.Name())}))
+			}
+			if isSession {
+				g.Id(SessionField).String().Tag(map[string]string{"json": ToSnakeCase(SessionField)})
 			}
 		})
 
@@ -168,7 +186,7 @@ func ClientReceiverType(receiver parser.Field, constructor OptionalConstructor,
 					prefix, _, local := field.TypeParts()
 					return Id(field.Name()).Id(prefix + local)
 				}
-				return Id(field.Name()).Add(createTypeFromField(field, info))
+				return Id(field.Name()).Add(createParamTypeFromField(field, info))
 			})
 		}
 
@@ -183,7 +201,18 @@ func ClientReceiverType(receiver parser.Field, constructor OptionalConstructor,
 				filtered := filterHelperArgs(args, info)
 				if len(filtered) > 0 {
 					g.ListFunc(CreateArgsListFunc(filtered, receiver)).Op("=").
-						ListFunc(CreateArgsListFunc(filtered))
+						ListFunc(CreateArgsList(filtered, func(arg *Statement, field parser.Field) *Statement {
+							if IsProvided(field) {
+								return Id(providerConstructor(field)).Call(arg)
+							}
+							return arg
+						}))
+				}
+
+				//Session is opened on server, client keeps only handle
+				if isSession && client {
+					g.List(Id(receiver).Dot(SessionField), Id(results[len(results)-1].Name())).Op("=").
+						Id(receiver).Dot(OpenSessionMethod).Call()
 				}
 
 				g.Return(ListFunc(CreateArgsListFunc(results)))
@@ -194,6 +223,14 @@ func ClientReceiverType(receiver parser.Field, constructor OptionalConstructor,
 	return
 }
 
+//createParamTypeFromField creates type of function parameter, variadic parameter has ...T type.
+func createParamTypeFromField(field parser.Field, info *PackageInfo) Code {
+	if !field.IsVariadic() {
+		return createTypeFromField(field, info)
+	}
+	return Op("...").Add(createTypeFromField(field.VariadicElem(), info))
+}
+
 //createTypeFromField create qualified type from types.Field.
 func createTypeFromField(field types.Field, info *PackageInfo) Code {
 	prefix, path, local := field.TypeParts()
@@ -209,10 +246,33 @@ func createTypeFromField(field types.Field, info *PackageInfo) Code {
 	return Op(prefix).Qual(path, local)
 }
 
+func isChanField(field types.Field) bool {
+	f, ok := field.(parser.Field)
+	return ok && f.IsChan()
+}
+
+//CreateChanElemType creates qualified element type of receive-only channel field.
+func CreateChanElemType(field parser.Field, info *PackageInfo) Code {
+	elem, ok := field.RecvChanElem()
+	if !ok {
+		return createTypeFromField(field, info)
+	}
+	return createTypeFromField(elem, info)
+}
+
+//InjectContextArgs assigns ctx to context.Context arguments of request object.
+func InjectContextArgs(g *Group, fn parser.Function, request string, ctx Code) {
+	for _, arg := range fn.Arguments {
+		if IsContextField(arg) {
+			g.Id(request).Dot(strings.Title(arg.Name())).Op("=").Add(ctx)
+		}
+	}
+}
+
 //injectOriginalMethodCall injects original method call.
 func injectOriginalMethodCall(g *Group, fn parser.Function, method Code) {
 	g.ListFunc(CreateArgsListFunc(fn.Results.List(), "response")).
-		Op("=").Add(method).Call(ListFunc(CreateArgsListFunc(fn.Arguments, "request")))
+		Op("=").Add(method).Call(ListFunc(CreateArgsList(fn.Arguments, SpreadVariadic, "request")))
 }
 
 func MakeInitService(info *PackageInfo, main *Group) {
@@ -224,53 +284,10 @@ func MakeInitService(info *PackageInfo, main *Group) {
 		Err().Op("!=").Nil(),
 	).Block(
 		createErrLog("failed to init service"),
-		Return(),
+		Qual("os", "Exit").Call(Lit(1)),
 	)
 }
 
-//TODO
-//makeWaitGuard creates guard that blocks current thread
-func makeWaitGuard(main *Group) {
-	main.Op("<-").Make(Chan().Bool())
-}
-
-//GracefulShutdown calls Stop methods on receivers before program termination.
-func GracefulShutdown(info *PackageInfo, g *Group, f *File) {
-	g.Comment("GracefulShutdown(local scope)").Line()
-	f.Comment("GracefulShutdown (file)").Line()
-
-	functionName := "gracefulShutDown"
-	g.Id(functionName).Call()
-
-	f.Type().Id("stoppable").Interface(Id("Stop").Params().Error())
-
-	f.Var().Id("stoppableServices").Index().Id("stoppable")
-
-	f.Func().Id(functionName).Params().Block(
-		Id("sigChan").Op(":=").Make(Chan().Qual("os", "Signal")),
-		Qual("os/signal", "Notify").Call(Id("sigChan"), Qual("syscall", "SIGTERM")),
-		Qual("os/signal", "Notify").Call(Id("sigChan"), Qual("syscall", "SIGINT")),
-
-		Go().Func().Params().BlockFunc(func(g *Group) {
-			g.Op("<-").Id("sigChan")
-			if info.IsStopService {
-				//TODO add time limit for StopService execution
-				g.Id("err").Op(":=").Qual(info.GetServicePath(), "StopService").Call()
-				g.If(Err().Op("!=").Nil()).Block(
-					Qual("log", "Println").Call(List(Lit("ERR failed to stop service"), Err())),
-				)
-			}
-
-			g.For().List(Id("_"), Id("service")).Op(":=").Range().Id("stoppableServices").Block(
-				Id("service").Dot("Stop").Call(),
-			)
-
-			g.Qual("os", "Exit").Call(Lit(0))
-		}).Call(),
-	)
-	return
-}
-
 //GetEnvHelper global identifier for getEnv helper function.
 const GetEnvHelper = "getEnvHelper"
 
@@ -304,18 +321,17 @@ func AssignResultsToErr(err *Statement, respId string, fields parser.ResultField
 
 type DepsMap = map[string]*Statement
 
-//makeCallWithDeps injects deps to args list for constructor.
+//makeCallWithDeps injects deps to args list for constructor. Receivers created
+//for this call are passed in created map (argument name to instance id).
 func makeCallWithDeps(
 	constructor Constructor, info *PackageInfo,
-	deps DepsMap, resourceInstance, receiverPath string,
+	deps DepsMap, resourceInstance, receiverPath string, created map[string]string,
 ) func(g *Group) {
 	return CreateArgsList(constructor.Function.Arguments, func(arg *Statement, field parser.Field) *Statement {
 		fieldName := field.Name()
 
-		for name, dep := range deps {
-			if fieldName == name {
-				return dep
-			}
+		if dep, ok := injectDependency(field, deps); ok {
+			return dep
 		}
 
 		//Inject newely created or top level receiver dependencie
@@ -323,7 +339,7 @@ func makeCallWithDeps(
 			if HasTopLevelReceiver(depConstructor.Function, info) {
 				return Id(resourceInstance).Dot(GetReceiverVarName(field.TypeName()))
 			}
-			return Id(ID("dep", field.Name()))
+			return Id(created[fieldName])
 		}
 
 		if isFuncType(field.TypeName()) {
@@ -332,58 +348,32 @@ func makeCallWithDeps(
 
 		//TODO send nil for pointer or empty object
 		//Bind request argument
-		return ListFunc(CreateArgsListFunc([]parser.Field{field}, receiverPath))
-	})
-}
-
-//makeEmptyValuesWithDepsCall inject deps and empy values to args list for constructor.
-func makeEmptyValuesWithDepsCall(fn parser.Function, info *PackageInfo, deps DepsMap) func(g *Group) {
-	return CreateArgsList(fn.Arguments, func(arg *Statement, field parser.Field) *Statement {
-		fieldName := field.Name()
-		//TODO CHECK
-		prefix, path, local := field.TypeParts()
-
-		for name, dep := range deps {
-			if fieldName == name {
-				return dep
-			}
-		}
-
-		//TODO deduct zero value from any type
-		switch field.TypeName() {
-		case "string":
-			return Lit("")
-		case "int":
-			return Lit(0)
+		bind := ListFunc(CreateArgsListFunc([]parser.Field{field}, receiverPath))
+		if IsProvided(field) {
+			return Op("&").Add(bind)
 		}
-
-		//TODO add isInterface check remove IsExported from condition and uncomment lines bellow
-		if isFuncType(local) || prefix != "" || path != "" {
-			return Nil()
-		}
-
-		//if ast.IsExported(fieldType) {
-		//return Qual(info.GetServicePath(), TrimPrefix(fieldType)).Block()
-		//}
-
-		return Id(local)
+		return SpreadVariadic(bind, field)
 	})
 }
 
 const rndport = "github.com/angrypie/rndport"
 
 //MakeStartServerInit creates port and address initialization (from env or random).
-func MakeStartServerInit(info *PackageInfo, g *Group) {
-	portStr := info.Service.Port
+//Port of transport is read from PORT_<TRANSPORT> environment variable, PORT is used
+//by first transport of service.
+func MakeStartServerInit(info *PackageInfo, g *Group, transport string) {
+	portStr := TransportPort(info.Service, transport)
+	envs := []Code{Lit("PORT_" + strings.ToUpper(transport))}
+	if Transports(info.Service)[0] == transport {
+		envs = append(envs, Lit("PORT"))
+	}
 
 	//Try to use port value from environment
 	g.Var().Id("portStr").String()
-	g.If(
-		Id("p").Op(":=").Qual("os", "Getenv").Call(Lit("PORT")),
-		Id("p").Op("!=").Lit(""),
-	).Block(
-		Id("portStr").Op("=").Id("p"),
-	).Else().BlockFunc(func(g *Group) {
+	g.For(List(Id("_"), Id("env")).Op(":=").Range().Index().String().Values(envs...)).Block(
+		If(Id("portStr").Op("==").Lit("")).Block(Id("portStr").Op("=").Qual("os", "Getenv").Call(Id("env"))),
+	)
+	g.If(Id("portStr").Op("==").Lit("")).BlockFunc(func(g *Group) {
 		//Use random port if configuration and environment is empty
 		if portStr == "" {
 			g.List(Id("portStr"), Err()).Op("=").Qual(rndport, "GetAddress").Call(Lit("%d"))
@@ -398,91 +388,181 @@ func MakeStartServerInit(info *PackageInfo, g *Group) {
 	g.Id("address").Op(":=").Lit("0.0.0.0:").Op("+").Id("portStr")
 }
 
-//MakeReceiversForHandlers cerates instances for each top level receiver.
+//MakeReceiversForHandlers cerates instances for each top level receiver, instances are
+//shared by all transports of service (see lifecycle Receiver).
 func MakeReceiversForHandlers(info *PackageInfo, g *Group) (receiversCreated map[string]parser.Field) {
 	receiversCreated = make(map[string]parser.Field)
 	cb := func(receiver parser.Field, constructor OptionalConstructor) {
 
 		receiverType := receiver.TypeName()
 		recId := GetReceiverVarName(receiverType)
-		var skipInitStopable bool
 
 		//creates receiver instance using constructor if it exist, othewise using new().
 		constructor(
 			func(c Constructor) {
 				//Skip not top level receivers.
 				if !HasTopLevelReceiver(c.Function, info) {
-					skipInitStopable = true
 					return
 				}
 				fn := c.Function
-				constructorCall := makeEmptyValuesWithDepsCall(fn, info, DepsMap{"getEnv": Id(GetEnvHelper)})
-				g.List(Id(recId), Err()).Op(":=").Qual(info.GetServicePath(), fn.Name).CallFunc(constructorCall)
-				AddIfErrorGuard(g, nil, "err", nil)
-
+				makeSharedReceiver(info, receiver, g, func(g *Group) {
+					constructorCall := makeConfiguredCall(c, info, g, DefaultDeps())
+					g.List(Id(recId), Err()).Op(":=").Qual(info.GetServicePath(), fn.Name).CallFunc(constructorCall)
+					AddIfErrorGuard(g, nil, "err", nil)
+					makeStateRestore(info, receiver, g, recId)
+					makeStopHook(info, receiver, g, recId)
+				})
 				receiversCreated[receiverType] = receiver
 			}, func() {
-				g.Id(recId).Op(":=").New(Qual(info.GetServicePath(), receiverType))
+				makeSharedReceiver(info, receiver, g, func(g *Group) {
+					g.Id(recId).Op(":=").New(Qual(info.GetServicePath(), receiverType))
+					makeStateRestore(info, receiver, g, recId)
+					makeStopHook(info, receiver, g, recId)
+				})
 				receiversCreated[receiverType] = receiver
 			})
-
-		if !skipInitStopable {
-			if _, ok := info.GetFunction(receiver, "Stop"); ok {
-				g.Id("stoppableServices").Op("=").Append(Id("stoppableServices"), Id(recId))
-			}
-		}
 	}
 	MakeForEachReceiver(info, cb)
 	return receiversCreated
 }
 
-//MakeOriginalCall creates dependencies and make original method call (response object must be created)
+//MakeOriginalCall creates dependencies and make original method call (response object must be created).
+//Error of receiver dependencies is kept by info (see GenerateError), call is not created.
 func MakeOriginalCall(
 	info *PackageInfo, fn parser.Function, g *Group,
 	deps DepsMap, errGuard IfErrorGuard,
 	resourceInstance string,
 ) {
+	makeAccessGuard(info, fn, g, deps, errGuard)
+	makeValidationGuard(info, fn, g, errGuard)
 	//If method has receiver generate receiver dep code
 	//else just call public package method
+	var save func()
+	var err error
 	if HasReceiver(fn) {
 		constructor, ok := info.GetConstructor(fn.Receiver)
 		receiverType := fn.Receiver.TypeName()
 		//TODO replace recId with generated name
 		recId := GetReceiverVarName(receiverType)
+		persisted := IsPersisted(fn.Receiver, info)
 		if ok && !HasTopLevelReceiver(constructor.Function, info) {
-			//TODO make rucursive deps initialization?
-			//If method receiver has contructor with another receiver as dep (but not
-			//top level), than create those instances with their deps as well.
-			for _, arg := range constructor.Function.Arguments {
-				depCons, isReceiver := info.GetConstructor(arg)
-				if !isReceiver || HasTopLevelReceiver(depCons.Function, info) {
-					continue
+			//TODO do not hardcode request variable name
+			receiverPath := "request." + ReqRecName(fn)
+			saveSession := func() { makeSessionSave(info, fn.Receiver, g, errGuard, recId, receiverPath) }
+			switch {
+			case isSessionMethod(fn, OpenSessionMethod, info):
+				err = makeReceiverInstance(info, constructor, g, deps, errGuard, resourceInstance,
+					recId, receiverPath, nil)
+				makeSessionCall(info, fn, g, recId, receiverPath)
+				if persisted {
+					save = func() {
+						g.Id(receiverPath).Dot(SessionField).Op("=").
+							ListFunc(CreateArgsListFunc(fn.Results.List()[:1], "response"))
+						saveSession()
+					}
 				}
-				receiverType := depCons.Receiver.TypeName()
-				recId := ID("dep", arg.Name())
-				g.Id(recId).Op(":=").New(Qual(info.GetServicePath(), receiverType))
-				constructorCall := makeCallWithDeps(depCons, info, deps, resourceInstance, "request."+ReqRecName(fn)+"."+receiverType)
-				errGuard(g, List(Id(recId), Err()).Op("=").
-					Qual(info.GetServicePath(), depCons.Function.Name).CallFunc(constructorCall),
-				)
-
+			case isSessionMethod(fn, CloseSessionMethod, info):
+				makeSessionCall(info, fn, g, recId, receiverPath)
+			case IsSession(fn.Receiver, info):
+				err = makeSessionInstance(info, constructor, g, deps, errGuard, resourceInstance, recId, receiverPath, nil)
+				if persisted && isMutatingMethod(fn) {
+					unlock := makeStateLock(info, g, sessionStateKey(fn.Receiver, Id(receiverPath).Dot(SessionField)))
+					save = func() {
+						saveSession()
+						unlock(g)
+					}
+				}
+				injectOriginalMethodCall(g, fn, Id(recId).Dot(fn.Name))
+			default:
+				err = makeReceiverInstance(info, constructor, g, deps, errGuard, resourceInstance,
+					recId, receiverPath, nil)
+				injectOriginalMethodCall(g, fn, Id(recId).Dot(fn.Name))
 			}
-			g.Id(recId).Op(":=").New(Qual(info.GetServicePath(), receiverType))
-
-			//TODO do not hardcode request variable name
-			constructorCall := makeCallWithDeps(constructor, info, deps, resourceInstance, "request."+ReqRecName(fn))
-			errGuard(g, List(Id(recId), Err()).Op("=").
-				Qual(info.GetServicePath(), constructor.Function.Name).CallFunc(constructorCall),
-			)
-
-			injectOriginalMethodCall(g, fn, Id(recId).Dot(fn.Name))
 		} else {
+			if persisted && isMutatingMethod(fn) {
+				unlock := makeStateLock(info, g, Lit(receiverStateKey(fn.Receiver)))
+				save = func() {
+					errGuard(g, Err().Op("=").Add(Lifecycle(info, stateSaveHelper)).Call(
+						Lit(receiverStateKey(fn.Receiver)), Id(resourceInstance).Dot(recId),
+					))
+					unlock(g)
+				}
+			}
 			injectOriginalMethodCall(g, fn, Id(resourceInstance).Dot(recId).Dot(fn.Name))
 		}
 	} else {
-		injectOriginalMethodCall(g, fn, Qual(info.GetServicePath(), fn.Name))
+		injectOriginalMethodCall(g, fn, originalFunction(info, fn))
+	}
+	if err != nil {
+		info.failGenerate(err)
+		return
 	}
 	errGuard(g, AssignResultsToErr(Err(), "response", fn.Results))
+	//Receiver state is saved only after successful call
+	if save != nil {
+		save()
+	}
+}
+
+//makeReceiverInstance creates receiver instance using its constructor. Constructor
+//arguments are bound from receiverPath of request object, receivers that are not
+//top level are created recursively from nested request objects. Error is *CycleError
+//if constructors depend on each other.
+func makeReceiverInstance(
+	info *PackageInfo, constructor Constructor, g *Group,
+	deps DepsMap, errGuard IfErrorGuard,
+	resourceInstance, recId, receiverPath string, stack []string,
+) (err error) {
+	receiverType := constructor.Receiver.TypeName()
+	stack = append(stack, receiverType)
+	created := make(map[string]string)
+	for _, arg := range constructor.Function.Arguments {
+		depCons, isReceiver := info.GetConstructor(arg)
+		if !isReceiver || HasTopLevelReceiver(depCons.Function, info) {
+			continue
+		}
+		for _, t := range stack {
+			if t == depCons.Receiver.TypeName() {
+				return &CycleError{Receivers: append(stack, t)}
+			}
+		}
+		depPath := receiverPath + "." + strings.Title(arg.Name())
+		//Nested receiver may be omitted in request
+		if prefix, _, _ := arg.TypeParts(); strings.HasPrefix(prefix, "*") {
+			g.If(Id(depPath).Op("==").Nil()).Block(
+				Id(depPath).Op("=").New(Id(depCons.Receiver.TypeName())),
+			)
+		}
+		depId := ID("dep", recId, arg.Name())
+		if IsSession(depCons.Receiver, info) {
+			err = makeSessionInstance(info, depCons, g, deps, errGuard, resourceInstance, depId, depPath, stack)
+		} else {
+			err = makeReceiverInstance(info, depCons, g, deps, errGuard, resourceInstance, depId, depPath, stack)
+		}
+		if err != nil {
+			return err
+		}
+		created[arg.Name()] = depId
+	}
+
+	g.Id(recId).Op(":=").New(Qual(info.GetServicePath(), receiverType))
+	constructorCall := makeCallWithDeps(constructor, info, deps, resourceInstance, receiverPath, created)
+	errGuard(g, List(Id(recId), Err()).Op("=").
+		Qual(info.GetServicePath(), constructor.Function.Name).CallFunc(constructorCall),
+	)
+	return nil
+}
+
+//originalFunction returns package function, instance of generic function has type arguments.
+func originalFunction(info *PackageInfo, fn parser.Function) *Statement {
+	if fn.Generic == "" {
+		return Qual(info.GetServicePath(), fn.Name)
+	}
+	return Qual(info.GetServicePath(), fn.Generic).IndexFunc(func(g *Group) {
+		for _, arg := range fn.TypeArgs {
+			g.Add(createTypeFromField(arg, info))
+		}
+	})
 }
 
 //HandlerWrapper creates method wrapper to inject dependencies (top level receiver).
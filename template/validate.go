@@ -0,0 +1,322 @@
+package template
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/angrypie/tie/parser"
+	. "github.com/dave/jennifer/jen"
+)
+
+//ValidateDirective sets validation rules of function argument, rules of struct arguments
+//are set by validate tags of their fields: //tie:validate age min=0 max=150.
+const ValidateDirective = "validate"
+
+//Types of validation error in server packages: validationError lists invalid fields of
+//request, it is returned by handlers before original function is called.
+const (
+	FieldErrorType      = "fieldError"
+	ValidationErrorType = "validationError"
+)
+
+//ErrorBodyHelper returns JSON body of handler error, invalid fields of request are listed in fields.
+const ErrorBodyHelper = "errorBodyHelper"
+
+//ruleOrder is order of rules of directive (arguments of directive are not ordered).
+var ruleOrder = []string{"required", "omitempty", "min", "max", "len", "oneof"}
+
+func isRuleName(name string) bool {
+	for _, rule := range ruleOrder {
+		if rule == name {
+			return true
+		}
+	}
+	return false
+}
+
+//GetArgumentRules returns rules of function arguments by argument name from validate directives.
+func GetArgumentRules(fn parser.Function) (rules map[string][]parser.Rule, err error) {
+	args := make(map[string]parser.Field)
+	for _, arg := range fn.Arguments {
+		if isWireField(arg) {
+			args[arg.Name()] = arg
+		}
+	}
+	rules = make(map[string][]parser.Rule)
+	for _, directive := range fn.Directives {
+		if directive.Name != ValidateDirective {
+			continue
+		}
+		target := ""
+		var list []parser.Rule
+		for name, value := range directive.Args {
+			_, isArg := args[name]
+			switch {
+			case isArg && value == "" && !isRuleName(name):
+				if target != "" {
+					return nil, fmt.Errorf("//tie:validate must name one argument")
+				}
+				target = name
+			default:
+				list = append(list, parser.Rule{Name: name, Value: value})
+			}
+		}
+		if target == "" {
+			return nil, fmt.Errorf("//tie:validate must name argument transferred over the wire (e.g. //tie:validate age min=0)")
+		}
+		sort.Slice(list, func(i, j int) bool { return ruleIndex(list[i].Name) < ruleIndex(list[j].Name) })
+		if err = parser.CheckRules(list, args[target].Type); err != nil {
+			return nil, fmt.Errorf("%s: %w", target, err)
+		}
+		rules[target] = append(rules[target], list...)
+	}
+	return rules, nil
+}
+
+func ruleIndex(name string) int {
+	for i, rule := range ruleOrder {
+		if rule == name {
+			return i
+		}
+	}
+	return len(ruleOrder)
+}
+
+//checkFieldRules returns error if rules of struct fields can't be checked.
+func checkFieldRules(path string, fields []parser.ValidatedField) error {
+	for _, field := range fields {
+		name := path + "." + field.JSON
+		if err := parser.CheckRules(field.Rules, field.Type); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		if err := checkFieldRules(name, field.Fields); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//IsValidated returns true if arguments of function have validation rules.
+func IsValidated(fn parser.Function) bool {
+	rules, _ := GetArgumentRules(fn)
+	if len(rules) != 0 {
+		return true
+	}
+	for _, arg := range fn.Arguments {
+		if isWireField(arg) && len(arg.ValidatedFields()) != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+//UsesValidation returns true if arguments of any function have validation rules.
+func UsesValidation(info *PackageInfo) bool {
+	uses := false
+	ForEachFunction(info, true, func(fn parser.Function) {
+		uses = uses || IsValidated(fn)
+	})
+	return uses
+}
+
+//ValidateRequests returns error if validation rules are malformed or can't be checked.
+func ValidateRequests(info *PackageInfo) (err error) {
+	ForEachFunction(info, true, func(fn parser.Function) {
+		if err != nil {
+			return
+		}
+		if _, e := GetArgumentRules(fn); e != nil {
+			err = fmt.Errorf("%s: %w", functionName(fn), e)
+			return
+		}
+		for _, arg := range fn.Arguments {
+			if !isWireField(arg) {
+				continue
+			}
+			if e := checkFieldRules(JSONName(info, arg.Name()), arg.ValidatedFields()); e != nil {
+				err = fmt.Errorf("%s: %w", functionName(fn), e)
+				return
+			}
+		}
+	})
+	return
+}
+
+//makeValidationGuard checks rules of request arguments and returns validationError with all
+//invalid fields before original function is called.
+func makeValidationGuard(info *PackageInfo, fn parser.Function, g *Group, errGuard IfErrorGuard) {
+	if !IsValidated(fn) {
+		return
+	}
+	rules, _ := GetArgumentRules(fn)
+	fields := ID("fields")
+	g.Var().Id(fields).Id(ValidationErrorType)
+	for _, arg := range fn.Arguments {
+		if !isWireField(arg) {
+			continue
+		}
+		name := strings.Title(arg.Name())
+		value := func() *Statement { return Id("request").Dot(name) }
+		makeValueChecks(g, fields, value, JSONName(info, arg.Name()), arg.Type, rules[arg.Name()], arg.ValidatedFields())
+	}
+	errGuard(g, Err().Op("=").Id(fields).Dot("err").Call())
+}
+
+//makeValueChecks adds invalid field to fields if value breaks rules, nested fields of struct
+//are checked recursively (fields of nil pointer are not checked).
+func makeValueChecks(
+	g *Group, fields string, value func() *Statement, path string,
+	t parser.Type, rules []parser.Rule, nested []parser.ValidatedField,
+) {
+	invalid := func(g *Group, condition *Statement, message string) {
+		g.If(condition).Block(
+			Id(fields).Op("=").Append(Id(fields), Id(FieldErrorType).Values(Lit(path), Lit(message))),
+		)
+	}
+	checks := func(g *Group, value func() *Statement, t parser.Type) {
+		for _, rule := range rules {
+			if rule.Name == "required" || rule.Name == "omitempty" {
+				continue
+			}
+			condition, message := ruleCheck(rule, value, t.Kind())
+			invalid(g, condition, message)
+		}
+		for _, field := range nested {
+			field := field
+			fieldValue := func() *Statement { return value().Dot(field.Name) }
+			makeValueChecks(g, fields, fieldValue, path+"."+field.JSON, field.Type, field.Rules, field.Fields)
+		}
+	}
+	optional, required := false, false
+	for _, rule := range rules {
+		optional = optional || rule.Name == "omitempty"
+		required = required || rule.Name == "required"
+	}
+	if required {
+		invalid(g, zeroCheck(value, t.Kind()), "is required")
+	}
+	//Rules of pointer are checked for value it points to
+	if t.Kind() == parser.KindPointer {
+		elem := t.Elem()
+		g.If(value().Op("!=").Nil()).BlockFunc(func(g *Group) {
+			checks(g, func() *Statement { return Parens(Op("*").Add(value())) }, elem)
+		})
+		return
+	}
+	if optional {
+		g.If(Op("!").Parens(zeroCheck(value, t.Kind()))).BlockFunc(func(g *Group) {
+			checks(g, value, t)
+		})
+		return
+	}
+	checks(g, value, t)
+}
+
+//zeroCheck returns condition that is true if value is zero value of its kind.
+func zeroCheck(value func() *Statement, kind parser.Kind) *Statement {
+	switch kind {
+	case parser.KindString:
+		return value().Op("==").Lit("")
+	case parser.KindInt, parser.KindUint, parser.KindFloat:
+		return value().Op("==").Lit(0)
+	case parser.KindBool:
+		return Op("!").Add(value())
+	case parser.KindCollection:
+		return Len(value()).Op("==").Lit(0)
+	}
+	return value().Op("==").Nil()
+}
+
+//ruleCheck returns condition that is true if value breaks rule and message of invalid field.
+func ruleCheck(rule parser.Rule, value func() *Statement, kind parser.Kind) (condition *Statement, message string) {
+	length, unit := value(), ""
+	switch kind {
+	case parser.KindString:
+		length, unit = Qual("unicode/utf8", "RuneCountInString").Call(value()), "characters"
+	case parser.KindCollection:
+		length, unit = Len(value()), "items"
+	}
+	number := numberCode(rule.Value, kind)
+	switch rule.Name {
+	case "min":
+		if unit != "" {
+			return length.Op("<").Add(number), fmt.Sprintf("must have at least %s %s", rule.Value, unit)
+		}
+		return length.Op("<").Add(number), "must be at least " + rule.Value
+	case "max":
+		if unit != "" {
+			return length.Op(">").Add(number), fmt.Sprintf("must have at most %s %s", rule.Value, unit)
+		}
+		return length.Op(">").Add(number), "must be at most " + rule.Value
+	case "len":
+		return length.Op("!=").Add(number), fmt.Sprintf("must have exactly %s %s", rule.Value, unit)
+	}
+	//oneof
+	values := rule.OneOf()
+	condition = Null()
+	for i, allowed := range values {
+		if i != 0 {
+			condition.Op("&&")
+		}
+		if kind == parser.KindString {
+			condition.Add(value().Op("!=").Lit(allowed))
+		} else {
+			condition.Add(value().Op("!=").Add(numberCode(allowed, kind)))
+		}
+	}
+	return condition, "must be one of " + strings.Join(values, ", ")
+}
+
+//numberCode returns untyped constant of rule value (it is checked by parser.CheckRules).
+func numberCode(value string, kind parser.Kind) *Statement {
+	if kind == parser.KindFloat {
+		n, _ := strconv.ParseFloat(value, 64)
+		return Lit(n)
+	}
+	n, _ := strconv.ParseInt(value, 10, 64)
+	return Lit(int(n))
+}
+
+//AddValidationHelpers creates validation error types of server package.
+func AddValidationHelpers(info *PackageInfo, f *File) {
+	if !UsesValidation(info) {
+		return
+	}
+	f.Type().Id(FieldErrorType).Struct(
+		Id("Field").String().Tag(map[string]string{"json": "field"}),
+		Id("Message").String().Tag(map[string]string{"json": "message"}),
+	)
+	f.Type().Id(ValidationErrorType).Index().Id(FieldErrorType)
+	errorType := Id("e").Id(ValidationErrorType)
+	f.Func().Params(errorType).Id("Error").Params().String().Block(
+		Id("messages").Op(":=").Make(Index().String(), Len(Id("e"))),
+		For(List(Id("i"), Id("field")).Op(":=").Range().Id("e")).Block(
+			Id("messages").Index(Id("i")).Op("=").Id("field").Dot("Field").Op("+").Lit(" ").Op("+").Id("field").Dot("Message"),
+		),
+		Return(Lit("invalid request: ").Op("+").Qual("strings", "Join").Call(Id("messages"), Lit(", "))),
+	)
+	f.Comment("InvalidParams returns invalid fields (data of JSON-RPC error).")
+	f.Func().Params(errorType).Id("InvalidParams").Params().Interface().Block(
+		Return(Index().Id(FieldErrorType).Parens(Id("e"))),
+	)
+	f.Func().Params(errorType).Id("err").Params().Error().Block(
+		If(Len(Id("e")).Op("==").Lit(0)).Block(Return(Nil())),
+		Return(Id("e")),
+	)
+}
+
+//AddErrorBodyHelper creates errorBodyHelper of HTTP modules.
+func AddErrorBodyHelper(info *PackageInfo, f *File) {
+	f.Func().Id(ErrorBodyHelper).Params(Err().Error()).Map(String()).Interface().BlockFunc(func(g *Group) {
+		g.Id("body").Op(":=").Map(String()).Interface().Values(Dict{Lit("err"): Err().Dot("Error").Call()})
+		if UsesValidation(info) {
+			g.Var().Id("invalid").Id(ValidationErrorType)
+			g.If(Qual("errors", "As").Call(Err(), Op("&").Id("invalid"))).Block(
+				Id("body").Index(Lit("fields")).Op("=").Id("invalid"),
+			)
+		}
+		g.Return(Id("body"))
+	})
+}
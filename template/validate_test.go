@@ -0,0 +1,50 @@
+package template
+
+import (
+	"go/types"
+	"testing"
+
+	"github.com/angrypie/tie/parser"
+	tieTypes "github.com/angrypie/tie/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateRequests(t *testing.T) {
+	str, integer := types.Typ[types.String], types.Typ[types.Int]
+	human := types.NewStruct([]*types.Var{
+		types.NewField(0, nil, "Name", str, false),
+		types.NewField(0, nil, "Age", integer, false),
+	}, []string{`json:"name" validate:"required,max=32"`, `json:"age" validate:"min=0,max=150"`})
+	validate := parser.Directive{Name: ValidateDirective, Args: map[string]string{"role": "", "oneof": "admin|user"}}
+	fn := parser.Function{
+		Name: "Create",
+		Arguments: []parser.Field{
+			parser.NewField(types.NewVar(0, nil, "human", human)),
+			parser.NewField(types.NewVar(0, nil, "role", str)),
+		},
+		Directives: []parser.Directive{validate},
+	}
+	info := &PackageInfo{Service: &tieTypes.Service{Type: "http"}}
+	info.Functions = []parser.Function{fn}
+	require.NoError(t, ValidateRequests(info))
+	require.True(t, UsesValidation(info))
+
+	rules, err := GetArgumentRules(fn)
+	require.NoError(t, err)
+	require.Equal(t, map[string][]parser.Rule{"role": {{Name: "oneof", Value: "admin|user"}}}, rules)
+
+	schema := RequestSchema(fn, info)
+	properties := schema["properties"].(map[string]interface{})
+	require.Equal(t, []interface{}{"admin", "user"}, properties["role"].(parser.Schema)["enum"])
+	fields := properties["human"].(parser.Schema)["properties"].(map[string]interface{})
+	require.Equal(t, 150.0, fields["age"].(parser.Schema)["maximum"])
+	require.Equal(t, 1, fields["name"].(parser.Schema)["minLength"])
+
+	validate.Args["len"] = "x"
+	require.EqualError(t, ValidateRequests(info), `Create: role: len rule: invalid value "x"`)
+	delete(validate.Args, "len")
+
+	delete(validate.Args, "role")
+	require.EqualError(t, ValidateRequests(info),
+		"Create: //tie:validate must name argument transferred over the wire (e.g. //tie:validate age min=0)")
+}
@@ -6,6 +6,236 @@ type Service struct {
 	Type  string `yaml:"type"`
 	Port  string `yaml:"port"`
 	Auth  string `yaml:"auth"`
+	//Authentication configures authentication of HTTP modules (instead of Auth key).
+	Authentication *Authentication `yaml:"authentication"`
+	//TLS configures TLS of servers and clients of service.
+	TLS *TLS `yaml:"tls"`
+	//HTTP configures middleware of http module.
+	HTTP *HTTP `yaml:"http"`
+	//Limits configures rate and concurrency limits of functions.
+	Limits *Limits `yaml:"limits"`
+	//Client configures timeouts, retries and circuit breaker of generated clients.
+	Client *Client `yaml:"client"`
+	//Idempotency configures store of responses of functions called with idempotency key.
+	Idempotency *Idempotency `yaml:"idempotency"`
+	//JSON configures names of fields of generated request, response and receiver types.
+	JSON *JSON `yaml:"json"`
+	//Generics lists instances of generic functions exposed by service.
+	Generics []Generic `yaml:"generics"`
+	//Ports holds listen port of each transport by type (e.g. jsonrpc: 8081) when
+	//service has several transports, Port is used by first one.
+	Ports map[string]string `yaml:"ports"`
+	//Instances lists addresses of service replicas used by clients by default,
+	//requests of sharded receivers are routed by consistent hash of receiver key.
+	Instances []string `yaml:"instances"`
+	//Config holds default values of top level receiver constructor arguments
+	//by configuration key (e.g. provider.phrase).
+	Config map[string]interface{} `yaml:"config"`
+	//Required lists configuration keys that must have value at start.
+	Required []string `yaml:"required"`
+	//Sessions lists receivers that are kept on server side between calls.
+	Sessions []Session `yaml:"sessions"`
+	//State configures persistence of receivers state.
+	State *State `yaml:"state"`
+	//Shutdown configures deadlines of graceful shutdown.
+	Shutdown Shutdown `yaml:"shutdown"`
+}
+
+//Authentication configures how requests are authenticated, authenticated principal
+//is injected to handlers (principal argument).
+type Authentication struct {
+	//Type is authentication method: keys, jwt or basic.
+	Type string `yaml:"type"`
+	//Keys lists hashed API keys sent as bearer token (keys type).
+	Keys []APIKey `yaml:"keys"`
+	//File is path of JWKS or PEM file with token verification keys (jwt type)
+	//or htpasswd file (basic type).
+	File string `yaml:"file"`
+	//Issuer and Audience are required values of token claims (jwt type, optional).
+	Issuer   string `yaml:"issuer"`
+	Audience string `yaml:"audience"`
+	//Roles lists roles of principals (added to roles claim of token), roles are
+	//required by //tie:auth role=name directive.
+	Roles map[string][]string `yaml:"roles"`
+}
+
+//TLS holds paths of PEM files (TIE_TLS_CERT, TIE_TLS_KEY and TIE_TLS_CA environment
+//variables override them).
+type TLS struct {
+	//Cert and Key are certificate of service, clients of other services present it.
+	Cert string `yaml:"cert"`
+	Key  string `yaml:"key"`
+	//CA is certificate authority that verifies servers and client certificates.
+	CA string `yaml:"ca"`
+	//ClientAuth requires client certificate signed by CA (mutual TLS).
+	ClientAuth bool `yaml:"client_auth"`
+}
+
+//HTTP configures middleware of http module, middleware that is not configured is disabled
+//except CORS and gzip that have defaults.
+type HTTP struct {
+	//CORS configures cross-origin requests (default any origin).
+	CORS *CORS `yaml:"cors"`
+	//Gzip configures compression of responses (default level 4).
+	Gzip *Gzip `yaml:"gzip"`
+	//BodyLimit is maximum size of request body (e.g. 4M), larger requests are rejected with 413.
+	BodyLimit string `yaml:"body_limit"`
+	//Timeout is duration after which context of request is canceled (e.g. 10s), streams are not limited.
+	Timeout string `yaml:"timeout"`
+	//Recover responds with 500 instead of crashing process when handler panics.
+	Recover bool `yaml:"recover"`
+	//SecureHeaders adds XSS protection, nosniff, frame options and HSTS (with TLS) headers.
+	SecureHeaders bool `yaml:"secure_headers"`
+}
+
+//Limits configures rate limits (per client) and concurrency limits of functions served by
+//HTTP modules, default limit applies to each function separately.
+type Limits struct {
+	Limit `yaml:",inline"`
+	//Key identifies client of rate limit: ip (default), principal or header:Name.
+	Key string `yaml:"key"`
+	//Functions overrides limits by function name (Receiver.Method for methods).
+	Functions map[string]Limit `yaml:"functions"`
+}
+
+//Limit is rate and concurrency limit of function, zero values are inherited.
+type Limit struct {
+	//Rate is number of requests per second, minute or hour (e.g. 10/s, 100/m), 0 is not limited.
+	Rate string `yaml:"rate"`
+	//Burst is number of requests allowed at once (default is number of requests in rate).
+	Burst int `yaml:"burst"`
+	//Concurrency is maximum number of requests served at once (all clients).
+	Concurrency int `yaml:"concurrency"`
+}
+
+//Client configures calls of generated clients, default policy applies to each function.
+type Client struct {
+	ClientPolicy `yaml:",inline"`
+	//Breaker stops calls of service after consecutive failures.
+	Breaker *Breaker `yaml:"breaker"`
+	//Functions overrides policy by function name (Receiver.Method for methods).
+	Functions map[string]ClientPolicy `yaml:"functions"`
+	//Stream limits event streams read by http client.
+	Stream *Stream `yaml:"stream"`
+}
+
+//Stream limits event streams (Server-Sent Events) read by client.
+type Stream struct {
+	//MaxEventSize is maximum size of event in bytes (default 1MB), larger event ends stream.
+	MaxEventSize int `yaml:"max_event_size"`
+	//ConsumeTimeout is time client waits for consumer to receive event (default 1m), stream
+	//is closed if consumer stops reading.
+	ConsumeTimeout string `yaml:"consume_timeout"`
+}
+
+//ClientPolicy is policy of function calls, zero values are inherited.
+type ClientPolicy struct {
+	//Timeout limits each attempt of call (e.g. 5s).
+	Timeout string `yaml:"timeout"`
+	//Retries is number of retries of idempotent function after failure of transport (default 2).
+	Retries *int `yaml:"retries"`
+	//Backoff is delay before first retry (default 100ms), it is doubled for each retry
+	//up to MaxBackoff (default 5s).
+	Backoff    string `yaml:"backoff"`
+	MaxBackoff string `yaml:"max_backoff"`
+	//Idempotent allows retries of function (same as //tie:idempotent directive).
+	Idempotent bool `yaml:"idempotent"`
+}
+
+//Breaker opens circuit after consecutive failures, calls fail without request until
+//cooldown is over, then one probe call closes circuit if it succeeds.
+type Breaker struct {
+	//Failures is number of consecutive failures that opens circuit (default 5).
+	Failures int `yaml:"failures"`
+	//Cooldown is time circuit is open (default 10s).
+	Cooldown string `yaml:"cooldown"`
+}
+
+//CORS configures Access-Control headers, origins may contain wildcard (https://*.example.com).
+type CORS struct {
+	Disable     bool     `yaml:"disable"`
+	Origins     []string `yaml:"origins"`
+	Methods     []string `yaml:"methods"`
+	Headers     []string `yaml:"headers"`
+	Credentials bool     `yaml:"credentials"`
+	//MaxAge is time in seconds preflight response is cached.
+	MaxAge int `yaml:"max_age"`
+}
+
+//Gzip configures compression of responses.
+type Gzip struct {
+	Disable bool `yaml:"disable"`
+	//Level is compression level from 1 (fastest) to 9 (best).
+	Level int `yaml:"level"`
+	//MinSize is minimum size of response in bytes that is compressed.
+	MinSize int `yaml:"min_size"`
+}
+
+//APIKey is hex encoded SHA-256 hash of API key, key of principal can be rotated
+//by adding new key before old one is removed.
+type APIKey struct {
+	Principal string `yaml:"principal"`
+	Hash      string `yaml:"hash"`
+}
+
+//Shutdown configures deadlines of graceful shutdown (durations, e.g. 30s).
+type Shutdown struct {
+	//Timeout limits whole shutdown (default 30s).
+	Timeout string `yaml:"timeout"`
+	//HookTimeout limits each Stop call (default 10s).
+	HookTimeout string `yaml:"hook_timeout"`
+}
+
+//Idempotency configures functions that replay first response for duplicate requests
+//with the same Idempotency-Key header.
+type Idempotency struct {
+	//TTL is time response is kept for key (default 24h).
+	TTL string `yaml:"ttl"`
+	//Store is idempotency store type: memory or state (default memory), state keeps
+	//responses in state store of service.
+	Store string `yaml:"store"`
+	//Path is passed to store constructor.
+	Path string `yaml:"path"`
+	//Functions lists functions that accept idempotency key (Receiver.Method for methods),
+	//same as //tie:idempotent key directive.
+	Functions []string `yaml:"functions"`
+}
+
+//JSON configures encoding of generated types, user types are encoded by their own json tags.
+type JSON struct {
+	//Naming is naming strategy of fields: lower (default, firstName is firstname),
+	//camel (firstName), snake (first_name) or as-is (name of argument).
+	Naming string `yaml:"naming"`
+}
+
+//Generic is instance of generic function, it is exposed as function with Name.
+type Generic struct {
+	//Function is name of generic function.
+	Function string `yaml:"function"`
+	//Name is name of instance (default is name of function).
+	Name string `yaml:"name"`
+	//Types are type arguments (e.g. [int] or [Human]), they are evaluated in file of function.
+	Types []string `yaml:"types"`
+}
+
+//State configures store that keeps exported fields of receivers between restarts.
+type State struct {
+	//Store is state store type: memory, file or dapr (default memory).
+	Store string `yaml:"store"`
+	//Path is directory of file store or name of dapr state store.
+	Path string `yaml:"path"`
+	//Receivers lists top level and session receivers which state is persisted.
+	Receivers []string `yaml:"receivers"`
+}
+
+//Session configures receiver that is created once and referenced by session handle.
+type Session struct {
+	//Receiver is receiver type name (e.g. User).
+	Receiver string `yaml:"receiver"`
+	//TTL is idle time after which session expires (default 30m).
+	TTL string `yaml:"ttl"`
+	//Max is maximum number of sessions, least recently used is evicted (default 10000).
+	Max int `yaml:"max"`
 }
 
 type ConfigFile struct {
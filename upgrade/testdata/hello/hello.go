@@ -0,0 +1,103 @@
+//Package hello is service upgraded by tests of generated modules.
+package hello
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+//Human is created by CreateHuman.
+type Human struct {
+	Name string
+	Age  int
+}
+
+//CreateHuman returns new human.
+func CreateHuman(name string, age int) (human *Human, err error) {
+	return &Human{Name: name, Age: age}, nil
+}
+
+//Sum returns sum of two numbers.
+func Sum(a, b int) (result int, err error) {
+	return a + b, nil
+}
+
+//Ping is available without credentials.
+//
+//tie:public
+func Ping() (ok bool, err error) {
+	return true, nil
+}
+
+//User greets by name.
+type User struct {
+	name string
+}
+
+var users int32
+
+//NewUser creates user, it takes time so concurrent restores of session would overlap.
+func NewUser(name string) (user *User, err error) {
+	atomic.AddInt32(&users, 1)
+	time.Sleep(50 * time.Millisecond)
+	return &User{name: name}, nil
+}
+
+//Users returns number of users created since start.
+func Users() (created int, err error) {
+	return int(atomic.LoadInt32(&users)), nil
+}
+
+//Hello returns greeting of user.
+func (u *User) Hello(greeting string) (message string, err error) {
+	return fmt.Sprintf("%s, %s", greeting, u.name), nil
+}
+
+//Numbers streams numbers from 0 to n.
+func Numbers(n int) (numbers <-chan int, err error) {
+	ch := make(chan int, n)
+	for i := 0; i < n; i++ {
+		ch <- i
+	}
+	close(ch)
+	return ch, nil
+}
+
+//Msg is message of chat.
+type Msg struct {
+	Text string
+}
+
+//Reply is reply to chat message.
+type Reply struct {
+	Text string
+}
+
+//Chat replies to each message with prefix.
+func Chat(ctx context.Context, prefix string, in <-chan Msg) (out <-chan Reply, err error) {
+	ch := make(chan Reply)
+	go func() {
+		defer close(ch)
+		for msg := range in {
+			select {
+			case ch <- Reply{Text: prefix + msg.Text}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return ch, nil
+}
+
+//Tally counts added numbers, its state is kept if it is persisted.
+type Tally struct {
+	Total int
+}
+
+//Add adds n to total.
+func (t *Tally) Add(n int) (total int, err error) {
+	t.Total += n
+	return t.Total, nil
+}
@@ -0,0 +1,3 @@
+module github.com/angrypie/rndport
+
+go 1.16
@@ -0,0 +1,17 @@
+//Package rndport replaces github.com/angrypie/rndport in generated test services.
+package rndport
+
+import (
+	"fmt"
+	"net"
+)
+
+//GetAddress formats address with free port (e.g. ":%d").
+func GetAddress(format string) (string, error) {
+	l, err := net.Listen("tcp", ":0")
+	if err != nil {
+		return "", err
+	}
+	defer l.Close()
+	return fmt.Sprintf(format, l.Addr().(*net.TCPAddr).Port), nil
+}
@@ -1,6 +1,645 @@
 package upgrade
 
-import "testing"
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/angrypie/tie/types"
+	"github.com/stretchr/testify/require"
+)
+
+//transportModules are modules of transports that are not required by testdata, they are fetched by test.
+var transportModules = map[string]string{
+	"dapr":  "github.com/dapr/go-sdk@v1.11.0",
+	"micro": "github.com/micro/go-micro/v2@v2.9.1",
+}
 
 func TestUpgrader(t *testing.T) {
+	for _, transport := range []string{"http", "stdhttp", "jsonrpc", "mcp", "ws", "dapr", "micro"} {
+		transport := transport
+		t.Run(transport, func(t *testing.T) {
+			t.Parallel()
+			//Service with authentication checks access of each call
+			dirs := []string{
+				generate(t, types.Service{Type: transport}),
+				generateWith(t, types.Service{Type: transport, Authentication: &types.Authentication{
+					Type: "keys", Roles: map[string][]string{"alice": {"admin"}},
+				}}, map[string]string{"admin.go": adminFile}),
+			}
+			for _, dir := range dirs {
+				if module, ok := transportModules[transport]; ok {
+					cmd := exec.Command("go", "get", module)
+					cmd.Dir = dir
+					cmd.Env = append(os.Environ(), "GOWORK=off")
+					if out, err := cmd.CombinedOutput(); err != nil {
+						t.Skipf("%s module is not compiled: %s can't be fetched (no network or module cache): %s",
+							transport, module, out)
+					}
+				}
+				goCommand(t, dir, "vet", "./...")
+			}
+		})
+	}
+}
+
+func TestAuthenticationOfJSONRPC(t *testing.T) {
+	dir := generateWith(t, types.Service{Type: "jsonrpc", Authentication: &types.Authentication{
+		Type: "keys",
+		Keys: []types.APIKey{
+			{Principal: "alice", Hash: keyHash("alice-key")},
+			{Principal: "bob", Hash: keyHash("bob-key")},
+		},
+		Roles: map[string][]string{"alice": {"admin"}},
+	}}, map[string]string{"admin.go": adminFile})
+	ports := start(t, dir, "jsonrpc")
+
+	call := func(method, params, key string) (result, message string) {
+		body := fmt.Sprintf(`{"jsonrpc":"2.0","id":1,"method":%q,"params":%s}`, method, params)
+		req, err := http.NewRequest("POST", "http://localhost:"+ports["jsonrpc"], strings.NewReader(body))
+		require.NoError(t, err)
+		if key != "" {
+			req.Header.Set("Authorization", "Bearer "+key)
+		}
+		res, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		var response struct {
+			Result json.RawMessage
+			Error  *struct{ Message string }
+		}
+		require.NoError(t, json.NewDecoder(res.Body).Decode(&response))
+		if response.Error != nil {
+			return "", response.Error.Message
+		}
+		return string(response.Result), ""
+	}
+
+	_, message := call("Sum", `{"a":1,"b":2}`, "")
+	require.Equal(t, "forbidden: Sum requires authentication", message)
+	_, message = call("User.Hello", `{"name":"Ann","greeting":"Hi"}`, "")
+	require.Equal(t, "forbidden: User.Hello requires authentication", message)
+	_, message = call("Sum", `{"a":1,"b":2}`, "carol-key")
+	require.Equal(t, "unauthorized", message)
+	result, message := call("Sum", `{"a":1,"b":2}`, "bob-key")
+	require.Equal(t, "", message)
+	require.JSONEq(t, `{"result":3}`, result)
+
+	_, message = call("Reset", `{}`, "bob-key")
+	require.Equal(t, "forbidden: Reset requires role admin", message)
+	result, message = call("Reset", `{}`, "alice-key")
+	require.Equal(t, "", message)
+	require.JSONEq(t, `{"ok":true}`, result)
+	result, message = call("Ping", `{}`, "")
+	require.Equal(t, "", message)
+	require.JSONEq(t, `{"ok":true}`, result)
+}
+
+func TestChannelArguments(t *testing.T) {
+	dir := generate(t, types.Service{Type: "stdhttp"})
+	ports := start(t, dir, "stdhttp")
+	address := "http://localhost:" + ports["stdhttp"]
+	client := &http.Client{Timeout: 5 * time.Second}
+
+	res, err := client.Get(address + "/numbers?n=2")
+	require.NoError(t, err)
+	data, err := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	require.NoError(t, err)
+	require.Equal(t, "data: 0\n\ndata: 1\n\n", string(data))
+
+	//Chat takes input stream, it is served only by ws
+	res, err = client.Get(address + "/chat?prefix=re")
+	require.NoError(t, err)
+	res.Body.Close()
+	require.Equal(t, http.StatusNotFound, res.StatusCode)
+}
+
+func TestRequestsOfStdhttp(t *testing.T) {
+	dir := generate(t, types.Service{Type: "stdhttp"})
+	address := "http://localhost:" + start(t, dir, "stdhttp")["stdhttp"]
+
+	//Query value of string field is not decoded as JSON
+	res, response := call(t, "GET", address+"/create_human?name=123&age=30", "")
+	requireResponse(t, res, response, http.StatusOK, nil)
+	require.Equal(t, map[string]interface{}{"Name": "123", "Age": float64(30)}, response["human"])
+
+	//Any method is routed like in echo
+	res, response = call(t, "PUT", address+"/sum", `{"a":1,"b":2}`)
+	requireResponse(t, res, response, http.StatusOK, nil)
+	require.Equal(t, float64(3), response["result"])
+	res, response = call(t, "DELETE", address+"/sum?a=2&b=2", "")
+	requireResponse(t, res, response, http.StatusOK, nil)
+	require.Equal(t, float64(4), response["result"])
+
+	//Event stream is compressed
+	req, err := http.NewRequest("GET", address+"/numbers?n=2", nil)
+	require.NoError(t, err)
+	req.Header.Set("Accept-Encoding", "gzip")
+	res, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer res.Body.Close()
+	require.Equal(t, "gzip", res.Header.Get("Content-Encoding"))
+	reader, err := gzip.NewReader(res.Body)
+	require.NoError(t, err)
+	data, err := ioutil.ReadAll(reader)
+	require.NoError(t, err)
+	require.Equal(t, "data: 0\n\ndata: 1\n\n", string(data))
+}
+
+func TestStateOfConcurrentCalls(t *testing.T) {
+	stateDir := t.TempDir()
+	dir := generate(t, types.Service{Type: "stdhttp", State: &types.State{
+		Store: "file", Path: stateDir, Receivers: []string{"Tally"},
+	}})
+	var flags []string
+	if goCommand(t, dir, "env", "CGO_ENABLED") == "1\n" {
+		flags = append(flags, "-race")
+	}
+	ports, output := startBuilt(t, dir, flags, "stdhttp")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res, err := http.Post("http://localhost:"+ports["stdhttp"]+"/tally/add", "application/json",
+				strings.NewReader(`{"n":1}`))
+			require.NoError(t, err)
+			res.Body.Close()
+			require.Equal(t, http.StatusOK, res.StatusCode)
+		}()
+	}
+	wg.Wait()
+
+	//State of the last call is saved
+	data, err := ioutil.ReadFile(filepath.Join(stateDir, "receiver%2FTally.json"))
+	require.NoError(t, err)
+	require.JSONEq(t, `{"Total":50}`, string(data))
+	require.NotContains(t, output.String(), "DATA RACE")
+}
+
+func TestSessions(t *testing.T) {
+	service := types.Service{
+		Type:     "stdhttp",
+		Sessions: []types.Session{{Receiver: "User", Max: 2}},
+		State:    &types.State{Store: "file", Path: t.TempDir(), Receivers: []string{"User"}},
+	}
+	dir := generate(t, service)
+	call := func(port, route, body string) (status int, response map[string]interface{}) {
+		res, err := http.Post("http://localhost:"+port+route, "application/json", strings.NewReader(body))
+		require.NoError(t, err)
+		defer res.Body.Close()
+		require.NoError(t, json.NewDecoder(res.Body).Decode(&response))
+		return res.StatusCode, response
+	}
+	//Client sends constructor arguments with session handle
+	hello := func(port, name, session string) (status int, response map[string]interface{}) {
+		return call(port, "/user/hello", fmt.Sprintf(`{"greeting":"Hi","u":{"name":%q,"tie_session":%q}}`, name, session))
+	}
+
+	port := start(t, dir, "stdhttp")["stdhttp"]
+	var sessions []string
+	for _, name := range []string{"a", "b", "c"} {
+		_, response := call(port, "/user/open_session", fmt.Sprintf(`{"u":{"name":%q}}`, name))
+		sessions = append(sessions, response["session"].(string))
+	}
+	for i, name := range []string{"b", "c"} {
+		status, _ := hello(port, name, sessions[i+1])
+		require.Equal(t, http.StatusOK, status)
+	}
+	//Least recently used session is evicted when limit is reached
+	status, response := hello(port, "a", sessions[0])
+	require.Equal(t, http.StatusBadRequest, status)
+	require.Equal(t, "User session not found or expired", response["err"])
+
+	//Persisted session is restored once by concurrent calls after restart
+	port = start(t, dir, "stdhttp")["stdhttp"]
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			status, response := hello(port, "c", sessions[2])
+			require.Equal(t, http.StatusOK, status)
+			require.Equal(t, "Hi, c", response["message"])
+		}()
+	}
+	wg.Wait()
+	_, response = call(port, "/users", `{}`)
+	require.Equal(t, float64(1), response["created"])
+}
+
+func TestAuthentication(t *testing.T) {
+	dir := generate(t, types.Service{Type: "http stdhttp", Authentication: &types.Authentication{
+		Type: "keys", Keys: []types.APIKey{{Principal: "bob", Hash: keyHash("bob-key")}},
+	}})
+	ports := start(t, dir, "http", "stdhttp")
+
+	for _, transport := range []string{"http", "stdhttp"} {
+		sum := "http://localhost:" + ports[transport] + "/sum"
+		res, response := call(t, "POST", sum, `{"a":1,"b":2}`)
+		requireResponse(t, res, response, http.StatusBadRequest, "missing key in request header")
+		res, response = call(t, "POST", sum, `{"a":1,"b":2}`, "Authorization", "Bearer carol-key")
+		requireResponse(t, res, response, http.StatusUnauthorized, "Unauthorized")
+		res, response = call(t, "POST", sum, `{"a":1,"b":2}`, "Authorization", "Bearer bob-key")
+		requireResponse(t, res, response, http.StatusOK, nil)
+		require.Equal(t, float64(3), response["result"])
+	}
+}
+
+//adminFile adds function that requires role.
+const adminFile = `package hello
+
+//Reset removes all humans.
+//
+//tie:auth role=admin
+func Reset() (ok bool, err error) {
+	return true, nil
+}
+`
+
+func TestAuthorization(t *testing.T) {
+	dir := generateWith(t, types.Service{Type: "http stdhttp", Authentication: &types.Authentication{
+		Type: "keys",
+		Keys: []types.APIKey{
+			{Principal: "alice", Hash: keyHash("alice-key")},
+			{Principal: "bob", Hash: keyHash("bob-key")},
+		},
+		Roles: map[string][]string{"alice": {"admin"}},
+	}}, map[string]string{"admin.go": adminFile})
+	ports := start(t, dir, "http", "stdhttp")
+
+	for _, transport := range []string{"http", "stdhttp"} {
+		address := "http://localhost:" + ports[transport]
+		res, response := call(t, "POST", address+"/reset", `{}`, "Authorization", "Bearer bob-key")
+		requireResponse(t, res, response, http.StatusForbidden, "Forbidden")
+		res, response = call(t, "POST", address+"/reset", `{}`, "Authorization", "Bearer alice-key")
+		requireResponse(t, res, response, http.StatusOK, nil)
+		require.Equal(t, true, response["ok"])
+		//Public function doesn't require credentials
+		res, response = call(t, "POST", address+"/ping", `{}`)
+		requireResponse(t, res, response, http.StatusOK, nil)
+	}
+}
+
+func TestLimits(t *testing.T) {
+	dir := generate(t, types.Service{Type: "http stdhttp", Limits: &types.Limits{
+		Key:       "header:X-Client",
+		Functions: map[string]types.Limit{"Sum": {Rate: "2/m"}},
+	}})
+	ports := start(t, dir, "http", "stdhttp")
+
+	for _, transport := range []string{"http", "stdhttp"} {
+		sum := "http://localhost:" + ports[transport] + "/sum"
+		for i := 0; i < 2; i++ {
+			res, response := call(t, "POST", sum, `{"a":1,"b":2}`, "X-Client", transport)
+			requireResponse(t, res, response, http.StatusOK, nil)
+		}
+		res, response := call(t, "POST", sum, `{"a":1,"b":2}`, "X-Client", transport)
+		requireResponse(t, res, response, http.StatusTooManyRequests, "Too Many Requests")
+		require.NotEmpty(t, res.Header.Get("Retry-After"))
+		//Other client has its own limit
+		res, response = call(t, "POST", sum, `{"a":1,"b":2}`, "X-Client", "other-"+transport)
+		requireResponse(t, res, response, http.StatusOK, nil)
+	}
+}
+
+func TestIdempotency(t *testing.T) {
+	dir := generate(t, types.Service{Type: "http stdhttp", Idempotency: &types.Idempotency{
+		Functions: []string{"CreateHuman"},
+	}})
+	ports := start(t, dir, "http", "stdhttp")
+
+	for _, transport := range []string{"http", "stdhttp"} {
+		route := "http://localhost:" + ports[transport] + "/create_human"
+		res, first := call(t, "POST", route, `{"name":"Ann","age":30}`, "Idempotency-Key", transport)
+		requireResponse(t, res, first, http.StatusOK, nil)
+		res, response := call(t, "POST", route, `{"name":"Ann","age":30}`, "Idempotency-Key", transport)
+		requireResponse(t, res, response, http.StatusOK, nil)
+		require.Equal(t, "true", res.Header.Get("Idempotent-Replayed"))
+		require.Equal(t, first, response)
+		res, response = call(t, "POST", route, `{"name":"Bob","age":30}`, "Idempotency-Key", transport)
+		requireResponse(t, res, response, http.StatusUnprocessableEntity,
+			"Idempotency-Key is used by request with different body")
+	}
+}
+
+func TestErrorsOfEcho(t *testing.T) {
+	dir := generate(t, types.Service{Type: "http", HTTP: &types.HTTP{BodyLimit: "1K"}})
+	address := "http://localhost:" + start(t, dir, "http")["http"]
+
+	res, response := call(t, "GET", address+"/unknown", "")
+	requireResponse(t, res, response, http.StatusNotFound, "Not Found")
+	res, response = call(t, "POST", address+"/create_human", `{"name":"`+strings.Repeat("a", 2048)+`"}`)
+	requireResponse(t, res, response, http.StatusRequestEntityTooLarge, "Request Entity Too Large")
+}
+
+func TestMiddlewareOfStdhttp(t *testing.T) {
+	dir := generate(t, types.Service{Type: "stdhttp", HTTP: &types.HTTP{
+		CORS:          &types.CORS{Origins: []string{"https://*.example.com"}, Credentials: true},
+		Gzip:          &types.Gzip{MinSize: 1024},
+		BodyLimit:     "1K",
+		Timeout:       "10s",
+		Recover:       true,
+		SecureHeaders: true,
+	}})
+	address := "http://localhost:" + start(t, dir, "stdhttp")["stdhttp"]
+
+	res, response := call(t, "POST", address+"/create_human", `{"name":"`+strings.Repeat("a", 2048)+`"}`)
+	requireResponse(t, res, response, http.StatusRequestEntityTooLarge, "Request Entity Too Large")
+
+	//Response smaller than min size is not compressed
+	res, response = call(t, "GET", address+"/sum?a=1&b=2", "", "Origin", "https://app.example.com")
+	requireResponse(t, res, response, http.StatusOK, nil)
+	require.False(t, res.Uncompressed)
+	require.Equal(t, "SAMEORIGIN", res.Header.Get("X-Frame-Options"))
+	require.Equal(t, "https://app.example.com", res.Header.Get("Access-Control-Allow-Origin"))
+	require.Equal(t, "true", res.Header.Get("Access-Control-Allow-Credentials"))
+
+	res, response = call(t, "GET", address+"/sum?a=1&b=2", "", "Origin", "https://example.org")
+	requireResponse(t, res, response, http.StatusOK, nil)
+	require.Equal(t, "", res.Header.Get("Access-Control-Allow-Origin"))
+}
+
+func TestBodyLimitOfJSONRPC(t *testing.T) {
+	dir := generate(t, types.Service{Type: "jsonrpc", HTTP: &types.HTTP{BodyLimit: "1K"}})
+	address := "http://localhost:" + start(t, dir, "jsonrpc")["jsonrpc"]
+
+	body := `{"jsonrpc":"2.0","id":1,"method":"CreateHuman","params":{"name":"` + strings.Repeat("a", 2048) + `"}}`
+	res, err := http.Post(address, "application/json", strings.NewReader(body))
+	require.NoError(t, err)
+	defer res.Body.Close()
+	var response struct{ Error struct{ Code int } }
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&response))
+	require.Equal(t, http.StatusRequestEntityTooLarge, res.StatusCode)
+	require.Equal(t, -32600, response.Error.Code)
+}
+
+//streamClient reads stream with generated client until it stops receiving events.
+const streamClient = `package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	client "example.com/hello/tie_modules/httpmod/client"
+)
+
+func main() {
+	os.Setenv("TIE_HELLO_ADDRESS", os.Args[1])
+	done := make(chan struct{})
+	client.OnStreamError = func(route string, err error) {
+		fmt.Println(route, err)
+		close(done)
+	}
+	numbers, _ := client.Numbers(20)
+	for n := range numbers {
+		fmt.Println(n)
+		if n == 2 {
+			break
+		}
+	}
+	<-done
+
+	done = make(chan struct{})
+	numbers, _ = client.Numbers(20)
+	count := 0
+	for range numbers {
+		count++
+	}
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+	}
+	fmt.Println(count)
+}
+`
+
+func TestStreamClient(t *testing.T) {
+	dir := generate(t, types.Service{Type: "http", Client: &types.Client{
+		Stream: &types.Stream{MaxEventSize: 8, ConsumeTimeout: "200ms"},
+	}})
+	ports := start(t, dir, "http")
+
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "streamclient"), 0755))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "streamclient", "main.go"), []byte(streamClient), 0644))
+	out := goCommand(t, dir, "run", "./streamclient", "http://localhost:"+ports["http"])
+	//Consumer stops after third event, event "data: 10" is larger than 8 bytes
+	require.Equal(t, "0\n1\n2\n/numbers consumer stopped receiving events\n"+
+		"/numbers event is larger than 8 bytes\n10\n", out)
+}
+
+//wsClient sends message that can't be decoded after valid one and prints close frame.
+const wsClient = `package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/gorilla/websocket"
+)
+
+func main() {
+	conn, _, err := websocket.DefaultDialer.Dial(os.Args[1]+"/chat", nil)
+	if err != nil {
+		panic(err)
+	}
+	defer conn.Close()
+	conn.WriteJSON(map[string]string{"prefix": "re"})
+	conn.WriteJSON(map[string]string{"text": "a"})
+	var reply struct{ Text string }
+	conn.ReadJSON(&reply)
+	fmt.Println(reply.Text)
+	conn.WriteMessage(websocket.TextMessage, []byte("{"))
+	_, _, err = conn.ReadMessage()
+	if closeErr, ok := err.(*websocket.CloseError); ok {
+		fmt.Println(closeErr.Code, closeErr.Text)
+	}
+}
+`
+
+func TestInputOfWS(t *testing.T) {
+	dir := generate(t, types.Service{Type: "ws"})
+	ports := start(t, dir, "ws")
+
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "wsclient"), 0755))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "wsclient", "main.go"), []byte(wsClient), 0644))
+	out := goCommand(t, dir, "run", "./wsclient", "ws://localhost:"+ports["ws"])
+	require.Equal(t, "rea\n1003 unexpected end of JSON input\n", out)
+}
+
+//generate copies service from testdata to temporary directory and upgrades it,
+//generated code is compiled by go command.
+func generate(t *testing.T, service types.Service) (dir string) {
+	t.Helper()
+	return generateWith(t, service, nil)
+}
+
+//generateWith is generate with additional files of service package (by name).
+func generateWith(t *testing.T, service types.Service, files map[string]string) (dir string) {
+	t.Helper()
+	if testing.Short() {
+		t.Skip("generated modules are not compiled in short mode")
+	}
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go command is not found")
+	}
+	root := t.TempDir()
+	copyDir(t, "testdata", root)
+	service.Name = filepath.Join(root, "hello")
+	for name, content := range files {
+		require.NoError(t, ioutil.WriteFile(filepath.Join(service.Name, name), []byte(content), 0644))
+	}
+	require.NoError(t, NewUpgrader(service).Upgrade(nil))
+	return service.Name
+}
+
+//goCommand runs go command in directory and returns its output.
+func goCommand(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("go", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GOFLAGS=-mod=mod", "GOWORK=off")
+	out, err := cmd.CombinedOutput()
+	require.NoError(t, err, string(out))
+	return string(out)
+}
+
+//copyDir copies files of directory recursively.
+func copyDir(t *testing.T, from, to string) {
+	t.Helper()
+	err := filepath.Walk(from, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(from, path)
+		if info.IsDir() {
+			return os.MkdirAll(filepath.Join(to, rel), 0755)
+		}
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		return ioutil.WriteFile(filepath.Join(to, rel), data, 0644)
+	})
+	require.NoError(t, err)
+}
+
+//start builds generated service and runs it until test is finished, it returns ports of
+//transports when service is ready.
+func start(t *testing.T, dir string, transports ...string) (ports map[string]string) {
+	t.Helper()
+	ports, _ = startBuilt(t, dir, nil, transports...)
+	return ports
+}
+
+//startBuilt is start with build flags, it also returns output of service.
+func startBuilt(t *testing.T, dir string, flags []string, transports ...string) (ports map[string]string, output *syncBuffer) {
+	t.Helper()
+	bin := filepath.Join(dir, "service")
+	goCommand(t, dir, append(append([]string{"build", "-o", bin}, flags...), "./tie_modules")...)
+
+	ports = make(map[string]string)
+	cmd := exec.Command(bin)
+	cmd.Env = os.Environ()
+	for _, transport := range transports {
+		ports[transport] = freePort(t)
+		cmd.Env = append(cmd.Env, "PORT_"+strings.ToUpper(transport)+"="+ports[transport])
+	}
+	output = new(syncBuffer)
+	cmd.Stdout, cmd.Stderr = output, output
+	require.NoError(t, cmd.Start())
+	t.Cleanup(func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+		if t.Failed() {
+			t.Log(output.String())
+		}
+	})
+
+	ready := "http://localhost:" + ports[transports[0]] + "/readyz"
+	require.Eventually(t, func() bool {
+		res, err := http.Get(ready)
+		if err != nil {
+			return false
+		}
+		res.Body.Close()
+		return res.StatusCode == http.StatusOK
+	}, 10*time.Second, 50*time.Millisecond, "service is not ready")
+	//Service is ready only when servers of all transports listen
+	for transport, port := range ports {
+		conn, err := net.Dial("tcp", "localhost:"+port)
+		require.NoError(t, err, transport+" does not listen")
+		conn.Close()
+	}
+	return ports, output
+}
+
+//keyHash returns hash of API key in authentication configuration.
+func keyHash(key string) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(key)))
+}
+
+//call sends request with headers (name and value pairs) and decodes JSON response.
+func call(t *testing.T, method, url, body string, headers ...string) (res *http.Response, response map[string]interface{}) {
+	t.Helper()
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+	for i := 0; i < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	res, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer res.Body.Close()
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&response))
+	return res, response
+}
+
+//requireResponse checks status and error of response (nil if response has no error).
+func requireResponse(t *testing.T, res *http.Response, response map[string]interface{}, status int, err interface{}) {
+	t.Helper()
+	require.Equal(t, status, res.StatusCode, res.Request.URL.String())
+	require.Equal(t, err, response["err"], res.Request.URL.String())
+}
+
+//freePort returns port that is not used.
+func freePort(t *testing.T) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "localhost:0")
+	require.NoError(t, err)
+	defer l.Close()
+	return fmt.Sprint(l.Addr().(*net.TCPAddr).Port)
+}
+
+//syncBuffer is output of process that can be read while process is running.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
 }
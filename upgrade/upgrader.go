@@ -8,7 +8,11 @@ import (
 
 	"github.com/angrypie/tie/modules/dapr"
 	httpmod "github.com/angrypie/tie/modules/http"
+	"github.com/angrypie/tie/modules/jsonrpc"
+	"github.com/angrypie/tie/modules/mcp"
 	"github.com/angrypie/tie/modules/micro"
+	"github.com/angrypie/tie/modules/stdhttp"
+	wsmod "github.com/angrypie/tie/modules/ws"
 	"github.com/angrypie/tie/parser"
 	"github.com/angrypie/tie/template"
 	"github.com/angrypie/tie/template/modutils"
@@ -63,7 +67,61 @@ func (upgrader *Upgrader) GenerateModules(services []string) (err error) {
 	p := upgrader.Parser
 	servicePath := p.Package.Path
 
-	types := strings.Split(upgrader.Parser.Service.Type, " ")
+	if err = p.ValidateGenerics(); err != nil {
+		return err
+	}
+	//Receivers can't be wired if their constructors depend on each other
+	info := template.NewPackageInfoFromParser(p)
+	if _, err = template.NewDepsGraph(info).Order(); err != nil {
+		return err
+	}
+	if err = template.ValidateConfig(info); err != nil {
+		return err
+	}
+	if err = template.ValidateSessions(info); err != nil {
+		return err
+	}
+	if err = template.ValidateState(info); err != nil {
+		return err
+	}
+	if err = template.ValidateShards(info); err != nil {
+		return err
+	}
+	if err = template.ValidateShutdown(info); err != nil {
+		return err
+	}
+	if err = template.ValidateTransports(info); err != nil {
+		return err
+	}
+	if err = template.ValidateAuth(info); err != nil {
+		return err
+	}
+	if err = template.ValidateAccess(info); err != nil {
+		return err
+	}
+	if err = template.ValidateLimits(info); err != nil {
+		return err
+	}
+	if err = template.ValidateClientPolicy(info); err != nil {
+		return err
+	}
+	if err = template.ValidateIdempotency(info); err != nil {
+		return err
+	}
+	if err = template.ValidateSignatures(info); err != nil {
+		return err
+	}
+	if err = template.ValidateNaming(info); err != nil {
+		return err
+	}
+	if err = template.ValidateRequests(info); err != nil {
+		return err
+	}
+	if err = template.ValidateTLS(info); err != nil {
+		return err
+	}
+
+	types := template.Transports(upgrader.Parser.Service)
 
 	var modules []template.Module
 
@@ -75,6 +133,14 @@ func (upgrader *Upgrader) GenerateModules(services []string) (err error) {
 			modules = append(modules, micro.NewModule(p, services))
 		case "dapr":
 			modules = append(modules, dapr.NewModule(p, services))
+		case "ws":
+			modules = append(modules, wsmod.NewModule(p))
+		case "jsonrpc":
+			modules = append(modules, jsonrpc.NewModule(p))
+		case "stdhttp":
+			modules = append(modules, stdhttp.NewModule(p))
+		case "mcp":
+			modules = append(modules, mcp.NewModule(p))
 		default:
 			modules = append(modules, micro.NewModule(p, services))
 		}
@@ -82,11 +148,25 @@ func (upgrader *Upgrader) GenerateModules(services []string) (err error) {
 
 	module := template.NewMainModule(p, modules)
 
+	//Modules reject receivers that require unsupported dependencies
+	err = modutils.TraverseModules(module, []string{""},
+		func(m template.Module, modulePath []string) error {
+			if validator, ok := m.(modutils.Validator); ok {
+				return validator.Validate()
+			}
+			return nil
+		})
+	if err != nil {
+		return err
+	}
+
 	err = modutils.TraverseModules(module, []string{""},
 		func(m template.Module, modulePath []string) (err error) {
 			fsPath := path.Join(servicePath, strings.Join(modulePath, "/"))
 			pkg := m.Generate()
-
+			if pkg.Err != nil {
+				return pkg.Err
+			}
 			return writeHelper(fsPath, m.Name(), pkg.Files...)
 		})
 